@@ -2,72 +2,79 @@ package Controllers
 
 import (
 	"UserPortrait/etc"
-	"UserPortrait/functions"
-	"errors"
 	"fmt"
 	"gorm.io/gorm"
-	"sync"
+	"gorm.io/gorm/clause"
 )
 
-var stationMutex sync.Mutex
+// UpsertStation 原子地插入或累加一条基站时段记录，唯一键为 (station_id, date, period_id)
+// record为一段时间内聚合的计数，累加后时延按latency_samples加权平均，丢包率按累加后的计数重新计算
+func (s *SqlController) UpsertStation(record etc.BaseStation) error {
+	record.LossRate = lossRate(record.ErrCount, record.DataSegments)
+	newErrCount := s.excluded("err_count")
+	newSegments := s.excluded("data_segments")
+	newSamples := s.excluded("latency_samples")
+	err := s.DB.Table("base_station").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "station_id"}, {Name: "date"}, {Name: "period_id"}},
+		// MySQL按顺序求值赋值语句而SQLite均取旧值，ave_latency与loss_rate须在计数之前更新才能在两者下结果一致
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "ave_latency"}, Value: gorm.Expr(s.weightedLatency("ave_latency", s.excluded("ave_latency"), newSamples))},
+			{Column: clause.Column{Name: "latency_samples"}, Value: gorm.Expr("latency_samples + " + newSamples)},
+			{Column: clause.Column{Name: "loss_rate"}, Value: gorm.Expr(fmt.Sprintf("CASE WHEN data_segments + %[2]s = 0 THEN 0 ELSE (err_count + %[1]s) * 1.0 / (data_segments + %[2]s) END", newErrCount, newSegments))},
+			{Column: clause.Column{Name: "conn_count"}, Value: gorm.Expr("conn_count + " + s.excluded("conn_count"))},
+			{Column: clause.Column{Name: "err_count"}, Value: gorm.Expr("err_count + " + newErrCount)},
+			{Column: clause.Column{Name: "data_segments"}, Value: gorm.Expr("data_segments + " + newSegments)},
+			{Column: clause.Column{Name: "total_flow"}, Value: gorm.Expr("total_flow + " + s.excluded("total_flow"))},
+		},
+	}).Create(&record).Error
+	if err != nil {
+		return fmt.Errorf("failed to upsert station record: %v", err)
+	}
+	return nil
+}
 
-// UpdateStationAfterUni 在Universe之后更新相应基站记录
-func (s *SqlController) UpdateStationAfterUni(TableName string) error {
-	stationMutex.Lock()
-	defer stationMutex.Unlock()
-	return s.DB.Transaction(func(tx *gorm.DB) error {
-		newStationRecord := <-etc.StationChannel
-		record, err := s.FindStationRecordByTime(TableName, newStationRecord.Date, newStationRecord.PeriodID)
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// 若找不到记录，插入新记录
-			err = s.DB.Table(TableName).Create(&newStationRecord).Error
-			if err != nil {
-				return fmt.Errorf("failed to create new station record: %v", err)
-			}
-		} else if err != nil {
-			return fmt.Errorf("failed to create new station record: %v", err)
-		} else {
-			// 若错误，则新记录errcount默认为1
-			errCount := record.ErrCount + newStationRecord.ErrCount
-			totalFlow := newStationRecord.TotalFlow + record.TotalFlow
-			aveLatency := (newStationRecord.AveLatency + record.AveLatency*record.ConnCount) / (record.ConnCount + 1)
-			err = s.DB.Table(TableName).Where("date =? AND period_id =?", record.Date, record.PeriodID).Updates(map[string]interface{}{
-				"conn_count":  record.ConnCount + 1,
-				"err_count":   errCount,
-				"total_flow":  totalFlow,
-				"ave_latency": aveLatency,
-			}).Error
-			return err
-		}
-		return nil
-	})
+// 丢包率：重传报文段数占该时段TCP数据段数的比例，纯ACK、保活报文与UDP数据包不计入分母
+func lossRate(errCount uint, dataSegments uint) float32 {
+	if dataSegments == 0 {
+		return 0
+	}
+	return float32(errCount) / float32(dataSegments)
 }
 
-func (s *SqlController) FindStationRecordByTime(TableName string, date string, periodID uint) (etc.BaseStation, error) {
-	var record etc.BaseStation
-	FoundRecord := s.DB.Table(TableName).Where("date =? AND period_id =?", date, periodID).Take(&record)
-	return record, FoundRecord.Error
+// 平均速率：总流量/平均时延，无时延样本时为0
+func averageSpeed(totalFlow uint, aveLatency uint) float32 {
+	if aveLatency == 0 {
+		return 0
+	}
+	return float32(totalFlow) / float32(aveLatency)
 }
 
 // DailyStationRecords 管理员用：获取指定基站的近24小时性能数据
-func (s *SqlController) DailyStationRecords(stationId uint, TableName string, yesterday string, today string, lastID uint, currID uint) (etc.StationInterface, error) {
+func (s *SqlController) DailyStationRecords(stationId uint, yesterday string, today string, lastID uint, currID uint) (etc.StationInterface, error) {
 	var lastRecords []etc.BaseStation
 	var currRecords []etc.BaseStation
 	// 实例初始化
 	var entity etc.StationInterface
 	// 更新实例的静态信息
+	// 未归属流量没有基站登记信息，坐标为0
+	if stationId != etc.UnassignedStation {
+		station, err := s.FindStationByID(stationId)
+		if err != nil {
+			return entity, err
+		}
+		entity.StationInfo.Latitute, entity.StationInfo.Longitude = station.Latitude, station.Longitude
+	}
 	entity.StationInfo.StationID = stationId
-	entity.StationInfo.Latitute, entity.StationInfo.Longitude = functions.ChooseStationLoc(stationId)
 	entity.CurrentPeriod = currID
 
 	// 数据库条件遍历，获取昨日、今日近24小时记录
-	Contents1 := s.DB.Table(TableName).Select("*")
-	Contents2 := s.DB.Table(TableName).Select("*")
-	err1 := Contents1.Where("date =? AND period_id >=? AND period_id <=?", yesterday, int(lastID), 24).Order("period_id").Find(&lastRecords).Error
+	Contents1 := s.DB.Table("base_station").Select("*")
+	Contents2 := s.DB.Table("base_station").Select("*")
+	err1 := Contents1.Where("station_id =? AND date =? AND period_id >=? AND period_id <=?", stationId, yesterday, int(lastID), 24).Order("period_id").Find(&lastRecords).Error
 	if err1 != nil {
 		return entity, err1
 	}
-	err2 := Contents2.Where("date =? AND period_id >=? AND period_id <=?", today, 1, int(currID)).Order("period_id").Find(&currRecords).Error
+	err2 := Contents2.Where("station_id =? AND date =? AND period_id >=? AND period_id <=?", stationId, today, 1, int(currID)).Order("period_id").Find(&currRecords).Error
 	if err2 != nil {
 		return entity, err2
 	}
@@ -83,7 +90,7 @@ func (s *SqlController) DailyStationRecords(stationId uint, TableName string, ye
 			PeriodID:  record1.PeriodID,
 			ConnCount: record1.ConnCount,
 			// TODO: 确定流量与延时的单位
-			AverageSpeed:    float32(record1.TotalFlow * 1.0 / record1.AveLatency),
+			AverageSpeed:    averageSpeed(record1.TotalFlow, record1.AveLatency),
 			AverageLatency:  record1.AveLatency,
 			AverageLossRate: record1.LossRate,
 		})
@@ -99,7 +106,7 @@ func (s *SqlController) DailyStationRecords(stationId uint, TableName string, ye
 			PeriodID:  record2.PeriodID,
 			ConnCount: record2.ConnCount,
 			// TODO: 确定流量与延时的单位
-			AverageSpeed:    float32(record2.TotalFlow * 1.0 / record2.AveLatency),
+			AverageSpeed:    averageSpeed(record2.TotalFlow, record2.AveLatency),
 			AverageLatency:  record2.AveLatency,
 			AverageLossRate: record2.LossRate,
 		})
@@ -0,0 +1,81 @@
+package Controllers
+
+import (
+	"testing"
+
+	"UserPortrait/etc"
+)
+
+func TestUpsertStation(t *testing.T) {
+	type batch struct {
+		conns, segments, errs, latency, samples uint
+	}
+	tests := []struct {
+		name        string
+		batches     []batch
+		wantConns   uint
+		wantLatency uint
+		wantSamples uint
+		wantLoss    float32
+	}{
+		{
+			name:        "weighted by samples not connections",
+			batches:     []batch{{100, 100, 10, 10, 1}, {100, 100, 10, 40, 1}},
+			wantConns:   200,
+			wantLatency: 25,
+			wantSamples: 2,
+			wantLoss:    0.1,
+		},
+		{
+			name:        "first samples replace empty latency",
+			batches:     []batch{{100, 100, 0, 0, 0}, {4, 4, 2, 30, 4}},
+			wantConns:   104,
+			wantLatency: 30,
+			wantSamples: 4,
+			wantLoss:    2.0 / 104,
+		},
+		{
+			// 纯ACK、UDP等数据包不计入丢包率的分母
+			name:      "loss over data segments not packets",
+			batches:   []batch{{100, 10, 1, 0, 0}, {100, 10, 1, 0, 0}},
+			wantConns: 200,
+			wantLoss:  0.1,
+		},
+		{
+			name:      "no data segments",
+			batches:   []batch{{10, 0, 0, 0, 0}, {10, 0, 0, 0, 0}},
+			wantConns: 20,
+		},
+		{
+			name:        "batch without samples keeps latency",
+			batches:     []batch{{4, 4, 0, 30, 4}, {100, 100, 0, 0, 0}},
+			wantConns:   104,
+			wantLatency: 30,
+			wantSamples: 4,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestController(t)
+			record := etc.BaseStation{StationID: 1, Date: "2024-05-01", PeriodID: 3}
+			for i, b := range tt.batches {
+				record.ConnCount, record.DataSegments, record.ErrCount = b.conns, b.segments, b.errs
+				record.AveLatency, record.LatencySamples = b.latency, b.samples
+				if err := s.UpsertStation(record); err != nil {
+					t.Fatalf("batch %d: %v", i, err)
+				}
+			}
+			var got etc.BaseStation
+			if err := s.DB.Table("base_station").Take(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.ConnCount != tt.wantConns || got.AveLatency != tt.wantLatency || got.LatencySamples != tt.wantSamples {
+				t.Fatalf("conns %d latency %d samples %d, want %d %d %d",
+					got.ConnCount, got.AveLatency, got.LatencySamples, tt.wantConns, tt.wantLatency, tt.wantSamples)
+			}
+			if diff := got.LossRate - tt.wantLoss; diff > 1e-6 || diff < -1e-6 {
+				t.Fatalf("loss rate %f, want %f", got.LossRate, tt.wantLoss)
+			}
+		})
+	}
+}
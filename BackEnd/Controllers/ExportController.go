@@ -0,0 +1,71 @@
+package Controllers
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 可导出的表及其日期列，日期列为空的表不支持按日期筛选；用户与管理员表含密码，不可导出
+var exportTables = map[string]string{
+	"universe":      "date",
+	"base_station":  "date",
+	"network_score": "date",
+	"stations":      "",
+}
+
+// ExportTables 可导出的表名
+func ExportTables() []string {
+	tables := make([]string, 0, len(exportTables))
+	for table := range exportTables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// ExportTable 逐行导出表中日期在 [from, to] 内的记录，from/to 为空表示不限；
+// fn 每行调用一次，columns 为列名，values 中的文本列已转换为string
+func (s *SqlController) ExportTable(table string, from string, to string, fn func(columns []string, values []any) error) error {
+	dateColumn, ok := exportTables[table]
+	if !ok {
+		return fmt.Errorf("table %q cannot be exported", table)
+	}
+	query := s.DB.Table(table)
+	if dateColumn == "" && (from != "" || to != "") {
+		return fmt.Errorf("table %q has no date column", table)
+	}
+	if from != "" {
+		query = query.Where(dateColumn+" >= ?", from)
+	}
+	if to != "" {
+		query = query.Where(dateColumn+" <= ?", to)
+	}
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	values := make([]any, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		if err := fn(columns, values); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
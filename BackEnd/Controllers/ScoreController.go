@@ -15,7 +15,7 @@ func (s *SqlController) InsertScore(userID uint, score float32) error {
 
 func (s *SqlController) UpdateScore(userID uint, score float32) error {
 	var scoreData = etc.Score{UserID: userID, Score: score, Date: time.Now().Format(time.DateOnly)}
-	result := s.DB.Table("network_score").Where("user_id = ?", userID).Updates(&scoreData).Error
+	result := s.DB.Table("network_score").Where("user_id = ? AND date = ?", userID, scoreData.Date).Updates(&scoreData).Error
 	return result
 }
 
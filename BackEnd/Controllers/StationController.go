@@ -0,0 +1,49 @@
+package Controllers
+
+import (
+	"UserPortrait/etc"
+	"gorm.io/gorm"
+)
+
+func (s *SqlController) ListStations() ([]etc.Station, error) {
+	var stations []etc.Station
+	err := s.DB.Table("stations").Order("id").Find(&stations).Error
+	return stations, err
+}
+
+func (s *SqlController) FindStationByID(id uint) (etc.Station, error) {
+	var station etc.Station
+	err := s.DB.Table("stations").Where("id = ?", id).Take(&station).Error
+	return station, err
+}
+
+func (s *SqlController) InsertStation(station *etc.Station) error {
+	return s.DB.Table("stations").Create(station).Error
+}
+
+// UpdateStation 按ID整体更新基站信息，基站不存在时返回 gorm.ErrRecordNotFound
+func (s *SqlController) UpdateStation(station etc.Station) error {
+	result := s.DB.Table("stations").Where("id = ?", station.ID).Select("*").Omit("id").Updates(&station)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// MySQL 对未变化的行返回0，需区分记录不存在
+		if _, err := s.FindStationByID(station.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteStation 删除基站信息，已采集的统计数据保留
+func (s *SqlController) DeleteStation(id uint) error {
+	result := s.DB.Table("stations").Where("id = ?", id).Delete(&etc.Station{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
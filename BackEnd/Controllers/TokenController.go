@@ -0,0 +1,93 @@
+package Controllers
+
+import (
+	"UserPortrait/etc"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+func (s *SqlController) InsertRefreshToken(record *etc.RefreshToken) error {
+	return s.DB.Table("refresh_token").Create(record).Error
+}
+
+func (s *SqlController) FindRefreshToken(tokenHash string) (etc.RefreshToken, error) {
+	var record etc.RefreshToken
+	err := s.DB.Table("refresh_token").Where("token_hash = ?", tokenHash).Take(&record).Error
+	return record, err
+}
+
+// RevokeRefreshToken 作废一个刷新token，返回是否由本次调用作废（并发刷新时只有一个调用成功）
+func (s *SqlController) RevokeRefreshToken(id uint) (bool, error) {
+	result := s.DB.Table("refresh_token").Where("id = ? AND revoked = ?", id, false).Update("revoked", true)
+	if result.Error != nil {
+		return false, fmt.Errorf("revoke refresh token failed:%v", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (s *SqlController) RevokeRefreshFamily(family string) error {
+	err := s.DB.Table("refresh_token").Where("family = ?", family).Update("revoked", true).Error
+	if err != nil {
+		return fmt.Errorf("revoke refresh token family failed:%v", err)
+	}
+	return nil
+}
+
+// RevokeSubjectTokens 作废该用户或管理员的全部刷新token，并吊销 before 之前签发的全部access token
+func (s *SqlController) RevokeSubjectTokens(role string, subjectId uint, before time.Time) error {
+	err := s.DB.Table("refresh_token").Where("role = ? AND subject_id = ?", role, subjectId).Update("revoked", true).Error
+	if err != nil {
+		return fmt.Errorf("revoke refresh tokens failed:%v", err)
+	}
+	err = s.DB.Table("token_revocation").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}, {Name: "subject_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before"}),
+	}).Create(&etc.TokenRevocation{Role: role, SubjectID: subjectId, RevokedBefore: before}).Error
+	if err != nil {
+		return fmt.Errorf("revoke access tokens failed:%v", err)
+	}
+	return nil
+}
+
+// RevokeAccessToken 吊销单个access token，已吊销时不做处理
+func (s *SqlController) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	err := s.DB.Table("revoked_token").Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&etc.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return fmt.Errorf("revoke access token failed:%v", err)
+	}
+	return nil
+}
+
+// AccessTokenRevoked access token是否已被单独吊销或因退出全部登录而吊销
+func (s *SqlController) AccessTokenRevoked(jti string, role string, subjectId uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := s.DB.Table("revoked_token").Where("jti = ?", jti).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+	return s.SubjectTokensRevoked(role, subjectId, issuedAt)
+}
+
+// SubjectTokensRevoked 该用户或管理员在issuedAt时签发的token是否已因退出全部登录而吊销
+func (s *SqlController) SubjectTokensRevoked(role string, subjectId uint, issuedAt time.Time) (bool, error) {
+	var count int64
+	err := s.DB.Table("token_revocation").Where("role = ? AND subject_id = ? AND revoked_before > ?", role, subjectId, issuedAt).Count(&count).Error
+	return count > 0, err
+}
+
+// PurgeExpiredTokens 清除已过期的刷新token与吊销记录
+func (s *SqlController) PurgeExpiredTokens(now time.Time) error {
+	if err := s.DB.Table("refresh_token").Where("expires_at < ?", now).Delete(&etc.RefreshToken{}).Error; err != nil {
+		return fmt.Errorf("purge refresh tokens failed:%v", err)
+	}
+	if err := s.DB.Table("revoked_token").Where("expires_at < ?", now).Delete(&etc.RevokedToken{}).Error; err != nil {
+		return fmt.Errorf("purge revoked tokens failed:%v", err)
+	}
+	return nil
+}
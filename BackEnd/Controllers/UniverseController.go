@@ -2,72 +2,70 @@ package Controllers
 
 import (
 	"UserPortrait/etc"
-	"UserPortrait/functions"
 	"fmt"
 	"gorm.io/gorm"
-	"sync"
+	"gorm.io/gorm/clause"
 )
 
-var uniMutex sync.Mutex
+// UpsertUniverse 原子地插入或累加一条universe记录，唯一键为 (station_id, user_id, ip, date, period_id)
+// 记录已存在时累加flow、count、err_count与data_segments，latency按latency_samples加权平均（原记录无样本时直接取新值）；remote_ip仅在原值为空时写入
+// 返回本次是否为新插入的记录，位置信息由调用方另行补充
+func (s *SqlController) UpsertUniverse(record etc.Universe) (bool, error) {
+	// 调用方在同一事务中逐条写入，先查询记录是否存在
+	var existing int64
+	if err := s.universeSlot(record).Count(&existing).Error; err != nil {
+		return false, fmt.Errorf("UID%v: upsert universe failed:%v", record.UserID, err)
+	}
+	newSamples := s.excluded("latency_samples")
+	err := s.DB.Table("universe").Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "station_id"}, {Name: "user_id"}, {Name: "ip"}, {Name: "date"}, {Name: "period_id"}},
+		// MySQL按顺序求值赋值语句而SQLite均取旧值，latency须在latency_samples之前更新才能在两者下结果一致
+		DoUpdates: clause.Set{
+			{Column: clause.Column{Name: "latency"}, Value: gorm.Expr(s.weightedLatency("latency", s.excluded("latency"), newSamples))},
+			{Column: clause.Column{Name: "latency_samples"}, Value: gorm.Expr("latency_samples + " + newSamples)},
+			{Column: clause.Column{Name: "flow"}, Value: gorm.Expr("flow + " + s.excluded("flow"))},
+			{Column: clause.Column{Name: "count"}, Value: gorm.Expr("count + " + s.excluded("count"))},
+			{Column: clause.Column{Name: "err_count"}, Value: gorm.Expr("err_count + " + s.excluded("err_count"))},
+			{Column: clause.Column{Name: "data_segments"}, Value: gorm.Expr("data_segments + " + s.excluded("data_segments"))},
+			{Column: clause.Column{Name: "remote_ip"}, Value: gorm.Expr("CASE WHEN remote_ip = '' THEN " + s.excluded("remote_ip") + " ELSE remote_ip END")},
+		},
+	}).Create(&record).Error
+	if err != nil {
+		return false, fmt.Errorf("UID%v: upsert universe failed:%v", record.UserID, err)
+	}
+	return existing == 0, nil
+}
 
-// 插入新universe记录
-func (s *SqlController) InsertUniverse(TableName string) (err error) {
-	uniMutex.Lock()
-	defer uniMutex.Unlock()
-	return s.DB.Transaction(func(tx *gorm.DB) error {
-		if newuni, ok := <-etc.UniverseChannel; ok {
-			// 首先更新位置信息
-			newuni.District, newuni.City, newuni.Longitude, newuni.Latitude, err = s.TransferLocationInfo(newuni.Ip)
-			if err != nil {
-				return fmt.Errorf("UID%v: update universe failed:%v\n", newuni.UserID, err)
-			}
-			// 创建完全体universe
-			err = tx.Table(TableName).Create(&newuni).Error
-			if err != nil {
-				fmt.Println("Hooks' error:", err)
-				return fmt.Errorf("UID%v: update universe failed:%v\n", newuni.UserID, err)
-			}
-			fmt.Println("UID", newuni.UserID, ":update universe success")
-			return err
-		} else {
-			fmt.Println("update universe failed:UniverseChannel error")
-			return fmt.Errorf("update universe failed:UniverseChannel error")
-		}
-	})
+// UpdateUniverseLocation 更新record所在记录的位置信息及其来源
+func (s *SqlController) UpdateUniverseLocation(record etc.Universe) error {
+	err := s.universeSlot(record).Updates(map[string]interface{}{
+		"district":   record.District,
+		"city":       record.City,
+		"longitude":  record.Longitude,
+		"latitude":   record.Latitude,
+		"loc_source": record.LocSource,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("UID%v: update universe location failed:%v", record.UserID, err)
+	}
+	return nil
 }
 
-// 满足时空相同条件的universe更新
-func (s *SqlController) UpdateUniverse(TableName string) (err error) {
-	uniMutex.Lock()
-	defer uniMutex.Unlock()
-	return s.DB.Transaction(func(tx *gorm.DB) error {
-		if uni, ok := <-etc.UniverseChannel; ok {
-			err = tx.Table(TableName).Where("period_id = ? AND ip = ? AND date = ?", uni.PeriodID, uni.Ip, uni.Date).Updates(map[string]interface{}{
-				"flow":      uni.Flow,
-				"latency":   uni.Latency,
-				"count":     uni.Count,
-				"err_count": uni.ErrCount,
-			}).Error
-			if err != nil {
-				fmt.Printf("UID%v Hooks' error:%v\n", uni.UserID, err)
-				return fmt.Errorf("UID%v: update universe failed:%v\n", uni.UserID, err)
-			}
-			fmt.Println("UID", uni.UserID, ":update universe success")
-			return nil
-		} else {
-			fmt.Println("update universe failed:UniverseChannel error")
-			return fmt.Errorf("update universe failed:UniverseChannel error")
-		}
-	})
+func (s *SqlController) universeSlot(record etc.Universe) *gorm.DB {
+	return s.DB.Table("universe").Where("station_id =? AND user_id =? AND ip =? AND date =? AND period_id =?", record.StationID, record.UserID, record.Ip, record.Date, record.PeriodID)
 }
 
-// 根据IP更新位置信息
-func (s *SqlController) TransferLocationInfo(ip string) (string, string, float32, float32, error) {
-	locinfo, err := GetLocation(ip)
+// ListPendingLocations 按唯一键顺序获取位于after之后的至多limit条尚未定位的记录，
+// 调用方以上一批的最后一条记录作为after逐批遍历，定位反复失败的记录不会挡住其后的记录
+func (s *SqlController) ListPendingLocations(after etc.Universe, limit int) ([]etc.Universe, error) {
+	var records []etc.Universe
+	err := s.DB.Table("universe").
+		Where("loc_source = ?", etc.LocPending).
+		Where("(date, period_id, station_id, user_id, ip) > (?, ?, ?, ?, ?)", after.Date, after.PeriodID, after.StationID, after.UserID, after.Ip).
+		Order("date, period_id, station_id, user_id, ip").
+		Limit(limit).Find(&records).Error
 	if err != nil {
-		return "", "", 0, 0, fmt.Errorf("Get location failed %v\n", err)
+		return nil, fmt.Errorf("list pending locations failed:%v", err)
 	}
-	roundLat := functions.RoundToFloat32(locinfo.Result.Location.Lat, 4)
-	roundLng := functions.RoundToFloat32(locinfo.Result.Location.Lng, 4)
-	return locinfo.Result.AdInfo.District, locinfo.Result.AdInfo.City, roundLat, roundLng, nil
+	return records, nil
 }
@@ -0,0 +1,131 @@
+package Controllers
+
+import (
+	"fmt"
+	"testing"
+
+	"UserPortrait/etc"
+	"UserPortrait/service/database"
+)
+
+func newTestController(t *testing.T) *SqlController {
+	t.Helper()
+	db, err := database.Open(database.Options{Driver: database.DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return &SqlController{DB: db}
+}
+
+func TestUpsertUniverse(t *testing.T) {
+	type batch struct {
+		count, latency, samples uint
+		wantNew                 bool
+	}
+	tests := []struct {
+		name        string
+		batches     []batch
+		wantCount   uint
+		wantLatency uint
+		wantSamples uint
+	}{
+		{
+			name:        "weighted by samples not packets",
+			batches:     []batch{{100, 10, 1, true}, {1, 40, 1, false}},
+			wantCount:   101,
+			wantLatency: 25,
+			wantSamples: 2,
+		},
+		{
+			name:        "batch without samples keeps latency",
+			batches:     []batch{{3, 20, 3, true}, {50, 0, 0, false}},
+			wantCount:   53,
+			wantLatency: 20,
+			wantSamples: 3,
+		},
+		{
+			name:        "first samples replace empty latency",
+			batches:     []batch{{50, 0, 0, true}, {2, 30, 2, false}, {2, 60, 1, false}},
+			wantCount:   54,
+			wantLatency: 40,
+			wantSamples: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestController(t)
+			record := etc.Universe{StationID: 1, UserID: 7, Ip: "10.0.0.2", Date: "2024-05-01", PeriodID: 3, LocSource: etc.LocPending}
+			for i, b := range tt.batches {
+				record.Count, record.Latency, record.LatencySamples = b.count, b.latency, b.samples
+				isNew, err := s.UpsertUniverse(record)
+				if err != nil {
+					t.Fatalf("batch %d: %v", i, err)
+				}
+				if isNew != b.wantNew {
+					t.Fatalf("batch %d: isNew = %t, want %t", i, isNew, b.wantNew)
+				}
+			}
+			var got etc.Universe
+			if err := s.universeSlot(record).Take(&got).Error; err != nil {
+				t.Fatal(err)
+			}
+			if got.Count != tt.wantCount || got.Latency != tt.wantLatency || got.LatencySamples != tt.wantSamples {
+				t.Fatalf("count %d latency %d samples %d, want %d %d %d",
+					got.Count, got.Latency, got.LatencySamples, tt.wantCount, tt.wantLatency, tt.wantSamples)
+			}
+		})
+	}
+}
+
+func TestListPendingLocationsCursor(t *testing.T) {
+	s := newTestController(t)
+	var want []uint
+	for i := uint(1); i <= 7; i++ {
+		record := etc.Universe{StationID: 1, UserID: i, Ip: "10.0.0.2", Date: "2024-05-01", PeriodID: 3, Count: 1, LocSource: etc.LocPending}
+		if i%3 == 0 {
+			record.LocSource = etc.LocUnknown
+		} else {
+			want = append(want, i)
+		}
+		if _, err := s.UpsertUniverse(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name  string
+		limit int
+	}{
+		{"single batch", 10},
+		{"exact batches", 5},
+		{"many batches", 2},
+		{"one at a time", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint
+			var cursor etc.Universe
+			for batches := 0; ; batches++ {
+				if batches > len(want) {
+					t.Fatal("cursor does not advance")
+				}
+				records, err := s.ListPendingLocations(cursor, tt.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, r := range records {
+					got = append(got, r.UserID)
+				}
+				if len(records) < tt.limit {
+					break
+				}
+				cursor = records[len(records)-1]
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("got users %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -10,26 +10,27 @@ func (s *SqlController) FindUserByMAC(mac string) (etc.Userinfo, error) {
 	return user, err
 }
 
+func (s *SqlController) FindUserByID(id uint) (etc.Userinfo, error) {
+	var user etc.Userinfo
+	err := s.DB.Table("user_info").Where("id = ?", id).Take(&user).Error
+	return user, err
+}
+
 func (s *SqlController) FindUserByName(name string) (etc.Userinfo, error) {
 	var user etc.Userinfo
 	err := s.DB.Table("user_info").Where("username = ?", name).Take(&user).Error
 	return user, err
 }
 
-func (s *SqlController) InsertUser(user etc.Userinfo) {
-	err := s.DB.Table("user_info").Create(&user).Error
-	if err != nil {
-		panic(err)
-	}
+func (s *SqlController) InsertUser(user *etc.Userinfo) error {
+	return s.DB.Table("user_info").Create(user).Error
 }
 
-func (s *SqlController) UpdateUserByID(id uint, name string, pswd string) {
+func (s *SqlController) UpdateUserByID(id uint, name string, pswd string) error {
 
 	err := s.DB.Table("user_info").Where("id = ?", id).Updates(map[string]interface{}{
 		"username": name, "password": pswd}).Error
-	if err != nil {
-		panic(err)
-	}
+	return err
 }
 
 // UserDailyFlow 用户：获取近24小时流量数据
@@ -40,8 +41,8 @@ func (s *SqlController) UserDailyFlow(userId uint, yesterday string, today strin
 	var entity etc.TrafficData
 
 	// 数据库条件遍历，获取昨日、今日近24小时记录
-	Contents1 := s.DB.Model(&[]etc.Universe{}).Table("universe1").Select("user_id,date,period_id,SUM(flow) as flow")
-	Contents2 := s.DB.Model(&[]etc.Universe{}).Table("universe1").Select("user_id,date,period_id,SUM(flow) as flow")
+	Contents1 := s.DB.Model(&[]etc.Universe{}).Table("universe").Select("user_id,date,period_id,SUM(flow) as flow")
+	Contents2 := s.DB.Model(&[]etc.Universe{}).Table("universe").Select("user_id,date,period_id,SUM(flow) as flow")
 	err1 := Contents1.Where("user_id =? AND date =? AND period_id >=? AND period_id <=?", userId, yesterday, int(lastID), 24).Group("user_id, date, period_id").Order("period_id").Find(&lastRecords).Error
 	if err1 != nil {
 		return entity, err1
@@ -61,8 +62,8 @@ func (s *SqlController) UserDailyFlow(userId uint, yesterday string, today strin
 }
 
 // UserFreqLoc 统计用户常去地点
-func (s *SqlController) UserFreqLoc(userId uint, tableName string) ([]etc.FreqLocation, error) {
+func (s *SqlController) UserFreqLoc(userId uint) ([]etc.FreqLocation, error) {
 	var entity []etc.FreqLocation
-	err := s.DB.Model(&[]etc.Universe{}).Table(tableName).Select("city as name, COUNT(city) as count,latitude as lat,longitude as lng").Where("user_id = ?", userId).Group("city,latitude,longitude").Order("city").Find(&entity).Error
+	err := s.DB.Model(&[]etc.Universe{}).Table("universe").Select("city as name, COUNT(city) as count,latitude as lat,longitude as lng").Where("user_id = ?", userId).Group("city,latitude,longitude").Order("city").Find(&entity).Error
 	return entity, err
 }
@@ -5,3 +5,29 @@ import "gorm.io/gorm"
 type SqlController struct {
 	DB *gorm.DB
 }
+
+// 以下辅助函数用于拼接同时兼容MySQL与SQLite的upsert表达式
+
+// excluded 引用冲突时待插入行的列值
+func (s *SqlController) excluded(column string) string {
+	if s.DB.Dialector.Name() == "sqlite" {
+		return "excluded." + column
+	}
+	return "VALUES(" + column + ")"
+}
+
+// intDiv 整数除法
+func (s *SqlController) intDiv(a string, b string) string {
+	if s.DB.Dialector.Name() == "sqlite" {
+		return "(" + a + ") / (" + b + ")"
+	}
+	return "(" + a + ") DIV (" + b + ")"
+}
+
+// weightedLatency 按样本数加权合并时延：新数据无样本时保留原值，原记录无样本时取新值，
+// 须在 latency_samples 累加之前求值
+func (s *SqlController) weightedLatency(column string, newLatency string, newSamples string) string {
+	return "CASE WHEN " + newSamples + " = 0 THEN " + column +
+		" WHEN latency_samples = 0 THEN " + newLatency +
+		" ELSE " + s.intDiv(column+" * latency_samples + "+newLatency+" * "+newSamples, "latency_samples + "+newSamples) + " END"
+}
@@ -0,0 +1,81 @@
+package Controllers
+
+import (
+	"UserPortrait/etc"
+	"gorm.io/gorm"
+	"time"
+)
+
+// 数据访问接口，SqlController 为基于gorm的实现；测试替身、缓存装饰器或其他存储只需实现对应接口
+
+// ErrNotFound 记录不存在，各实现查询不到记录时均应返回该错误
+var ErrNotFound = gorm.ErrRecordNotFound
+
+type UserRepository interface {
+	FindUserByID(id uint) (etc.Userinfo, error)
+	FindUserByMAC(mac string) (etc.Userinfo, error)
+	FindUserByName(name string) (etc.Userinfo, error)
+	// InsertUser 插入后回填 user.ID
+	InsertUser(user *etc.Userinfo) error
+	UpdateUserByID(id uint, name string, pswd string) error
+	UserDailyFlow(userId uint, yesterday string, today string, lastID uint, currID uint) (etc.TrafficData, error)
+	UserFreqLoc(userId uint) ([]etc.FreqLocation, error)
+}
+
+type AdminRepository interface {
+	FindAdminByName(name string) (etc.Admininfo, error)
+	InsertAdmin(admin etc.Admininfo) error
+	UpdateAdminByID(id uint, name string, pswd string) error
+}
+
+type UniverseRepository interface {
+	UpsertUniverse(record etc.Universe) (bool, error)
+	UpdateUniverseLocation(record etc.Universe) error
+	// ListPendingLocations 按唯一键顺序列出位于 after 之后的待定位记录，after 为零值时从头开始
+	ListPendingLocations(after etc.Universe, limit int) ([]etc.Universe, error)
+}
+
+type StationRepository interface {
+	ListStations() ([]etc.Station, error)
+	FindStationByID(id uint) (etc.Station, error)
+	// InsertStation 插入后回填 station.ID
+	InsertStation(station *etc.Station) error
+	UpdateStation(station etc.Station) error
+	DeleteStation(id uint) error
+	UpsertStation(record etc.BaseStation) error
+	DailyStationRecords(stationId uint, yesterday string, today string, lastID uint, currID uint) (etc.StationInterface, error)
+}
+
+type ScoreRepository interface {
+	InsertScore(userID uint, score float32) error
+	UpdateScore(userID uint, score float32) error
+	FindScoreRecord(userID uint, date string) error
+	AverageScoreByDate() ([]etc.AverageScoreInterface, error)
+}
+
+type TokenRepository interface {
+	// InsertRefreshToken 插入后回填 record.ID
+	InsertRefreshToken(record *etc.RefreshToken) error
+	FindRefreshToken(tokenHash string) (etc.RefreshToken, error)
+	RevokeRefreshToken(id uint) (bool, error)
+	RevokeRefreshFamily(family string) error
+	RevokeSubjectTokens(role string, subjectId uint, before time.Time) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+	AccessTokenRevoked(jti string, role string, subjectId uint, issuedAt time.Time) (bool, error)
+	SubjectTokensRevoked(role string, subjectId uint, issuedAt time.Time) (bool, error)
+	PurgeExpiredTokens(now time.Time) error
+}
+
+type ExportRepository interface {
+	ExportTable(table string, from string, to string, fn func(columns []string, values []any) error) error
+}
+
+var (
+	_ UserRepository     = (*SqlController)(nil)
+	_ AdminRepository    = (*SqlController)(nil)
+	_ UniverseRepository = (*SqlController)(nil)
+	_ StationRepository  = (*SqlController)(nil)
+	_ ScoreRepository    = (*SqlController)(nil)
+	_ TokenRepository    = (*SqlController)(nil)
+	_ ExportRepository   = (*SqlController)(nil)
+)
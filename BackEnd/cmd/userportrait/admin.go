@@ -0,0 +1,38 @@
+package main
+
+import (
+	"UserPortrait/service"
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 创建管理员账号；未指定 -password 时从标准输入读取一行作为密码，避免密码留在命令历史中
+func runCreateAdmin(args []string) error {
+	fs, src := newFlagSet("create-admin", "", "database")
+	name := fs.String("name", "", "管理员用户名")
+	password := fs.String("password", "", "管理员密码，为空时从标准输入读取")
+	fs.Parse(args)
+	if *name == "" {
+		fs.Usage()
+		return errors.New("create-admin: -name is required")
+	}
+	if _, err := setup(src, "database"); err != nil {
+		return err
+	}
+	if *password == "" {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password failed: %v", err)
+		}
+		*password = strings.TrimRight(line, "\r\n")
+	}
+	if err := service.CreateAdmin(*name, *password); err != nil {
+		return err
+	}
+	fmt.Printf("admin %s created\n", *name)
+	return nil
+}
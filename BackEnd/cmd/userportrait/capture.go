@@ -0,0 +1,199 @@
+package main
+
+import (
+	"UserPortrait/configs"
+	"UserPortrait/parsePacket/attribution"
+	"UserPortrait/parsePacket/capture"
+	"UserPortrait/parsePacket/process"
+	"UserPortrait/service"
+	"UserPortrait/service/database"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+)
+
+// pipeline 数据包处理流水线：去重、基站归属、worker池与内存聚合
+type pipeline struct {
+	captureCfg capture.CaptureConfig
+	// processed 在 capture.PacketChannel 关闭且全部数据包处理完毕后关闭
+	processed chan struct{}
+	// liveDone 在实时抓包结束后关闭，liveErr 为其错误；未启动实时抓包时 liveDone 为nil
+	liveDone chan struct{}
+	liveErr  error
+}
+
+// 初始化处理流水线并开始消费 capture.PacketChannel
+func startPipeline(cfg *configs.Config) (*pipeline, error) {
+	captureCfg := captureConfig(cfg.Capture)
+	poolCfg := process.PoolConfig{
+		Workers:    cfg.Processor.Workers,
+		QueueDepth: cfg.Processor.QueueDepth,
+		Policy:     process.QueuePolicy(cfg.Processor.QueuePolicy),
+		SampleRate: cfg.Processor.SampleRate,
+	}
+	if err := poolCfg.Validate(); err != nil {
+		return nil, err
+	}
+	capture.SetExcludeIPs(excludeIPs(cfg))
+	capture.SetDeduper(captureCfg.NewDeduper())
+	service.RegisterStats("dedup", func() any { return capture.GetDedupStats() })
+	service.RegisterStats("processor", func() any { return process.GetPoolStats() })
+	process.SetDebug(cfg.Processor.Debug)
+	if err := service.InitAggregator(cfg.Processor.FlushInterval, cfg.Processor.SpillFile, cfg.Processor.MaxPendingRows); err != nil {
+		return nil, err
+	}
+	service.RegisterStats("aggregator", func() any { return service.GetAggregatorStats() })
+	// 归属规则载入失败时所有流量记为未归属，不影响抓包
+	if err := service.LoadStationRules(); err != nil {
+		fmt.Println("load station rules failed:", err)
+	}
+	service.RegisterStats("attribution", func() any { return attribution.GetStats() })
+	if err := service.InitGeoLocator(); err != nil {
+		return nil, err
+	}
+	if err := service.StartGeoEnricher(cfg.Geo.Workers, cfg.Geo.QueueDepth, cfg.Geo.BackfillInterval); err != nil {
+		return nil, err
+	}
+	service.RegisterStats("geo", func() any { return service.GetGeoStats() })
+	configs.OnReload(func(old *configs.Config, new *configs.Config) {
+		process.SetDebug(new.Processor.Debug)
+		if reflect.DeepEqual(old.Geo, new.Geo) && old.TencentMap == new.TencentMap {
+			return
+		}
+		if err := service.InitGeoLocator(); err != nil {
+			fmt.Println("reload geo locator failed:", err)
+		}
+	})
+
+	p := &pipeline{captureCfg: captureCfg, processed: make(chan struct{})}
+	go func() {
+		defer close(p.processed)
+		process.CapturePackets(capture.PacketChannel, poolCfg)
+	}()
+	return p, nil
+}
+
+// 在抓包配置选中的网卡上实时抓包，直至ctx取消
+func (p *pipeline) startLive(ctx context.Context) {
+	p.liveDone = make(chan struct{})
+	go func() {
+		defer close(p.liveDone)
+		p.liveErr = capture.Tcpd(ctx, p.captureCfg)
+	}()
+}
+
+// shutdown 等待实时抓包结束（调用前需已取消 startLive 的ctx）并关闭 capture.PacketChannel，
+// 处理完已读出的数据包后写入全部聚合数据，写库失败的数据保存至spill文件，
+// 最后在 server.shutdown_timeout 内尽量完成新记录的定位
+func (p *pipeline) shutdown() error {
+	var err error
+	if p.liveDone != nil {
+		<-p.liveDone
+		err = p.liveErr
+		fmt.Println("capture stopped")
+	}
+	close(capture.PacketChannel)
+	<-p.processed
+	fmt.Printf("packets drained: %+v\n", process.GetPoolStats())
+	if flushErr := service.StopAggregator(); flushErr != nil {
+		err = errors.Join(err, flushErr)
+	} else {
+		fmt.Printf("aggregates flushed: %+v\n", service.GetAggregatorStats())
+	}
+	service.StopGeoEnricher(configs.Get().Server.ShutdownTimeout)
+	return err
+}
+
+// 将 capture 配置转换为抓包参数，配置已在载入时校验
+func captureConfig(cc configs.CaptureConfig) capture.CaptureConfig {
+	captureCfg := capture.CaptureConfig{
+		Include:         cc.Include,
+		Exclude:         cc.Exclude,
+		SkipLoopback:    cc.SkipLoopback,
+		Filter:          cc.Filter,
+		SnapLen:         int32(cc.SnapLen),
+		Promiscuous:     cc.Promiscuous,
+		Timeout:         cc.Timeout,
+		DedupWindow:     cc.DedupWindow,
+		DedupMaxEntries: cc.DedupMaxEntries,
+	}
+	for _, iface := range cc.Interfaces {
+		captureCfg.Interfaces = append(captureCfg.Interfaces, capture.InterfaceConfig{
+			Match:       iface.Match,
+			Filter:      iface.Filter,
+			SnapLen:     int32(iface.SnapLen),
+			Promiscuous: iface.Promiscuous,
+		})
+	}
+	return captureCfg
+}
+
+// 不统计的地址：配置中的地址加上数据库主机地址
+func excludeIPs(cfg *configs.Config) []string {
+	ips := append([]string{}, cfg.Capture.ExcludeIPs...)
+	if cfg.Database.Driver == database.DriverMySQL && cfg.Database.DSN == "" {
+		if host, _, err := net.SplitHostPort(cfg.Database.Host); err == nil && net.ParseIP(host) != nil {
+			ips = append(ips, host)
+		}
+	}
+	return ips
+}
+
+func runCapture(args []string) error {
+	fs, src := newFlagSet("capture", "", "database", "capture", "processor")
+	fs.Parse(args)
+	cfg, err := setup(src, "database", "capture", "processor", "geo")
+	if err != nil {
+		return err
+	}
+	fmt.Printf("config:\n%s", cfg)
+	pipe, err := startPipeline(cfg)
+	if err != nil {
+		return err
+	}
+
+	// SIGHUP 时同时重新载入基站归属规则，使接口端对基站的修改在抓包端生效
+	ctx, stop := signalContext(func() {
+		if err := service.LoadStationRules(); err != nil {
+			fmt.Println("load station rules failed:", err)
+		}
+	})
+	defer stop()
+	pipe.startLive(ctx)
+	select {
+	case <-ctx.Done():
+	case <-pipe.liveDone:
+		fmt.Println("capture stopped unexpectedly")
+	}
+	stop()
+	return pipe.shutdown()
+}
+
+func runReplay(args []string) error {
+	fs, src := newFlagSet("replay", "<pcap>...", "database", "capture", "processor")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("replay: no pcap file given")
+	}
+	cfg, err := setup(src, "database", "capture", "processor", "geo")
+	if err != nil {
+		return err
+	}
+	pipe, err := startPipeline(cfg)
+	if err != nil {
+		return err
+	}
+
+	// 收到退出信号时停止回放，已读出的数据包照常处理并写库
+	ctx, stop := signalContext(nil)
+	defer stop()
+	replayErr := capture.Replay(ctx, fs.Args(), cfg.Capture.ReplaySpeed)
+	if ctx.Err() != nil {
+		replayErr = nil
+		fmt.Println("replay interrupted")
+	}
+	return errors.Join(replayErr, pipe.shutdown())
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/service"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// 导出统计数据，格式为 csv（首行为列名）或 json（每行一个对象）
+func runExport(args []string) error {
+	tables := strings.Join(Controllers.ExportTables(), "|")
+	fs, src := newFlagSet("export", tables, "database")
+	from := fs.String("from", "", "开始日期(YYYY-MM-DD)，为空不限")
+	to := fs.String("to", "", "结束日期(YYYY-MM-DD)，为空不限")
+	format := fs.String("format", "csv", "输出格式：csv 或 json")
+	output := fs.String("o", "", "输出文件，为空时输出到标准输出")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("export: expect one table of %s", tables)
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("export: unsupported format %q", *format)
+	}
+	if _, err := setup(src, "database"); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	count := 0
+	var err error
+	switch *format {
+	case "csv":
+		cw := csv.NewWriter(w)
+		err = service.ExportTable(fs.Arg(0), *from, *to, func(columns []string, values []any) error {
+			if count == 0 {
+				if err := cw.Write(columns); err != nil {
+					return err
+				}
+			}
+			record := make([]string, len(values))
+			for i, v := range values {
+				if v != nil {
+					record[i] = fmt.Sprint(v)
+				}
+			}
+			count++
+			return cw.Write(record)
+		})
+		cw.Flush()
+		err = errors.Join(err, cw.Error())
+	case "json":
+		enc := json.NewEncoder(w)
+		err = service.ExportTable(fs.Arg(0), *from, *to, func(columns []string, values []any) error {
+			row := make(map[string]any, len(columns))
+			for i, column := range columns {
+				row[column] = values[i]
+			}
+			count++
+			return enc.Encode(row)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d rows from %s\n", count, fs.Arg(0))
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"UserPortrait/configs"
+	"UserPortrait/service/database"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 用户画像系统命令行入口，各子命令可分别部署：如边缘节点只运行 capture，API服务器只运行 serve
+// 用法: userportrait <command> [flags] [args]
+
+type command struct {
+	name     string
+	synopsis string
+	run      func(args []string) error
+}
+
+var commands = []command{
+	{"serve", "启动HTTP接口与定期训练，-capture 时同时实时抓包", runServe},
+	{"capture", "实时抓包并写入数据库", runCapture},
+	{"replay", "回放pcap/pcapng文件并写入数据库，回放结束后退出", runReplay},
+	{"migrate", "执行数据库迁移：up|down|status", runMigrate},
+	{"train", "触发一次模型训练", runTrain},
+	{"seed", "从JSON文件导入基站", runSeed},
+	{"create-admin", "创建管理员账号", runCreateAdmin},
+	{"export", "导出统计数据为CSV或JSON", runExport},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: userportrait <command> [flags] [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", cmd.name, cmd.synopsis)
+	}
+	fmt.Fprintln(os.Stderr, "\n执行 userportrait <command> -h 查看子命令参数")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	for _, cmd := range commands {
+		if cmd.name == name {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				fmt.Printf("%s failed: %v\n", name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+// 创建子命令的参数集，并绑定 sections 中各配置项对应的命令行参数
+func newFlagSet(name string, args string, sections ...string) (*flag.FlagSet, *configs.Source) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	src := configs.BindFlags(fs, sections...)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: userportrait %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs, src
+}
+
+// 加载配置并校验 sections 中的部分，随后按配置设置数据库连接
+func setup(src *configs.Source, sections ...string) (*configs.Config, error) {
+	cfg, err := configs.Setup(src, sections...)
+	if err != nil {
+		return nil, err
+	}
+	database.Configure(database.OptionsFrom(cfg.Database))
+	return cfg, nil
+}
+
+// 返回收到 SIGINT/SIGTERM 时取消的ctx，调用方据此开始有序退出；退出过程中再次收到退出信号时立即强制退出。
+// 收到 SIGHUP 时重新加载配置并调用 onReload
+func signalContext(onReload func()) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				if _, err := configs.Reload(); err != nil {
+					fmt.Println("reload config failed:", err)
+				}
+				if onReload != nil {
+					onReload()
+				}
+				continue
+			}
+			if ctx.Err() != nil {
+				fmt.Println("收到第二次退出信号，强制退出")
+				os.Exit(130)
+			}
+			fmt.Printf("收到退出信号 %v，开始退出...\n", sig)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(sigChan)
+		cancel()
+	}
+}
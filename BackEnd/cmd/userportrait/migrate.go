@@ -0,0 +1,69 @@
+package main
+
+import (
+	"UserPortrait/service/database"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 数据库表结构迁移，只需数据库配置
+func runMigrate(args []string) error {
+	fs, src := newFlagSet("migrate", "up|down|status", "database")
+	steps := fs.Int("steps", 1, "down时回滚的迁移个数")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("migrate: expect one of up, down, status")
+	}
+	if _, err := setup(src, "database"); err != nil {
+		return err
+	}
+	db, err := database.InitDB()
+	if err != nil {
+		return err
+	}
+
+	switch fs.Arg(0) {
+	case "up":
+		return migrateUp()
+	case "down":
+		done, err := database.MigrateDown(db, *steps)
+		for _, m := range done {
+			fmt.Printf("rolled back %d %s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		states, err := database.MigrationStatus(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			appliedAt := "pending"
+			if state.Applied {
+				appliedAt = state.AppliedAt.Format(time.DateTime)
+			}
+			fmt.Printf("%4d  %-40s %s\n", state.Version, state.Name, appliedAt)
+		}
+		return nil
+	default:
+		fs.Usage()
+		return fmt.Errorf("migrate: unknown action %q", fs.Arg(0))
+	}
+}
+
+// 执行未执行的数据库迁移
+func migrateUp() error {
+	db, err := database.InitDB()
+	if err != nil {
+		return err
+	}
+	done, err := database.MigrateUp(db)
+	for _, m := range done {
+		fmt.Printf("applied migration %d %s\n", m.Version, m.Name)
+	}
+	if err == nil && len(done) == 0 {
+		fmt.Println("schema is up to date")
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"UserPortrait/etc"
+	"UserPortrait/service"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// seedFile seed 子命令的输入文件格式，示例见 seed.example.json
+type seedFile struct {
+	Stations []etc.Station `json:"stations"`
+}
+
+// 导入基站，同名基站更新，可重复执行
+func runSeed(args []string) error {
+	fs, src := newFlagSet("seed", "<file.json>", "database")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("seed: expect one seed file")
+	}
+	if _, err := setup(src, "database"); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var seed seedFile
+	if err := json.Unmarshal(data, &seed); err != nil {
+		return fmt.Errorf("parse seed file failed: %v", err)
+	}
+	created, updated, err := service.SeedStations(seed.Stations)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("stations: %d created, %d updated\n", created, updated)
+	return nil
+}
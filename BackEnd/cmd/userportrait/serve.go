@@ -0,0 +1,150 @@
+package main
+
+import (
+	"UserPortrait/configs"
+	"UserPortrait/routers"
+	"UserPortrait/service"
+	"UserPortrait/service/prediction"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+func runServe(args []string) error {
+	fs, src := newFlagSet("serve", "")
+	withCapture := fs.Bool("capture", false, "同时在本进程内实时抓包，适用于单机部署")
+	autoMigrate := fs.Bool("migrate", false, "启动前执行未执行的数据库迁移")
+	fs.Parse(args)
+
+	sections := []string{"server", "database", "auth", "prediction", "training"}
+	if *withCapture {
+		sections = append(sections, "capture", "processor", "geo")
+	}
+	cfg, err := setup(src, sections...)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("config:\n%s", cfg)
+	if *autoMigrate {
+		if err := migrateUp(); err != nil {
+			return err
+		}
+	}
+
+	ctx, stop := signalContext(nil)
+	defer stop()
+
+	var pipe *pipeline
+	if *withCapture {
+		if pipe, err = startPipeline(cfg); err != nil {
+			return err
+		}
+		pipe.startLive(ctx)
+	}
+
+	service.InitPredictionClient(predictionConfig(cfg))
+	service.InitTokenRevocation()
+	go service.PurgeExpiredTokens(ctx, time.Hour)
+	// 热加载后替换预测客户端、重置训练计时
+	trainingReset := make(chan struct{}, 1)
+	configs.OnReload(func(old *configs.Config, new *configs.Config) {
+		if old.Prediction != new.Prediction {
+			service.InitPredictionClient(predictionConfig(new))
+		}
+		if old.Training.Interval != new.Training.Interval {
+			select {
+			case trainingReset <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	// 启动HTTP服务
+	server := &http.Server{
+		Addr:    cfg.Server.Addr,
+		Handler: routers.InitRouter(),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- fmt.Errorf("failed to run server: %v", err)
+		}
+	}()
+
+	// 启动定期训练
+	trainingDone := make(chan struct{})
+	go func() {
+		defer close(trainingDone)
+		scheduledTraining(ctx, cfg.Training.StartDelay, trainingReset)
+	}()
+
+	var errs []error
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		errs = append(errs, err)
+	}
+	stop()
+
+	// 依次停止接口、定期训练与抓包流水线
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		errs = append(errs, fmt.Errorf("shutdown http server: %v", err))
+	} else {
+		fmt.Println("http server stopped")
+	}
+	<-trainingDone
+	if pipe != nil {
+		errs = append(errs, pipe.shutdown())
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	fmt.Println("程序退出")
+	return nil
+}
+
+func predictionConfig(cfg *configs.Config) prediction.ServiceConfig {
+	return prediction.ServiceConfig{
+		Host: cfg.Prediction.Host,
+		Port: cfg.Prediction.Port,
+	}
+}
+
+// 定期训练任务：延迟delay后开始，训练间隔支持热加载，reset 收到信号后按新间隔重新计时；间隔为0时暂停。
+// ctx取消时返回，进行中的训练请求不会被中断
+func scheduledTraining(ctx context.Context, delay time.Duration, reset <-chan struct{}) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+	for {
+		var timer *time.Timer
+		var tick <-chan time.Time
+		if interval := configs.Get().Training.Interval; interval > 0 {
+			timer = time.NewTimer(interval)
+			tick = timer.C
+		}
+		select {
+		case <-ctx.Done():
+		case <-reset:
+		case <-tick:
+			now := time.Now()
+			if err := service.PredictionClient().Train(service.NewTrainingRequest("", "")); err != nil {
+				fmt.Printf("Scheduled training failed: %v\n", err)
+			} else {
+				fmt.Printf("Scheduled training completed successfully at %v\n", now)
+			}
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
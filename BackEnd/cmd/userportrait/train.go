@@ -0,0 +1,33 @@
+package main
+
+import (
+	"UserPortrait/service"
+	"encoding/json"
+	"fmt"
+)
+
+// 触发一次模型训练并输出训练后的模型状态，代替手工调用预测服务接口
+func runTrain(args []string) error {
+	fs, src := newFlagSet("train", "", "prediction", "training")
+	startDate := fs.String("start", "", "训练数据开始日期(YYYY-MM-DD)，与 -end 同时指定，默认使用过去一个月的数据")
+	endDate := fs.String("end", "", "训练数据结束日期(YYYY-MM-DD)")
+	fs.Parse(args)
+	cfg, err := setup(src, "prediction", "training")
+	if err != nil {
+		return err
+	}
+	service.InitPredictionClient(predictionConfig(cfg))
+
+	req := service.NewTrainingRequest(*startDate, *endDate)
+	fmt.Printf("training on %s ~ %s, epochs %d, batch size %d\n", req.StartDate, req.EndDate, req.Epochs, req.BatchSize)
+	if err := service.PredictionClient().Train(req); err != nil {
+		return err
+	}
+	status, err := service.PredictionClient().GetModelStatus()
+	if err != nil {
+		return fmt.Errorf("training finished, but get model status failed: %v", err)
+	}
+	data, _ := json.MarshalIndent(status, "", "  ")
+	fmt.Println(string(data))
+	return nil
+}
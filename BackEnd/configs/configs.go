@@ -0,0 +1,397 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"path"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config 服务的全部配置，优先级为 默认值 < 配置文件 < 环境变量 < 命令行参数
+// 字段标签：yaml 为配置文件中的键名，env 为环境变量名，flag 为命令行参数名；
+// secret 标记的字段在日志与接口中脱敏，reload 标记的字段支持热加载，其余字段修改后需重启生效
+type Config struct {
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Auth       AuthConfig       `yaml:"auth"`
+	TencentMap TencentMapConfig `yaml:"tencent_map"`
+	Geo        GeoConfig        `yaml:"geo"`
+	Prediction PredictionConfig `yaml:"prediction"`
+	Training   TrainingConfig   `yaml:"training"`
+	Capture    CaptureConfig    `yaml:"capture"`
+	Processor  ProcessorConfig  `yaml:"processor"`
+}
+
+type ServerConfig struct {
+	Addr             string   `yaml:"addr" env:"SERVER_ADDR" flag:"addr"`
+	CORSOrigins      []string `yaml:"cors_origins" env:"CORS_ORIGIN" reload:"true"`
+	AvatarUploadPath string   `yaml:"avatar_upload_path" env:"AVATAR_UPLOAD_PATH" reload:"true"`
+	// ShutdownTimeout 退出时等待进行中的请求完成的最长时间
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// DatabaseConfig 数据库连接配置，均不支持热加载：服务容器持有启动时建立的连接，修改后需重启
+type DatabaseConfig struct {
+	// Driver 为 mysql 或 sqlite
+	Driver string `yaml:"driver" env:"DB_DRIVER" flag:"db-driver"`
+	// DSN 非空时忽略 Host/User/Password/Name；sqlite为数据库文件路径，":memory:" 表示内存数据库
+	DSN             string        `yaml:"dsn" env:"DB_DSN" flag:"db-dsn" secret:"true"`
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+}
+
+type AuthConfig struct {
+	TokenSecret string `yaml:"token_secret" env:"TOKEN_SECRET" secret:"true"`
+	// TokenLifespan 为access token有效期，过期后以刷新token换取新token
+	TokenLifespan        time.Duration `yaml:"token_lifespan" env:"TOKEN_LIFESPAN" reload:"true"`
+	RefreshTokenLifespan time.Duration `yaml:"refresh_token_lifespan" env:"REFRESH_TOKEN_LIFESPAN" reload:"true"`
+	Salt                 string        `yaml:"salt" env:"SALT" secret:"true"`
+	AdminSalt            string        `yaml:"admin_salt" env:"ADMIN_SALT" secret:"true"`
+	// Issuer、Audience 写入token的iss、aud，校验时要求一致
+	Issuer   string `yaml:"issuer" env:"TOKEN_ISSUER"`
+	Audience string `yaml:"audience" env:"TOKEN_AUDIENCE"`
+	// ImpersonationLifespan 管理员代入用户身份的token有效期
+	ImpersonationLifespan time.Duration `yaml:"impersonation_lifespan" env:"IMPERSONATION_LIFESPAN" reload:"true"`
+}
+
+// TencentMapConfig 腾讯地图IP定位接口的key与签名密钥
+type TencentMapConfig struct {
+	Key string `yaml:"key" env:"TENCENT_MAP_KEY" secret:"true" reload:"true"`
+	SK  string `yaml:"sk" env:"TENCENT_SK" secret:"true" reload:"true"`
+}
+
+// GeoConfig IP定位，按 Providers 顺序依次尝试：static 为静态CIDR表（Static 与基站子网），
+// mmdb 为离线MaxMind格式库，tencent 为腾讯地图接口；未配置库文件或key的来源自动跳过。
+// 定位结果按IP缓存，新记录由 Workers 个后台worker异步定位，队列已满或定位出错的记录每隔 BackfillInterval 重新入队
+type GeoConfig struct {
+	Providers      []string         `yaml:"providers" env:"GEO_PROVIDERS" reload:"true"`
+	MMDBPath       string           `yaml:"mmdb_path" env:"GEO_MMDB_PATH" reload:"true"`
+	Language       string           `yaml:"language" env:"GEO_LANGUAGE" reload:"true"`
+	TencentTimeout time.Duration    `yaml:"tencent_timeout" env:"GEO_TENCENT_TIMEOUT" reload:"true"`
+	Static         []StaticLocation `yaml:"static" reload:"true"`
+
+	CacheTTL         time.Duration `yaml:"cache_ttl" env:"GEO_CACHE_TTL" reload:"true"`
+	NegativeTTL      time.Duration `yaml:"negative_ttl" env:"GEO_NEGATIVE_TTL" reload:"true"`
+	CacheSize        int           `yaml:"cache_size" env:"GEO_CACHE_SIZE" reload:"true"`
+	Workers          int           `yaml:"workers" env:"GEO_WORKERS"`
+	QueueDepth       int           `yaml:"queue_depth" env:"GEO_QUEUE_DEPTH"`
+	BackfillInterval time.Duration `yaml:"backfill_interval" env:"GEO_BACKFILL_INTERVAL"`
+}
+
+// StaticLocation 静态CIDR表中的一项，多个网段重叠时取前缀最长者
+type StaticLocation struct {
+	CIDR      string  `yaml:"cidr"`
+	City      string  `yaml:"city"`
+	District  string  `yaml:"district"`
+	Latitude  float32 `yaml:"latitude"`
+	Longitude float32 `yaml:"longitude"`
+}
+
+// PredictionConfig 预测服务地址
+type PredictionConfig struct {
+	Host string `yaml:"host" env:"PREDICTION_HOST" reload:"true"`
+	Port int    `yaml:"port" env:"PREDICTION_PORT" reload:"true"`
+}
+
+// TrainingConfig 定期训练任务，Interval 为0时不启动定期训练
+type TrainingConfig struct {
+	Interval   time.Duration `yaml:"interval" env:"TRAINING_INTERVAL" reload:"true"`
+	StartDelay time.Duration `yaml:"start_delay" env:"TRAINING_START_DELAY"`
+	Epochs     int           `yaml:"epochs" env:"TRAINING_EPOCHS" flag:"epochs" reload:"true"`
+	BatchSize  int           `yaml:"batch_size" env:"TRAINING_BATCH_SIZE" flag:"batch-size" reload:"true"`
+}
+
+// CaptureConfig 实时抓包与回放。网卡名匹配规则支持glob（如 "docker*"），以 "re:" 开头时按正则匹配（如 "re:^veth[0-9a-f]+$"）
+type CaptureConfig struct {
+	// Include 网卡白名单，为空表示不限制；Exclude 网卡黑名单，优先于白名单
+	Include []string `yaml:"include" env:"CAPTURE_INCLUDE" flag:"capture-include"`
+	Exclude []string `yaml:"exclude" env:"CAPTURE_EXCLUDE" flag:"capture-exclude"`
+	// SkipLoopback 跳过libpcap标记为回环的网卡
+	SkipLoopback bool `yaml:"skip_loopback" env:"CAPTURE_SKIP_LOOPBACK"`
+	// 以下为所有网卡的默认抓包参数
+	Filter      string        `yaml:"filter" env:"CAPTURE_FILTER" flag:"capture-filter"`
+	SnapLen     int           `yaml:"snaplen" env:"CAPTURE_SNAPLEN" flag:"snaplen"`
+	Promiscuous bool          `yaml:"promiscuous" env:"CAPTURE_PROMISCUOUS"`
+	Timeout     time.Duration `yaml:"timeout" env:"CAPTURE_TIMEOUT"`
+	// Interfaces 按网卡覆盖默认参数，按顺序取第一个匹配项
+	Interfaces []CaptureInterface `yaml:"interfaces"`
+	// DedupWindow 去重时间窗口，同一帧在窗口内重复出现才会被丢弃；DedupMaxEntries 去重器最多保留的记录数
+	DedupWindow     time.Duration `yaml:"dedup_window" env:"DEDUP_WINDOW" flag:"dedup-window"`
+	DedupMaxEntries int           `yaml:"dedup_max_entries" env:"DEDUP_MAX_ENTRIES"`
+	// ReplaySpeed replay 子命令的回放速度倍率
+	ReplaySpeed float64 `yaml:"replay_speed" env:"REPLAY_SPEED" flag:"replay-speed"`
+	// ExcludeIPs 不统计的地址，数据库主机地址会自动加入
+	ExcludeIPs []string `yaml:"exclude_ips" env:"CAPTURE_EXCLUDE_IPS"`
+}
+
+// CaptureInterface 单个（或一组）网卡的抓包参数，未设置的字段沿用 capture 中的默认值
+type CaptureInterface struct {
+	Match       string `yaml:"match"`
+	Filter      string `yaml:"filter"`
+	SnapLen     int    `yaml:"snaplen"`
+	Promiscuous *bool  `yaml:"promiscuous"`
+}
+
+type ProcessorConfig struct {
+	Workers       int           `yaml:"workers" env:"WORKERS" flag:"workers"`
+	QueueDepth    int           `yaml:"queue_depth" env:"QUEUE_DEPTH" flag:"queue-depth"`
+	QueuePolicy   string        `yaml:"queue_policy" env:"QUEUE_POLICY" flag:"queue-policy"`
+	SampleRate    int           `yaml:"sample_rate" env:"SAMPLE_RATE" flag:"sample-rate"`
+	FlushInterval time.Duration `yaml:"flush_interval" env:"FLUSH_INTERVAL" flag:"flush-interval"`
+	SpillFile     string        `yaml:"spill_file" env:"SPILL_FILE" flag:"spill-file"`
+	// MaxPendingRows 内存中待写库的聚合记录上限，写库持续失败时超出部分被丢弃
+	MaxPendingRows int `yaml:"max_pending_rows" env:"MAX_PENDING_ROWS" flag:"max-pending-rows"`
+	// Debug 逐包与逐连接打印处理结果，仅用于排查问题，开启后处理速度明显下降
+	Debug bool `yaml:"debug" env:"PROCESSOR_DEBUG" flag:"processor-debug" reload:"true"`
+}
+
+// Default 默认配置
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:             "localhost:5000",
+			CORSOrigins:      []string{"http://localhost:3000"},
+			AvatarUploadPath: "avatars",
+			ShutdownTimeout:  10 * time.Second,
+		},
+		Database: DatabaseConfig{
+			Driver:          "mysql",
+			Host:            "127.0.0.1:3306",
+			User:            "root",
+			Name:            "IUPG",
+			MaxOpenConns:    10,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: time.Hour,
+		},
+		Auth: AuthConfig{
+			TokenLifespan:         15 * time.Minute,
+			RefreshTokenLifespan:  30 * 24 * time.Hour,
+			Issuer:                "UserPortrait",
+			Audience:              "UserPortrait-api",
+			ImpersonationLifespan: time.Hour,
+		},
+		Geo: GeoConfig{
+			Providers:      []string{"static", "mmdb", "tencent"},
+			Language:       "zh-CN",
+			TencentTimeout: 3 * time.Second,
+
+			CacheTTL:         24 * time.Hour,
+			NegativeTTL:      time.Hour,
+			CacheSize:        100000,
+			Workers:          2,
+			QueueDepth:       10000,
+			BackfillInterval: 5 * time.Minute,
+		},
+		Prediction: PredictionConfig{
+			Host: "localhost",
+			Port: 8000,
+		},
+		Training: TrainingConfig{
+			Interval:   24 * time.Hour,
+			StartDelay: 10 * time.Second,
+			Epochs:     50,
+			BatchSize:  32,
+		},
+		// 沿用原有抓包参数，并排除回环与常见的容器/虚拟网桥
+		Capture: CaptureConfig{
+			Exclude:         []string{"lo", "any", "docker*", "br-*", "veth*", "virbr*", "cni*", "flannel*", "nflog", "nfqueue", "bluetooth*", "dbus*", "usbmon*"},
+			SkipLoopback:    true,
+			Filter:          "tcp or udp or (ip and (port 80 or port 443))",
+			SnapLen:         1024,
+			Promiscuous:     true,
+			Timeout:         30 * time.Second,
+			DedupWindow:     50 * time.Millisecond,
+			DedupMaxEntries: 1 << 16,
+		},
+		Processor: ProcessorConfig{
+			Workers:       runtime.NumCPU(),
+			QueueDepth:    1024,
+			QueuePolicy:   "block",
+			SampleRate:    10,
+			FlushInterval: 5 * time.Second,
+			SpillFile:     "aggregator.spill.json",
+			// 每条记录约占数百字节
+			MaxPendingRows: 500000,
+		},
+	}
+}
+
+// Validate 检查 sections 中各部分配置是否完整合法，sections 为空时检查全部，返回全部错误
+func (c *Config) Validate(sections ...string) error {
+	checks := []struct {
+		section  string
+		validate func() error
+	}{
+		{"server", c.Server.Validate},
+		{"database", c.Database.Validate},
+		{"auth", c.Auth.Validate},
+		{"geo", c.Geo.Validate},
+		{"prediction", c.Prediction.Validate},
+		{"training", c.Training.Validate},
+		{"capture", c.Capture.Validate},
+		{"processor", c.Processor.Validate},
+	}
+	var errs []error
+	for _, check := range checks {
+		if len(sections) == 0 || slices.Contains(sections, check.section) {
+			errs = append(errs, check.validate())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 收集不满足条件的检查项
+type checker []error
+
+func (c *checker) check(ok bool, format string, args ...any) {
+	if !ok {
+		*c = append(*c, fmt.Errorf(format, args...))
+	}
+}
+
+func (c checker) err() error {
+	return errors.Join(c...)
+}
+
+func (s ServerConfig) Validate() error {
+	var c checker
+	_, _, err := net.SplitHostPort(s.Addr)
+	c.check(err == nil, "server.addr: %v", err)
+	c.check(len(s.CORSOrigins) > 0, "server.cors_origins is empty")
+	c.check(s.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	return c.err()
+}
+
+func (a AuthConfig) Validate() error {
+	var c checker
+	c.check(a.TokenSecret != "", "auth.token_secret is empty")
+	c.check(a.Salt != "", "auth.salt is empty")
+	c.check(a.AdminSalt != "", "auth.admin_salt is empty")
+	c.check(a.TokenLifespan > 0, "auth.token_lifespan must be positive")
+	c.check(a.RefreshTokenLifespan > a.TokenLifespan, "auth.refresh_token_lifespan must be longer than auth.token_lifespan")
+	c.check(a.Issuer != "", "auth.issuer is empty")
+	c.check(a.Audience != "", "auth.audience is empty")
+	c.check(a.ImpersonationLifespan > 0, "auth.impersonation_lifespan must be positive")
+	return c.err()
+}
+
+func (g GeoConfig) Validate() error {
+	var c checker
+	for _, provider := range g.Providers {
+		c.check(provider == "static" || provider == "mmdb" || provider == "tencent", "geo.providers: unknown provider %q", provider)
+	}
+	c.check(g.TencentTimeout > 0, "geo.tencent_timeout must be positive")
+	c.check(g.CacheTTL > 0, "geo.cache_ttl must be positive")
+	c.check(g.NegativeTTL >= 0, "geo.negative_ttl must not be negative")
+	c.check(g.CacheSize > 0, "geo.cache_size must be positive")
+	c.check(g.Workers > 0, "geo.workers must be positive")
+	c.check(g.QueueDepth > 0, "geo.queue_depth must be positive")
+	c.check(g.BackfillInterval > 0, "geo.backfill_interval must be positive")
+	for _, entry := range g.Static {
+		_, err := netip.ParsePrefix(entry.CIDR)
+		c.check(err == nil, "geo.static: invalid cidr %q", entry.CIDR)
+		c.check(entry.Latitude >= -90 && entry.Latitude <= 90 && entry.Longitude >= -180 && entry.Longitude <= 180,
+			"geo.static: invalid coordinate for %s", entry.CIDR)
+	}
+	return c.err()
+}
+
+func (p PredictionConfig) Validate() error {
+	var c checker
+	c.check(p.Host != "", "prediction.host is empty")
+	c.check(p.Port > 0 && p.Port < 65536, "prediction.port %d out of range", p.Port)
+	return c.err()
+}
+
+func (t TrainingConfig) Validate() error {
+	var c checker
+	c.check(t.Interval >= 0, "training.interval must not be negative")
+	c.check(t.StartDelay >= 0, "training.start_delay must not be negative")
+	c.check(t.Epochs > 0, "training.epochs must be positive")
+	c.check(t.BatchSize > 0, "training.batch_size must be positive")
+	return c.err()
+}
+
+func (cc CaptureConfig) Validate() error {
+	var c checker
+	for _, pattern := range append(append([]string{}, cc.Include...), cc.Exclude...) {
+		c.check(validInterfacePattern(pattern), "capture: bad interface pattern %q", pattern)
+	}
+	c.check(cc.SnapLen > 0 && cc.SnapLen <= math.MaxInt32, "capture.snaplen %d out of range", cc.SnapLen)
+	c.check(cc.Timeout > 0, "capture.timeout must be positive")
+	for _, iface := range cc.Interfaces {
+		c.check(iface.Match != "", "capture.interfaces: entry without match")
+		c.check(iface.Match == "" || validInterfacePattern(iface.Match), "capture.interfaces: bad pattern %q", iface.Match)
+		c.check(iface.SnapLen >= 0 && iface.SnapLen <= math.MaxInt32, "capture.interfaces: snaplen %d out of range for %s", iface.SnapLen, iface.Match)
+	}
+	c.check(cc.DedupWindow >= 0, "capture.dedup_window must not be negative")
+	c.check(cc.DedupMaxEntries > 0, "capture.dedup_max_entries must be positive")
+	c.check(cc.ReplaySpeed >= 0, "capture.replay_speed must not be negative")
+	for _, ip := range cc.ExcludeIPs {
+		c.check(net.ParseIP(ip) != nil, "capture.exclude_ips: invalid ip %q", ip)
+	}
+	return c.err()
+}
+
+// 网卡名匹配规则：glob，或以 "re:" 开头的正则
+func validInterfacePattern(pattern string) bool {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		_, err := regexp.Compile(expr)
+		return err == nil
+	}
+	_, err := path.Match(pattern, "")
+	return err == nil
+}
+
+func (p ProcessorConfig) Validate() error {
+	var c checker
+	c.check(p.Workers > 0, "processor.workers must be positive")
+	c.check(p.QueueDepth > 0, "processor.queue_depth must be positive")
+	c.check(p.SampleRate > 0, "processor.sample_rate must be positive")
+	c.check(p.FlushInterval > 0, "processor.flush_interval must be positive")
+	c.check(p.MaxPendingRows > 0, "processor.max_pending_rows must be positive")
+	return c.err()
+}
+
+func (d DatabaseConfig) Validate() error {
+	var c checker
+	switch d.Driver {
+	case "mysql":
+		c.check(d.DSN != "" || d.Host != "", "database: host or dsn is required for mysql")
+	case "sqlite":
+	default:
+		c.check(false, "database.driver: unsupported driver %q", d.Driver)
+	}
+	c.check(d.MaxOpenConns > 0, "database.max_open_conns must be positive")
+	c.check(d.MaxIdleConns >= 0, "database.max_idle_conns must not be negative")
+	c.check(d.ConnMaxLifetime >= 0, "database.conn_max_lifetime must not be negative")
+	return c.err()
+}
+
+var current atomic.Pointer[Config]
+
+// Get 返回当前生效的配置，未初始化时返回默认配置；返回值只读，不可修改
+func Get() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return Default()
+}
+
+// Set 替换当前配置，不触发热加载回调
+func Set(cfg *Config) {
+	current.Store(cfg)
+}
@@ -0,0 +1,231 @@
+package configs
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Source 配置来源：配置文件路径与命令行中显式指定的参数
+type Source struct {
+	File  string
+	flags map[string]string
+}
+
+// 命令行参数说明，参数名与 Config 字段的 flag 标签对应
+var flagUsage = map[string]string{
+	"addr":             "HTTP服务监听地址",
+	"db-driver":        "数据库驱动：mysql 或 sqlite",
+	"db-dsn":           "数据库DSN，sqlite为数据库文件路径或 :memory:",
+	"capture-include":  "抓包网卡白名单，逗号分隔，支持glob与 re: 开头的正则，为空表示不限制",
+	"capture-exclude":  "抓包网卡黑名单，逗号分隔，优先于白名单",
+	"capture-filter":   "默认BPF过滤器",
+	"snaplen":          "默认单包最大抓取字节数",
+	"dedup-window":     "去重时间窗口，同一帧在窗口内重复出现时丢弃",
+	"replay-speed":     "回放速度倍率：0为尽快回放，1为实时回放，N为N倍速",
+	"workers":          "数据包处理worker数，同一连接的数据包固定由同一worker处理",
+	"queue-depth":      "每个worker的队列长度",
+	"queue-policy":     "队列已满时的策略：block阻塞、drop丢弃、sample抽样保留",
+	"sample-rate":      "sample策略下队列已满时每N个包保留1个",
+	"flush-interval":   "内存聚合数据的写库间隔",
+	"spill-file":       "退出时未能写库的聚合数据保存文件，下次启动时自动载入，写库成功后删除",
+	"max-pending-rows": "内存中待写库的聚合记录上限，写库持续失败时超出部分被丢弃",
+	"processor-debug":  "逐包与逐连接打印处理结果，仅用于排查问题",
+	"epochs":           "模型训练轮数",
+	"batch-size":       "模型训练批大小",
+}
+
+// BindFlags 在fs上注册 -config 以及 sections 中各配置项对应的命令行参数，sections 为空时注册全部；
+// 只有命令行中显式指定的参数会覆盖配置文件与环境变量
+func BindFlags(fs *flag.FlagSet, sections ...string) *Source {
+	src := &Source{File: os.Getenv("CONFIG_FILE"), flags: map[string]string{}}
+	fs.StringVar(&src.File, "config", src.File, "配置文件路径，扩展名为 .toml 时按TOML解析，其余按YAML解析；也可由环境变量 CONFIG_FILE 指定")
+	for _, f := range fields(Default()) {
+		name := f.tag.Get("flag")
+		if name == "" || !inSections(f.path, sections) {
+			continue
+		}
+		usage := fmt.Sprintf("%s (默认 %s，配置项 %s)", flagUsage[name], formatValue(f.value), f.path)
+		fs.Func(name, usage, func(s string) error {
+			if err := setValue(reflect.New(f.value.Type()).Elem(), s); err != nil {
+				return err
+			}
+			src.flags[name] = s
+			return nil
+		})
+	}
+	return src
+}
+
+// Load 依次合并默认值、配置文件、环境变量与命令行参数，不做校验
+func Load(src *Source) (*Config, error) {
+	cfg := Default()
+	if src == nil {
+		src = &Source{}
+	}
+	if src.File != "" {
+		data, err := os.ReadFile(src.File)
+		if err != nil {
+			return nil, fmt.Errorf("read config file failed: %v", err)
+		}
+		if err := decodeFile(src.File, data, cfg); err != nil {
+			return nil, fmt.Errorf("parse config file %s failed: %v", src.File, err)
+		}
+	}
+	for _, f := range fields(cfg) {
+		if name := f.tag.Get("env"); name != "" {
+			if s, ok := os.LookupEnv(name); ok {
+				if err := setValue(f.value, s); err != nil {
+					return nil, fmt.Errorf("env %s: %v", name, err)
+				}
+			}
+		}
+		if name := f.tag.Get("flag"); name != "" {
+			if s, ok := src.flags[name]; ok {
+				if err := setValue(f.value, s); err != nil {
+					return nil, fmt.Errorf("flag -%s: %v", name, err)
+				}
+			}
+		}
+	}
+	return cfg, nil
+}
+
+// 按扩展名解析配置文件。TOML先解析为通用结构再转为YAML，与YAML配置共用同一套键名与校验
+func decodeFile(path string, data []byte, cfg *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if len(doc) == 0 {
+			return nil
+		}
+		var err error
+		if data, err = yaml.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	// 拒绝未知键，避免拼写错误的配置项被静默忽略
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// field Config 中的一个配置项，path 形如 database.dsn
+type field struct {
+	path  string
+	value reflect.Value
+	tag   reflect.StructTag
+}
+
+// 按声明顺序列出全部配置项，value 可直接写入cfg
+func fields(cfg *Config) []field {
+	var out []field
+	sections := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < sections.NumField(); i++ {
+		section := sections.Field(i)
+		prefix := yamlName(sections.Type().Field(i))
+		for j := 0; j < section.NumField(); j++ {
+			sf := section.Type().Field(j)
+			out = append(out, field{
+				path:  prefix + "." + yamlName(sf),
+				value: section.Field(j),
+				tag:   sf.Tag,
+			})
+		}
+	}
+	return out
+}
+
+func yamlName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("yaml"), ",")
+	return name
+}
+
+func inSections(path string, sections []string) bool {
+	if len(sections) == 0 {
+		return true
+	}
+	for _, s := range sections {
+		if strings.HasPrefix(path, s+".") {
+			return true
+		}
+	}
+	return false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// 将环境变量或命令行中的字符串写入配置项，切片以逗号分隔
+func setValue(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", v.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func formatValue(v reflect.Value) string {
+	switch x := v.Interface().(type) {
+	case []string:
+		return strconv.Quote(strings.Join(x, ","))
+	case string:
+		return strconv.Quote(x)
+	default:
+		return fmt.Sprint(x)
+	}
+}
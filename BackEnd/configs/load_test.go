@@ -0,0 +1,241 @@
+package configs
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeConfig(t, "config.yaml", `
+server:
+  addr: file:1
+  cors_origins: [http://file]
+database:
+  driver: sqlite
+  dsn: file.db
+processor:
+  workers: 3
+  flush_interval: 30s
+`)
+	tomlFile := writeConfig(t, "config.toml", `
+[server]
+addr = "file:1"
+cors_origins = ["http://file"]
+
+[database]
+driver = "sqlite"
+dsn = "file.db"
+
+[processor]
+workers = 3
+flush_interval = "30s"
+`)
+	tests := []struct {
+		name      string
+		file      string
+		env       map[string]string
+		args      []string
+		wantAddr  string
+		wantDSN   string
+		wantCORS  []string
+		wantWork  int
+		wantFlush time.Duration
+	}{
+		{
+			name:      "defaults",
+			wantAddr:  "localhost:5000",
+			wantCORS:  []string{"http://localhost:3000"},
+			wantWork:  Default().Processor.Workers,
+			wantFlush: Default().Processor.FlushInterval,
+		},
+		{
+			name:      "yaml file over defaults",
+			file:      yamlFile,
+			wantAddr:  "file:1",
+			wantDSN:   "file.db",
+			wantCORS:  []string{"http://file"},
+			wantWork:  3,
+			wantFlush: 30 * time.Second,
+		},
+		{
+			name:      "toml file by extension",
+			file:      tomlFile,
+			wantAddr:  "file:1",
+			wantDSN:   "file.db",
+			wantCORS:  []string{"http://file"},
+			wantWork:  3,
+			wantFlush: 30 * time.Second,
+		},
+		{
+			name:      "env over file",
+			file:      yamlFile,
+			env:       map[string]string{"SERVER_ADDR": "env:2", "DB_DSN": "env.db", "CORS_ORIGIN": "http://a, http://b"},
+			wantAddr:  "env:2",
+			wantDSN:   "env.db",
+			wantCORS:  []string{"http://a", "http://b"},
+			wantWork:  3,
+			wantFlush: 30 * time.Second,
+		},
+		{
+			name:      "flags over env",
+			file:      tomlFile,
+			env:       map[string]string{"SERVER_ADDR": "env:2", "DB_DSN": "env.db"},
+			args:      []string{"-addr", "flag:3", "-workers", "5", "-flush-interval", "1m"},
+			wantAddr:  "flag:3",
+			wantDSN:   "env.db",
+			wantCORS:  []string{"http://file"},
+			wantWork:  5,
+			wantFlush: time.Minute,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", tt.file)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			src := BindFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := Load(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != tt.wantAddr || cfg.Database.DSN != tt.wantDSN ||
+				strings.Join(cfg.Server.CORSOrigins, ",") != strings.Join(tt.wantCORS, ",") ||
+				cfg.Processor.Workers != tt.wantWork || cfg.Processor.FlushInterval != tt.wantFlush {
+				t.Fatalf("addr %q dsn %q cors %v workers %d flush %v, want %q %q %v %d %v",
+					cfg.Server.Addr, cfg.Database.DSN, cfg.Server.CORSOrigins, cfg.Processor.Workers, cfg.Processor.FlushInterval,
+					tt.wantAddr, tt.wantDSN, tt.wantCORS, tt.wantWork, tt.wantFlush)
+			}
+		})
+	}
+}
+
+func TestLoadCaptureSection(t *testing.T) {
+	file := writeConfig(t, "config.yaml", `
+capture:
+  include: [eth*, "re:^wl"]
+  snaplen: 512
+  dedup_window: 100ms
+  interfaces:
+    - match: eth1
+      filter: tcp port 443
+      promiscuous: false
+`)
+	t.Setenv("CAPTURE_EXCLUDE", "lo, docker*")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	src := BindFlags(fs, "capture")
+	if err := fs.Parse([]string{"-config", file, "-capture-filter", "udp"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := cfg.Capture
+	if strings.Join(cc.Include, ",") != "eth*,re:^wl" || strings.Join(cc.Exclude, ",") != "lo,docker*" ||
+		cc.Filter != "udp" || cc.SnapLen != 512 || cc.DedupWindow != 100*time.Millisecond {
+		t.Fatalf("capture %+v", cc)
+	}
+	// 文件中未出现的项保留默认值
+	if !cc.Promiscuous || cc.Timeout != 30*time.Second || cc.DedupMaxEntries != 1<<16 {
+		t.Fatalf("capture defaults lost: %+v", cc)
+	}
+	if len(cc.Interfaces) != 1 || cc.Interfaces[0].Match != "eth1" || cc.Interfaces[0].Promiscuous == nil || *cc.Interfaces[0].Promiscuous {
+		t.Fatalf("capture.interfaces %+v", cc.Interfaces)
+	}
+	if err := cc.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCaptureValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cc *CaptureConfig)
+	}{
+		{"bad glob", func(cc *CaptureConfig) { cc.Include = []string{"eth["} }},
+		{"bad regexp", func(cc *CaptureConfig) { cc.Exclude = []string{"re:("} }},
+		{"zero snaplen", func(cc *CaptureConfig) { cc.SnapLen = 0 }},
+		{"zero timeout", func(cc *CaptureConfig) { cc.Timeout = 0 }},
+		{"interface without match", func(cc *CaptureConfig) { cc.Interfaces = []CaptureInterface{{Filter: "tcp"}} }},
+		{"interface bad pattern", func(cc *CaptureConfig) { cc.Interfaces = []CaptureInterface{{Match: "re:["}} }},
+		{"interface negative snaplen", func(cc *CaptureConfig) { cc.Interfaces = []CaptureInterface{{Match: "eth0", SnapLen: -1}} }},
+		{"negative dedup window", func(cc *CaptureConfig) { cc.DedupWindow = -time.Second }},
+		{"zero dedup entries", func(cc *CaptureConfig) { cc.DedupMaxEntries = 0 }},
+	}
+	if err := Default().Capture.Validate(); err != nil {
+		t.Fatalf("default capture config invalid: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cc := Default().Capture
+			tt.modify(&cc)
+			if err := cc.Validate(); err == nil {
+				t.Fatal("invalid capture config accepted")
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"yaml", "config.yaml", "server:\n  adr: x\n"},
+		{"toml", "config.toml", "[server]\nadr = \"x\"\n"},
+		{"toml unknown section", "config.toml", "[sever]\naddr = \"x\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(&Source{File: writeConfig(t, tt.file, tt.content)})
+			if err == nil {
+				t.Fatal("unknown key accepted")
+			}
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "db-pass"
+	cfg.Database.DSN = "root:db-pass@tcp(127.0.0.1)/x"
+	cfg.Auth.TokenSecret = "token-secret"
+	cfg.TencentMap.Key = ""
+
+	out := cfg.String()
+	for _, secret := range []string{"db-pass", "token-secret"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("secret %q in output:\n%s", secret, out)
+		}
+	}
+	redacted := cfg.Redacted()
+	if redacted.Database.Password != redactedValue || redacted.Auth.TokenSecret != redactedValue {
+		t.Errorf("secrets not redacted: %+v %+v", redacted.Database, redacted.Auth)
+	}
+	// 空值保持为空，便于看出未配置
+	if redacted.TencentMap.Key != "" {
+		t.Errorf("empty secret redacted to %q", redacted.TencentMap.Key)
+	}
+	if cfg.Database.Password != "db-pass" || cfg.Auth.TokenSecret != "token-secret" {
+		t.Error("Redacted modified the original config")
+	}
+}
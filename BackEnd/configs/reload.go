@@ -0,0 +1,110 @@
+package configs
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redactedValue = "******"
+
+var (
+	reloadMu sync.Mutex
+	source   *Source
+	sections []string
+	hooks    []func(old *Config, new *Config)
+)
+
+// Setup 加载配置并校验 validate 中的各部分（为空时校验全部），成功后设为当前配置，
+// 并记录配置来源供 Reload 使用
+func Setup(src *Source, validate ...string) (*Config, error) {
+	cfg, err := Load(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(validate...); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%v", err)
+	}
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	source, sections = src, validate
+	Set(cfg)
+	return cfg, nil
+}
+
+// OnReload 注册热加载回调，仅在有配置项被更新时调用
+func OnReload(fn func(old *Config, new *Config)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+// ReloadResult 热加载结果：Applied 为已生效的配置项，Ignored 为已修改但需重启才能生效的配置项
+type ReloadResult struct {
+	Applied []string `json:"applied"`
+	Ignored []string `json:"ignored"`
+}
+
+// Reload 按 Setup 时的来源重新加载配置；新配置校验失败时保持原配置不变。
+// 只更新带 reload 标签的配置项，其余配置项的修改记入 Ignored
+func Reload() (ReloadResult, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	var result ReloadResult
+	loaded, err := Load(source)
+	if err != nil {
+		return result, err
+	}
+	if err := loaded.Validate(sections...); err != nil {
+		return result, fmt.Errorf("invalid config:\n%v", err)
+	}
+
+	old := Get()
+	next := *old
+	oldFields, nextFields, loadedFields := fields(old), fields(&next), fields(loaded)
+	for i, f := range loadedFields {
+		if reflect.DeepEqual(f.value.Interface(), oldFields[i].value.Interface()) {
+			continue
+		}
+		if f.tag.Get("reload") == "true" {
+			nextFields[i].value.Set(f.value)
+			result.Applied = append(result.Applied, f.path)
+		} else {
+			result.Ignored = append(result.Ignored, f.path)
+		}
+	}
+	if len(result.Ignored) > 0 {
+		fmt.Printf("config reload: %v changed but require restart\n", result.Ignored)
+	}
+	if len(result.Applied) == 0 {
+		return result, nil
+	}
+	Set(&next)
+	fmt.Printf("config reload: applied %v\n", result.Applied)
+	for _, fn := range hooks {
+		fn(old, &next)
+	}
+	return result, nil
+}
+
+// Redacted 返回将 secret 配置项替换为占位符后的副本，用于日志与接口输出
+func (c *Config) Redacted() *Config {
+	out := *c
+	for _, f := range fields(&out) {
+		if f.tag.Get("secret") == "true" && f.value.String() != "" {
+			f.value.SetString(redactedValue)
+		}
+	}
+	return &out
+}
+
+// String 以YAML格式输出脱敏后的配置
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return fmt.Sprintf("marshal config failed: %v", err)
+	}
+	return string(data)
+}
@@ -6,17 +6,8 @@ var (
 		17: "16~17", 18: "17~18", 19: "18~19", 20: "19~20", 21: "20~21", 22: "21~22", 23: "22~23", 24: "23~24"}
 )
 
-var (
-	UniverseChannel = make(chan Universe, 100)
-	StationChannel  = make(chan BaseStation, 100)
-)
-
-var (
-	StationLocation1 = []float32{39.9042, 116.4074}
-	StationLocation2 = []float32{39.9042, 116.4074}
-	StationLocation3 = []float32{39.9042, 116.4074}
-	StationLocation4 = []float32{39.9042, 116.4074}
-)
+// UnassignedStation 未匹配任何归属规则的流量所记入的基站ID
+const UnassignedStation uint = 0
 
 // 终端字体颜色
 const (
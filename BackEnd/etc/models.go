@@ -2,66 +2,140 @@
 
 package etc
 
+import "time"
+
 //***************数据库表结构***************//
 
 type Userinfo struct {
 	ID       uint       `gorm:"primary_key;auto_increment" json:"id"`
-	Username string     `gorm:"type:varchar(16)" json:"username"`
+	Username string     `gorm:"type:varchar(16);index" json:"username"`
 	Password string     `gorm:"type:varchar(255)" json:"password"`
-	MacInfo  string     `gorm:"type:varchar(32)" json:"mac_info"`
+	MacInfo  string     `gorm:"type:varchar(32);index" json:"mac_info"`
 	Users    []Universe `gorm:"ForeignKey:UserID"`
 }
 
 type Admininfo struct {
 	ID        uint   `gorm:"primary_key;auto_increment" json:"id"`
-	Adminname string `gorm:"type:varchar(16)" json:"adminname"`
+	Adminname string `gorm:"type:varchar(16);uniqueIndex" json:"adminname"`
 	Password  string `gorm:"type:varchar(255)" json:"password"`
 }
 
 type ContentType struct {
-	ID      uint       `gorm:"primary_key;auto_increment" json:"id"`
-	Content string     `gorm:"type:varchar(255)" json:"content-type"`
-	Count   uint       `gorm:"type:int;default:1" json:"count"`
-	Periods []Universe `gorm:"ForeignKey:ContentID;"`
+	ID      uint        `gorm:"primary_key;auto_increment" json:"id"`
+	Content string      `gorm:"type:varchar(255)" json:"content-type"`
+	Count   uint        `gorm:"type:int;default:1" json:"count"`
+	Users   []Interests `gorm:"ForeignKey:ContentID;"`
 }
 
+// Universe 以 (station_id, user_id, ip, date, period_id) 唯一确定一条记录，写入时按该唯一键累加
+// 位置信息在记录插入后异步补充，LocSource 为给出位置的来源，LocPending 表示尚未定位；
+// RemoteIp 为该时段首个公网对端地址，Ip 为私有等特殊地址时用于定位
+
 type Universe struct {
-	UserID    uint     `gorm:"primary_key;" json:"user_id"`
-	Ip        string   `gorm:"type:char" json:"ip"`
-	District  string   `gorm:"type:varchar" json:"district"`
-	City      string   `gorm:"type:varchar" json:"city"`
-	Latitude  float32  `gorm:"type:float" json:"latitude"`
-	Longitude float32  `gorm:"type:float" json:"longitude"`
-	PeriodID  uint     `json:"period_id"`
-	Date      string   `gorm:"type:char;" json:"date"`
-	Count     uint     `gorm:"default:1" json:"count"`
-	Flow      uint     `gorm:"default:0" json:"flow"`
-	Latency   uint     `gorm:"default:0" json:"latency"`
-	ErrCount  uint     `gorm:"default:0" json:"err_count"`
-	User      Userinfo `gorm:"ForeignKey:UserID;references:ID"`
+	StationID uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1" json:"station_id"`
+	UserID    uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1" json:"user_id"`
+	Ip        string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3" json:"ip"`
+	District  string  `gorm:"type:varchar(64)" json:"district"`
+	City      string  `gorm:"type:varchar(64)" json:"city"`
+	Latitude  float32 `gorm:"type:float" json:"latitude"`
+	Longitude float32 `gorm:"type:float" json:"longitude"`
+	LocSource string  `gorm:"type:varchar(16);default:'';index:idx_universe_loc_source" json:"loc_source"`
+	RemoteIp  string  `gorm:"type:varchar(45);default:''" json:"remote_ip"`
+	PeriodID  uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5" json:"period_id"`
+	Date      string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2" json:"date"`
+	Count     uint    `gorm:"default:1" json:"count"`
+	Flow      uint    `gorm:"default:0" json:"flow"`
+	Latency   uint    `gorm:"default:0" json:"latency"`
+	ErrCount  uint    `gorm:"default:0" json:"err_count"`
+	// DataSegments 为TCP数据段数，ErrCount 占其比例即丢包率
+	DataSegments uint `gorm:"default:0" json:"data_segments"`
+	// LatencySamples 为参与时延平均的数据包数
+	LatencySamples uint     `gorm:"default:0" json:"latency_samples"`
+	User           Userinfo `gorm:"ForeignKey:UserID;references:ID"`
 }
 
 type Interests struct {
-	UserID    uint `gorm:"primary_key" json:"user_id"`
-	ContentID uint `gorm:"primary_key" json:"ct_id"`
+	UserID    uint `gorm:"primary_key;autoIncrement:false" json:"user_id"`
+	ContentID uint `gorm:"primary_key;autoIncrement:false" json:"ct_id"`
 	Count     uint `gorm:"type:int;default:1" json:"count"`
 }
 
+// Score 每个用户每天一条评分
+
 type Score struct {
-	UserID uint     `gorm:"primary_key" json:"user_id"`
+	UserID uint     `gorm:"primary_key;autoIncrement:false" json:"user_id"`
 	Score  float32  `gorm:"type:float;default:0" json:"score"`
-	Date   string   `gorm:"type:char;" json:"date"`
+	Date   string   `gorm:"type:char(10);primary_key;index" json:"date"`
 	User   Userinfo `gorm:"ForeignKey:UserID;references:ID"`
 }
 
+// Station 基站信息，Interfaces、Subnets、VLANs、GatewayMACs 同时作为流量归属规则，任一命中即归属该基站
+// ID 0 保留给未匹配任何规则的流量
+
+type Station struct {
+	ID          uint     `gorm:"primary_key;auto_increment" json:"id"`
+	Name        string   `gorm:"type:varchar(64);uniqueIndex" json:"name"`
+	Latitude    float32  `gorm:"type:float" json:"latitude"`
+	Longitude   float32  `gorm:"type:float" json:"longitude"`
+	Radius      float32  `gorm:"type:float;default:0" json:"radius"`
+	Interfaces  []string `gorm:"type:text;serializer:json" json:"interfaces"`
+	Subnets     []string `gorm:"type:text;serializer:json" json:"subnets"`
+	VLANs       []uint16 `gorm:"column:vlans;type:text;serializer:json" json:"vlans"`
+	GatewayMACs []string `gorm:"column:gateway_macs;type:text;serializer:json" json:"gateway_macs"`
+}
+
+// Universe.LocSource 的取值，其余取值为定位来源名称
+const (
+	LocPending = "pending" // 尚未定位
+	LocUnknown = "unknown" // 所有来源均无法定位
+	LocStation = "station" // 基站子网内的地址或特殊地址，使用基站的坐标
+	LocRemote  = "remote"  // 特殊地址，使用对端地址的位置
+)
+
+// BaseStation 以 (station_id, date, period_id) 唯一确定一条记录，写入时按该唯一键累加
+
 type BaseStation struct {
+	StationID  uint    `gorm:"uniqueIndex:idx_station_slot,priority:1" json:"station_id"`
 	ConnCount  uint    `gorm:"default:1" json:"conn_count"`
 	ErrCount   uint    `gorm:"default:0" json:"err_count"`
-	Date       string  `json:"date"`
-	PeriodID   uint    `json:"period_id"`
+	Date       string  `gorm:"type:char(10);uniqueIndex:idx_station_slot,priority:2" json:"date"`
+	PeriodID   uint    `gorm:"uniqueIndex:idx_station_slot,priority:3" json:"period_id"`
 	TotalFlow  uint    `json:"total_flow"`
 	AveLatency uint    `json:"ave_latency"`
 	LossRate   float32 `json:"loss_rate"`
+	// DataSegments 为TCP数据段数，LossRate = ErrCount / DataSegments
+	DataSegments uint `gorm:"default:0" json:"data_segments"`
+	// LatencySamples 为参与时延平均的数据包数
+	LatencySamples uint `gorm:"default:0" json:"latency_samples"`
+}
+
+// RefreshToken 服务端保存的刷新token，只保存哈希；每次刷新时作废旧token并在同一 Family 内签发新token，
+// 已作废的token被再次使用时视为泄露，整个 Family 一并作废
+
+type RefreshToken struct {
+	ID        uint      `gorm:"primary_key;auto_increment" json:"id"`
+	TokenHash string    `gorm:"type:char(64);uniqueIndex" json:"-"`
+	Family    string    `gorm:"type:char(32);index" json:"family"`
+	Role      string    `gorm:"type:varchar(8);index:idx_refresh_subject,priority:1" json:"role"`
+	SubjectID uint      `gorm:"index:idx_refresh_subject,priority:2" json:"subject_id"`
+	Revoked   bool      `gorm:"default:false" json:"revoked"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevokedToken 已吊销且尚未过期的access token，过期后可清除
+
+type RevokedToken struct {
+	JTI       string    `gorm:"column:jti;type:char(32);primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"`
+}
+
+// TokenRevocation 该用户或管理员在 RevokedBefore 之前签发的access token均已吊销，用于退出全部登录与重置密码
+
+type TokenRevocation struct {
+	Role          string    `gorm:"type:varchar(8);primaryKey" json:"role"`
+	SubjectID     uint      `gorm:"primaryKey;autoIncrement:false" json:"subject_id"`
+	RevokedBefore time.Time `json:"revoked_before"`
 }
 
 type UserNetStatus struct {
@@ -84,10 +158,18 @@ func (uni *Universe) TableName() string { return "universe" }
 
 func (itr *Interests) TableName() string { return "content2user" }
 
-func (sc *Score) TableName() string { return "score" }
+func (sc *Score) TableName() string { return "network_score" }
 
 func (bs *BaseStation) TableName() string { return "base_station" }
 
+func (st *Station) TableName() string { return "stations" }
+
+func (rt *RefreshToken) TableName() string { return "refresh_token" }
+
+func (rt *RevokedToken) TableName() string { return "revoked_token" }
+
+func (tr *TokenRevocation) TableName() string { return "token_revocation" }
+
 //***************接口用json结构体***************//
 // 查询每日平均分结构体
 
@@ -1,7 +1,6 @@
 package functions
 
 import (
-	"UserPortrait/etc"
 	"crypto/md5"
 	"fmt"
 	"math"
@@ -11,51 +10,6 @@ import (
 	"time"
 )
 
-// 选择基站或universe表名
-
-func ChooseTable(station_id uint, MODE string) string {
-	var tablename string
-	if MODE == "universe" {
-		switch station_id {
-		case 1:
-			tablename = "universe1"
-		case 2:
-			tablename = "universe2"
-		case 3:
-			tablename = "universe3"
-		case 4:
-			tablename = "universe4"
-		}
-	} else if MODE == "base_station" {
-		switch station_id {
-		case 1:
-			tablename = "base_station1"
-		case 2:
-			tablename = "base_station2"
-		case 3:
-			tablename = "base_station3"
-		case 4:
-			tablename = "base_station4"
-		}
-	}
-	return tablename
-}
-
-func ChooseStationLoc(station_id uint) (float32, float32) {
-	switch station_id {
-	case 1:
-		return etc.StationLocation1[0], etc.StationLocation1[1]
-	case 2:
-		return etc.StationLocation2[0], etc.StationLocation2[1]
-	case 3:
-		return etc.StationLocation3[0], etc.StationLocation3[1]
-	case 4:
-		return etc.StationLocation4[0], etc.StationLocation4[1]
-	default:
-		return 0, 0
-	}
-}
-
 //获取日期和时段编码
 
 func GetPeriod(t string) (string, uint, error) {
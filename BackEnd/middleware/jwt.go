@@ -4,29 +4,39 @@ import (
 	"UserPortrait/token"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"slices"
 )
 
-// 登录状态token验证中间件
-func UserJwtAuthentication() gin.HandlerFunc {
+// JwtAuthentication 登录状态token验证中间件：token无效时返回401，角色不在roles中（roles为空时不限）时返回403；
+// 验证通过后将调用方写入gin上下文，由 token.GetPrincipal 获取
+func JwtAuthentication(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		err := token.UserTokenValid(c)
+		principal, err := token.Authenticate(c)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": err.Error(),
 			})
+			return
+		}
+		token.SetPrincipal(c, principal)
+		if !allowed(principal, roles) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "permission denied",
+			})
+			return
 		}
 		c.Next()
 	}
 }
 
+func UserJwtAuthentication() gin.HandlerFunc {
+	return JwtAuthentication(token.RoleUser)
+}
+
 func AdminJwtAuthentication() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		err := token.AdminTokenValid(c)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": err.Error(),
-			})
-		}
-		c.Next()
-	}
+	return JwtAuthentication(token.RoleAdmin)
+}
+
+func allowed(principal token.Principal, roles []string) bool {
+	return len(roles) == 0 || slices.Contains(roles, principal.Role)
 }
@@ -36,7 +36,7 @@ class DataLoader:
         with self.connection.cursor() as cursor:
             query = """
                 SELECT *
-                FROM universe1 
+                FROM universe 
                 WHERE date BETWEEN %s AND %s
             """
             params = [start_date, end_date]
@@ -59,16 +59,25 @@ class DataLoader:
         Returns:
             List[Dict]: 基站记录列表
         """
-        table_name = f"base_station{station_id}"
         with self.connection.cursor() as cursor:
-            query = f"""
+            query = """
                 SELECT conn_count, err_count, date, period_id, 
                        total_flow, ave_latency, loss_rate
-                FROM {table_name}
-                WHERE date BETWEEN %s AND %s
+                FROM base_station
+                WHERE station_id = %s AND date BETWEEN %s AND %s
             """
-            cursor.execute(query, [start_date, end_date])
+            cursor.execute(query, [station_id, start_date, end_date])
             return cursor.fetchall()
+
+    def load_station_ids(self) -> List[int]:
+        """加载已登记的基站ID
+        
+        Returns:
+            List[int]: 基站ID列表
+        """
+        with self.connection.cursor() as cursor:
+            cursor.execute("SELECT id FROM stations ORDER BY id")
+            return [row['id'] for row in cursor.fetchall()]
             
     def load_recent_data(self, hours: int = 24) -> Dict[str, List[Dict]]:
         """加载最近n小时的数据
@@ -90,7 +99,7 @@ class DataLoader:
         
         # 加载所有基站数据
         station_data = {}
-        for station_id in range(1, 5):  # 假设有4个基站
+        for station_id in self.load_station_ids():
             station_data[f'station_{station_id}'] = self.load_base_station_data(
                 station_id,
                 start_date.strftime('%Y-%m-%d'),
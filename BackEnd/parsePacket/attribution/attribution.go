@@ -0,0 +1,201 @@
+package attribution
+
+import (
+	"UserPortrait/etc"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Unassigned 未匹配任何规则的流量归入的基站ID
+const Unassigned = etc.UnassignedStation
+
+// Rule 单个基站的归属规则，任一条件命中即归属该基站
+type Rule struct {
+	StationID   uint
+	Interfaces  []string // 抓包网卡名，支持glob
+	Subnets     []string // 用户IP所在网段(CIDR)
+	VLANs       []uint16
+	GatewayMACs []string // 用户对端（网关）的MAC地址
+}
+
+// Input 判定归属所需的连接信息
+type Input struct {
+	Device     string
+	VLAN       uint16
+	ClientIP   string
+	GatewayMAC string
+}
+
+type subnetRule struct {
+	network   *net.IPNet
+	prefix    int
+	stationID uint
+}
+
+type interfaceRule struct {
+	pattern   string
+	stationID uint
+}
+
+// 规则编译后的只读索引，更新规则时整体替换
+type resolver struct {
+	vlans      map[uint16]uint
+	macs       map[string]uint
+	subnets    []subnetRule
+	interfaces []interfaceRule
+}
+
+// Stats 归属计数
+type Stats struct {
+	Rules      int             `json:"rules"`
+	Assigned   map[uint]uint64 `json:"assigned"`
+	Unassigned uint64          `json:"unassigned"`
+}
+
+var (
+	current atomic.Pointer[resolver]
+	ruleNum atomic.Int64
+
+	countMu    sync.Mutex
+	assigned   = make(map[uint]uint64)
+	unassigned uint64
+)
+
+// SetRules 校验并替换全部规则，之后新建的连接按新规则判定，已有连接保持原归属
+func SetRules(rules []Rule) error {
+	r, err := compile(rules)
+	if err != nil {
+		return err
+	}
+	current.Store(r)
+	ruleNum.Store(int64(len(rules)))
+	return nil
+}
+
+// Validate 仅校验规则，不替换当前规则
+func Validate(rules []Rule) error {
+	_, err := compile(rules)
+	return err
+}
+
+func compile(rules []Rule) (*resolver, error) {
+	r := &resolver{
+		vlans: make(map[uint16]uint),
+		macs:  make(map[string]uint),
+	}
+	for _, rule := range rules {
+		if rule.StationID == Unassigned {
+			return nil, fmt.Errorf("station id %d is reserved for unassigned traffic", Unassigned)
+		}
+		for _, vlan := range rule.VLANs {
+			if vlan == 0 || vlan > 4094 {
+				return nil, fmt.Errorf("station %d: invalid vlan %d", rule.StationID, vlan)
+			}
+			if other, ok := r.vlans[vlan]; ok && other != rule.StationID {
+				return nil, fmt.Errorf("vlan %d assigned to both station %d and %d", vlan, other, rule.StationID)
+			}
+			r.vlans[vlan] = rule.StationID
+		}
+		for _, mac := range rule.GatewayMACs {
+			hw, err := net.ParseMAC(mac)
+			if err != nil {
+				return nil, fmt.Errorf("station %d: invalid gateway mac %q", rule.StationID, mac)
+			}
+			if other, ok := r.macs[hw.String()]; ok && other != rule.StationID {
+				return nil, fmt.Errorf("gateway mac %s assigned to both station %d and %d", hw, other, rule.StationID)
+			}
+			r.macs[hw.String()] = rule.StationID
+		}
+		for _, subnet := range rule.Subnets {
+			_, network, err := net.ParseCIDR(subnet)
+			if err != nil {
+				return nil, fmt.Errorf("station %d: invalid subnet %q", rule.StationID, subnet)
+			}
+			prefix, _ := network.Mask.Size()
+			r.subnets = append(r.subnets, subnetRule{network: network, prefix: prefix, stationID: rule.StationID})
+		}
+		for _, pattern := range rule.Interfaces {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("station %d: invalid interface pattern %q", rule.StationID, pattern)
+			}
+			r.interfaces = append(r.interfaces, interfaceRule{pattern: pattern, stationID: rule.StationID})
+		}
+	}
+	return r, nil
+}
+
+// Resolve 判定连接所属基站，按 VLAN > 网关MAC > 网段(最长前缀) > 网卡 的优先级，均未命中时返回 Unassigned
+func Resolve(in Input) uint {
+	stationID := Unassigned
+	if r := current.Load(); r != nil {
+		stationID = r.resolve(in)
+	}
+	countMu.Lock()
+	if stationID == Unassigned {
+		unassigned++
+	} else {
+		assigned[stationID]++
+	}
+	countMu.Unlock()
+	return stationID
+}
+
+func (r *resolver) resolve(in Input) uint {
+	if in.VLAN != 0 {
+		if id, ok := r.vlans[in.VLAN]; ok {
+			return id
+		}
+	}
+	if in.GatewayMAC != "" {
+		if id, ok := r.macs[strings.ToLower(in.GatewayMAC)]; ok {
+			return id
+		}
+	}
+	if ip := net.ParseIP(in.ClientIP); ip != nil {
+		best, bestPrefix := Unassigned, -1
+		for _, rule := range r.subnets {
+			if rule.prefix > bestPrefix && rule.network.Contains(ip) {
+				best, bestPrefix = rule.stationID, rule.prefix
+			}
+		}
+		if bestPrefix >= 0 {
+			return best
+		}
+	}
+	for _, rule := range r.interfaces {
+		if ok, _ := path.Match(rule.pattern, in.Device); ok {
+			return rule.stationID
+		}
+	}
+	return Unassigned
+}
+
+// InSubnet 判断ip是否位于任一基站的用户网段内，用于推断未观察到握手的连接中哪一端是用户
+func InSubnet(ip string) bool {
+	r := current.Load()
+	addr := net.ParseIP(ip)
+	if r == nil || addr == nil {
+		return false
+	}
+	for _, rule := range r.subnets {
+		if rule.network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetStats 返回规则数与各基站的连接归属计数
+func GetStats() Stats {
+	countMu.Lock()
+	defer countMu.Unlock()
+	stats := Stats{Rules: int(ruleNum.Load()), Assigned: make(map[uint]uint64, len(assigned)), Unassigned: unassigned}
+	for id, n := range assigned {
+		stats.Assigned[id] = n
+	}
+	return stats
+}
@@ -0,0 +1,91 @@
+package attribution
+
+import "testing"
+
+func TestResolve(t *testing.T) {
+	rules := []Rule{
+		{StationID: 1, VLANs: []uint16{100}, Interfaces: []string{"eth1"}},
+		{StationID: 2, GatewayMACs: []string{"AA:BB:CC:DD:EE:01"}, Interfaces: []string{"wlan*"}},
+		{StationID: 3, Subnets: []string{"10.0.0.0/8"}, GatewayMACs: []string{"aa-bb-cc-dd-ee-03"}},
+		{StationID: 4, Subnets: []string{"10.1.0.0/16", "2001:db8::/32"}},
+		{StationID: 5, Subnets: []string{"10.1.2.0/24"}, Interfaces: []string{"eth*"}},
+	}
+	r, err := compile(rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		in   Input
+		want uint
+	}{
+		// 优先级：VLAN > 网关MAC > 网段 > 网卡
+		{"vlan over everything", Input{Device: "wlan0", VLAN: 100, ClientIP: "10.1.2.3", GatewayMAC: "aa:bb:cc:dd:ee:01"}, 1},
+		{"gateway mac over subnet", Input{Device: "eth1", ClientIP: "10.1.2.3", GatewayMAC: "aa:bb:cc:dd:ee:01"}, 2},
+		{"subnet over interface", Input{Device: "wlan0", ClientIP: "10.9.9.9"}, 3},
+		{"interface when nothing else matches", Input{Device: "wlan0", ClientIP: "192.168.1.2"}, 2},
+		{"unknown vlan falls through", Input{Device: "eth9", VLAN: 200, ClientIP: "192.168.1.2"}, 5},
+		// 重叠网段按最长前缀匹配，与规则顺序无关
+		{"longest prefix /24", Input{ClientIP: "10.1.2.3"}, 5},
+		{"longest prefix /16", Input{ClientIP: "10.1.3.3"}, 4},
+		{"longest prefix /8", Input{ClientIP: "10.2.3.3"}, 3},
+		{"ipv6 subnet", Input{ClientIP: "2001:db8::1"}, 4},
+		// 规则与输入中的MAC均不区分大小写，规则可用 - 分隔
+		{"mac rule upper case", Input{GatewayMAC: "AA:BB:CC:DD:EE:01"}, 2},
+		{"mac rule with dashes", Input{GatewayMAC: "AA:BB:CC:DD:EE:03"}, 3},
+		{"first matching interface glob", Input{Device: "eth1"}, 1},
+		{"no match", Input{Device: "lo", ClientIP: "192.168.1.2", GatewayMAC: "00:11:22:33:44:55"}, Unassigned},
+		{"invalid client ip", Input{ClientIP: "not-an-ip"}, Unassigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.resolve(tt.in); got != tt.want {
+				t.Fatalf("resolve(%+v) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"same vlan on one station twice", []Rule{{StationID: 1, VLANs: []uint16{10}}, {StationID: 1, VLANs: []uint16{10}}}, false},
+		{"overlapping subnets", []Rule{{StationID: 1, Subnets: []string{"10.0.0.0/8"}}, {StationID: 2, Subnets: []string{"10.1.0.0/16"}}}, false},
+		{"same interface glob", []Rule{{StationID: 1, Interfaces: []string{"eth*"}}, {StationID: 2, Interfaces: []string{"eth*"}}}, false},
+		{"vlan on two stations", []Rule{{StationID: 1, VLANs: []uint16{10}}, {StationID: 2, VLANs: []uint16{10}}}, true},
+		{"mac on two stations", []Rule{{StationID: 1, GatewayMACs: []string{"aa:bb:cc:dd:ee:ff"}}, {StationID: 2, GatewayMACs: []string{"AA-BB-CC-DD-EE-FF"}}}, true},
+		{"reserved station id", []Rule{{StationID: Unassigned, Subnets: []string{"10.0.0.0/8"}}}, true},
+		{"vlan zero", []Rule{{StationID: 1, VLANs: []uint16{0}}}, true},
+		{"vlan out of range", []Rule{{StationID: 1, VLANs: []uint16{4095}}}, true},
+		{"invalid mac", []Rule{{StationID: 1, GatewayMACs: []string{"aa:bb"}}}, true},
+		{"invalid subnet", []Rule{{StationID: 1, Subnets: []string{"10.0.0.0"}}}, true},
+		{"invalid interface glob", []Rule{{StationID: 1, Interfaces: []string{"eth["}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.rules); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetRulesKeepsPreviousOnError(t *testing.T) {
+	t.Cleanup(func() { SetRules(nil) })
+	if err := SetRules([]Rule{{StationID: 1, Subnets: []string{"10.0.0.0/8"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRules([]Rule{{StationID: 2, VLANs: []uint16{0}}}); err == nil {
+		t.Fatal("invalid rules accepted")
+	}
+	if got := Resolve(Input{ClientIP: "10.0.0.2"}); got != 1 {
+		t.Fatalf("Resolve after rejected update = %d, want 1", got)
+	}
+	if !InSubnet("10.0.0.2") || InSubnet("192.168.0.2") {
+		t.Fatal("InSubnet does not follow the current rules")
+	}
+}
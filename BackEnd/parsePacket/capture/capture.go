@@ -1,10 +1,10 @@
 package capture
 
 import (
-	"UserPortrait/configs"
 	"UserPortrait/functions"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
@@ -22,6 +22,7 @@ type PacketInfo struct {
 	SrcMAC       string
 	DstMAC       string
 	EthType      string
+	VLAN         uint16 // 802.1Q VLAN ID，无标签时为0
 	SourceIP     string
 	DestIP       string
 	Protocol     string
@@ -32,72 +33,109 @@ type PacketInfo struct {
 }
 
 var PacketChannel = make(chan PacketInfo, 100)
-var packetHashSet = make(map[string]struct{})
-var snapshotLen int32 = 1024
-var promiscuous bool = true
-var timeout time.Duration = 30 * time.Second
-var filter string = "tcp or udp or (ip and (port 80 or port 443))"
-var excludeIP = []string{
-	configs.DBHost[:13],
-	functions.GetLocalIP(),
-}
-
-func capturePackets(device string) {
-	handle, err := pcap.OpenLive(device, snapshotLen, promiscuous, timeout)
+
+// 所有来源共享的去重器，同一帧在多块网卡上被抓到时只保留一次
+var packetDeduper = NewDeduper(50*time.Millisecond, 1<<16)
+
+// 源或目的地址命中 excludeIPs 的数据包（如访问数据库的流量）不统计，本机发出的数据包同样不统计
+var (
+	excludeIPs = map[string]bool{}
+	localIP    string
+)
+
+// SetExcludeIPs 设置不统计的地址并获取本机地址，需在开始抓包前调用
+func SetExcludeIPs(ips []string) {
+	excluded := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		excluded[ip] = true
+	}
+	excludeIPs = excluded
+	localIP = functions.GetLocalIP()
+}
+
+// LiveSource 通过libpcap在指定网卡上实时抓包
+type LiveSource struct {
+	Device  string
+	Options LiveOptions
+}
+
+func (s *LiveSource) Name() string { return "live:" + s.Device }
+
+func (s *LiveSource) Run(ctx context.Context, out chan<- PacketInfo) error {
+	handle, err := pcap.OpenLive(s.Device, s.Options.SnapLen, s.Options.Promiscuous, s.Options.Timeout)
 	if err != nil {
-		log.Fatalf("Error opening device %s: %v", device, err)
+		return fmt.Errorf("error opening device %s: %v", s.Device, err)
 	}
 	defer handle.Close()
 
-	if err := handle.SetBPFFilter(filter); err != nil {
-		log.Fatalf("Error setting BPF filter: %v", err)
+	if err := handle.SetBPFFilter(s.Options.Filter); err != nil {
+		return fmt.Errorf("error setting BPF filter on %s: %v", s.Device, err)
 	}
 
 	packetSource := gopacket.NewPacketSource(handle, handle.LinkType())
-	for packet := range packetSource.Packets() {
-		srcMAC, dstMAC, ethType := extractEthernetInfo(packet)
-		if srcMAC == "" || dstMAC == "" {
-			continue
-		}
-
-		srcIP, dstIP, protocol := extractIPInfo(packet)
-		if srcIP == "" || dstIP == "" || protocol == "" || (srcIP == excludeIP[0] || dstIP == excludeIP[0] || srcIP == excludeIP[1]) {
-			continue
+	packets := packetSource.Packets()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case packet, ok := <-packets:
+			if !ok {
+				return nil
+			}
+			if packetInfo, ok := toPacketInfo(s.Device, packet); ok {
+				if !emit(ctx, out, packetInfo) {
+					return ctx.Err()
+				}
+			}
 		}
+	}
+}
 
-		tcpInfo := extractTCPInfo(packet)
-		udpInfo := extractUDPInfo(packet)
-		httpInfo := parseHTTP(packet)
+// 将gopacket数据包解析为PacketInfo，实时抓包与离线回放共用；返回false表示该包应被丢弃
+func toPacketInfo(device string, packet gopacket.Packet) (PacketInfo, bool) {
+	srcMAC, dstMAC, ethType := extractEthernetInfo(packet)
+	if srcMAC == "" || dstMAC == "" {
+		return PacketInfo{}, false
+	}
 
-		packetHash := getPacketHash(packet)
-		if _, exists := packetHashSet[packetHash]; exists {
-			continue
-		}
+	srcIP, dstIP, protocol := extractIPInfo(packet)
+	if srcIP == "" || dstIP == "" || protocol == "" || excludeIPs[srcIP] || excludeIPs[dstIP] || srcIP == localIP {
+		return PacketInfo{}, false
+	}
 
-		packetHashSet[packetHash] = struct{}{}
-
-		packetInfo := PacketInfo{
-			Device:       device,
-			Timestamp:    packet.Metadata().Timestamp,
-			SrcMAC:       srcMAC,
-			DstMAC:       dstMAC,
-			EthType:      ethType,
-			SourceIP:     srcIP,
-			DestIP:       dstIP,
-			Protocol:     protocol,
-			TCPInfo:      tcpInfo,
-			UDPInfo:      udpInfo,
-			HTTPInfo:     httpInfo,
-			PacketLength: len(packet.Data()),
-		}
+	tcpInfo := extractTCPInfo(packet)
+	udpInfo := extractUDPInfo(packet)
+	httpInfo := parseHTTP(packet)
 
-		PacketChannel <- packetInfo
+	if packetDeduper.Duplicate(packet.Data(), packet.Metadata().Timestamp) {
+		return PacketInfo{}, false
 	}
+
+	return PacketInfo{
+		Device:       device,
+		Timestamp:    packet.Metadata().Timestamp,
+		SrcMAC:       srcMAC,
+		DstMAC:       dstMAC,
+		EthType:      ethType,
+		VLAN:         extractVLAN(packet),
+		SourceIP:     srcIP,
+		DestIP:       dstIP,
+		Protocol:     protocol,
+		TCPInfo:      tcpInfo,
+		UDPInfo:      udpInfo,
+		HTTPInfo:     httpInfo,
+		PacketLength: len(packet.Data()),
+	}, true
+}
+
+// SetDeduper 替换共享去重器，需在启动抓包前调用
+func SetDeduper(d *Deduper) {
+	packetDeduper = d
 }
 
-func getPacketHash(packet gopacket.Packet) string {
-	hash := md5.Sum(packet.Data())
-	return hex.EncodeToString(hash[:])
+// GetDedupStats 返回去重命中/未命中计数
+func GetDedupStats() DedupStats {
+	return packetDeduper.Stats()
 }
 
 func extractEthernetInfo(packet gopacket.Packet) (string, string, string) {
@@ -114,6 +152,15 @@ func extractEthernetInfo(packet gopacket.Packet) (string, string, string) {
 	return "", "", ""
 }
 
+// 取最外层802.1Q标签的VLAN ID
+func extractVLAN(packet gopacket.Packet) uint16 {
+	if dot1qLayer := packet.Layer(layers.LayerTypeDot1Q); dot1qLayer != nil {
+		dot1q, _ := dot1qLayer.(*layers.Dot1Q)
+		return dot1q.VLANIdentifier
+	}
+	return 0
+}
+
 func extractIPInfo(packet gopacket.Packet) (string, string, string) {
 	ipv4Layer := packet.Layer(layers.LayerTypeIPv4)
 	if ipv4Layer != nil {
@@ -133,7 +180,11 @@ func extractIPInfo(packet gopacket.Packet) (string, string, string) {
 type TCPInfo struct {
 	SrcPort, DstPort            uint16
 	SeqNum, AckNum, PayloadSize uint32
+	Window                      uint16
 	Flags                       string
+	// TCP时间戳选项(RFC 7323)，HasTimestamp为false时TSval/TSecr无意义
+	HasTimestamp bool
+	TSval, TSecr uint32
 }
 
 func extractTCPInfo(packet gopacket.Packet) *TCPInfo {
@@ -159,14 +210,23 @@ func extractTCPInfo(packet gopacket.Packet) *TCPInfo {
 		if tcp.URG {
 			flags = append(flags, "URG")
 		}
-		return &TCPInfo{
+		info := &TCPInfo{
 			SrcPort:     uint16(tcp.SrcPort),
 			DstPort:     uint16(tcp.DstPort),
 			SeqNum:      tcp.Seq,
 			AckNum:      tcp.Ack,
 			PayloadSize: uint32(len(tcp.Payload)),
+			Window:      tcp.Window,
 			Flags:       strings.Join(flags, "|"),
 		}
+		for _, opt := range tcp.Options {
+			if opt.OptionType == layers.TCPOptionKindTimestamps && len(opt.OptionData) == 8 {
+				info.HasTimestamp = true
+				info.TSval = binary.BigEndian.Uint32(opt.OptionData[0:4])
+				info.TSecr = binary.BigEndian.Uint32(opt.OptionData[4:8])
+			}
+		}
+		return info
 	}
 	return nil
 }
@@ -174,18 +234,23 @@ func extractTCPInfo(packet gopacket.Packet) *TCPInfo {
 type UDPInfo struct {
 	SrcPort, DstPort    uint16
 	Length, PayloadSize uint16
+	QUIC                *QUICInfo
 }
 
 func extractUDPInfo(packet gopacket.Packet) *UDPInfo {
 	udpLayer := packet.Layer(layers.LayerTypeUDP)
 	if udpLayer != nil {
 		udp, _ := udpLayer.(*layers.UDP)
-		return &UDPInfo{
+		info := &UDPInfo{
 			SrcPort:     uint16(udp.SrcPort),
 			DstPort:     uint16(udp.DstPort),
 			Length:      udp.Length,
 			PayloadSize: uint16(len(udp.Payload)),
 		}
+		if info.SrcPort == QUICPort || info.DstPort == QUICPort {
+			info.QUIC = parseQUIC(udp.Payload)
+		}
+		return info
 	}
 	return nil
 }
@@ -224,13 +289,25 @@ func parseHTTP(packet gopacket.Packet) *HTTPInfo {
 	return nil
 }
 
-func Tcpd() {
+// Tcpd 在配置选中的网卡上实时抓包，结果写入PacketChannel；阻塞至ctx取消或全部网卡停止抓包，
+// 返回时各网卡的pcap句柄均已关闭
+func Tcpd(ctx context.Context, cfg CaptureConfig) error {
 	devices, err := pcap.FindAllDevs()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("find capture devices failed: %v", err)
 	}
 
+	var sources []PacketSource
 	for _, device := range devices {
-		go capturePackets(device.Name)
+		if !cfg.Selected(device.Name, device.Flags) {
+			continue
+		}
+		opts := cfg.OptionsFor(device.Name)
+		log.Printf("capture on %s, filter %q, snaplen %d, promiscuous %t", device.Name, opts.Filter, opts.SnapLen, opts.Promiscuous)
+		sources = append(sources, &LiveSource{Device: device.Name, Options: opts})
+	}
+	if len(sources) == 0 {
+		return errors.New("capture: no interface selected")
 	}
+	return RunSources(ctx, PacketChannel, sources...)
 }
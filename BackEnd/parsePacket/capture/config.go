@@ -0,0 +1,111 @@
+package capture
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CaptureConfig 实时抓包配置，由 configs.CaptureConfig 转换而来，校验在载入配置时完成
+// 网卡名匹配规则支持glob（如 "docker*"），以 "re:" 开头时按正则匹配（如 "re:^veth[0-9a-f]+$"）
+type CaptureConfig struct {
+	// Include 网卡白名单，为空表示不限制
+	Include []string
+	// Exclude 网卡黑名单，优先于白名单
+	Exclude []string
+	// SkipLoopback 跳过libpcap标记为回环的网卡
+	SkipLoopback bool
+	// 以下为所有网卡的默认抓包参数
+	Filter      string
+	SnapLen     int32
+	Promiscuous bool
+	Timeout     time.Duration
+	// Interfaces 按网卡覆盖默认参数，按顺序取第一个匹配项
+	Interfaces []InterfaceConfig
+	// DedupWindow 去重时间窗口，同一帧在窗口内重复出现才会被丢弃
+	DedupWindow time.Duration
+	// DedupMaxEntries 去重器最多保留的记录数
+	DedupMaxEntries int
+}
+
+// InterfaceConfig 单个（或一组）网卡的抓包参数，未设置的字段沿用默认值
+type InterfaceConfig struct {
+	Match       string
+	Filter      string
+	SnapLen     int32
+	Promiscuous *bool
+}
+
+// LiveOptions 打开单个网卡时使用的最终参数
+type LiveOptions struct {
+	Filter      string
+	SnapLen     int32
+	Promiscuous bool
+	Timeout     time.Duration
+}
+
+// pcap_if_t 中的 PCAP_IF_LOOPBACK 标志位
+const pcapIfLoopback = 0x00000001
+
+// NewDeduper 按配置创建去重器
+func (cfg CaptureConfig) NewDeduper() *Deduper {
+	return NewDeduper(cfg.DedupWindow, cfg.DedupMaxEntries)
+}
+
+// Selected 判断网卡是否需要抓包
+func (cfg CaptureConfig) Selected(name string, flags uint32) bool {
+	if cfg.SkipLoopback && flags&pcapIfLoopback != 0 {
+		return false
+	}
+	if matchAny(cfg.Exclude, name) {
+		return false
+	}
+	return len(cfg.Include) == 0 || matchAny(cfg.Include, name)
+}
+
+// OptionsFor 计算指定网卡的最终抓包参数
+func (cfg CaptureConfig) OptionsFor(name string) LiveOptions {
+	opts := LiveOptions{
+		Filter:      cfg.Filter,
+		SnapLen:     cfg.SnapLen,
+		Promiscuous: cfg.Promiscuous,
+		Timeout:     cfg.Timeout,
+	}
+	for _, iface := range cfg.Interfaces {
+		if ok, _ := matchName(iface.Match, name); !ok {
+			continue
+		}
+		if iface.Filter != "" {
+			opts.Filter = iface.Filter
+		}
+		if iface.SnapLen > 0 {
+			opts.SnapLen = iface.SnapLen
+		}
+		if iface.Promiscuous != nil {
+			opts.Promiscuous = *iface.Promiscuous
+		}
+		break
+	}
+	return opts
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := matchName(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchName(pattern string, name string) (bool, error) {
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(name), nil
+	}
+	return path.Match(pattern, name)
+}
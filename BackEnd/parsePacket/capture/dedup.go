@@ -0,0 +1,117 @@
+package capture
+
+import (
+	"container/list"
+	"crypto/md5"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Deduper 有界、带时间窗口的数据包去重器，并发安全
+// 仅当同一帧（如在两块网卡上各抓到一次）在窗口内重复出现时判定为重复；
+// 记录按写入顺序以本机单调时钟过期，不受各来源时间戳偏差影响，且总数不超过上限，超出时淘汰最旧的记录
+type Deduper struct {
+	mu         sync.Mutex
+	window     time.Duration
+	maxEntries int
+	entries    map[[md5.Size]byte]*list.Element
+	order      *list.List // 按写入顺序排列，Front为最旧
+	now        func() time.Time
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+type dedupEntry struct {
+	key  [md5.Size]byte
+	seen time.Time // 数据包时间戳
+	// added 写入时的本机时间，用于过期
+	added time.Time
+}
+
+// DedupStats 去重计数
+type DedupStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+func NewDeduper(window time.Duration, maxEntries int) *Deduper {
+	return &Deduper{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[[md5.Size]byte]*list.Element),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Duplicate 判断该帧是否在窗口内出现过：两次出现的数据包时间戳之差不超过窗口时判定为重复
+func (d *Deduper) Duplicate(data []byte, ts time.Time) bool {
+	key := md5.Sum(data)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.expire(now)
+
+	if elem, ok := d.entries[key]; ok {
+		entry := elem.Value.(*dedupEntry)
+		if absDuration(ts.Sub(entry.seen)) <= d.window {
+			d.hits.Add(1)
+			return true
+		}
+		// 窗口外再次出现视为新的帧，刷新记录
+		entry.seen = ts
+		entry.added = now
+		d.order.MoveToBack(elem)
+		d.misses.Add(1)
+		return false
+	}
+
+	d.entries[key] = d.order.PushBack(&dedupEntry{key: key, seen: ts, added: now})
+	d.misses.Add(1)
+	for d.order.Len() > d.maxEntries {
+		d.remove(d.order.Front())
+	}
+	return false
+}
+
+// 淘汰写入时间早于窗口的记录，order按写入时间有序，遇到未过期的记录即可停止
+func (d *Deduper) expire(now time.Time) {
+	for elem := d.order.Front(); elem != nil; elem = d.order.Front() {
+		if now.Sub(elem.Value.(*dedupEntry).added) <= d.window {
+			return
+		}
+		d.remove(elem)
+	}
+}
+
+func (d *Deduper) remove(elem *list.Element) {
+	delete(d.entries, elem.Value.(*dedupEntry).key)
+	d.order.Remove(elem)
+	d.evictions.Add(1)
+}
+
+func (d *Deduper) Stats() DedupStats {
+	d.mu.Lock()
+	entries := d.order.Len()
+	d.mu.Unlock()
+	return DedupStats{
+		Hits:      d.hits.Load(),
+		Misses:    d.misses.Load(),
+		Evictions: d.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
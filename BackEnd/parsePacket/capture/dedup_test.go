@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeduperDuplicate(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type packet struct {
+		data string
+		ts   time.Duration // 数据包时间戳相对base的偏移
+		wall time.Duration // 到达时本机时间相对base的偏移
+		dup  bool
+	}
+	tests := []struct {
+		name       string
+		maxEntries int
+		packets    []packet
+	}{
+		{
+			name:       "same frame within window",
+			maxEntries: 16,
+			packets: []packet{
+				{data: "a", ts: 0, dup: false},
+				{data: "a", ts: 10 * time.Millisecond, wall: 10 * time.Millisecond, dup: true},
+				{data: "b", ts: 10 * time.Millisecond, wall: 10 * time.Millisecond, dup: false},
+			},
+		},
+		{
+			name:       "same frame outside window",
+			maxEntries: 16,
+			packets: []packet{
+				{data: "a", ts: 0, dup: false},
+				{data: "a", ts: 80 * time.Millisecond, wall: 20 * time.Millisecond, dup: false},
+				{data: "a", ts: 90 * time.Millisecond, wall: 30 * time.Millisecond, dup: true},
+			},
+		},
+		{
+			name:       "earlier timestamp from skewed source",
+			maxEntries: 16,
+			packets: []packet{
+				{data: "a", ts: time.Hour, dup: false},
+				// 另一来源的时钟落后一小时，不应使前一来源的记录提前过期
+				{data: "b", ts: 0, wall: time.Millisecond, dup: false},
+				{data: "a", ts: time.Hour + time.Millisecond, wall: 2 * time.Millisecond, dup: true},
+				{data: "b", ts: time.Millisecond, wall: 3 * time.Millisecond, dup: true},
+			},
+		},
+		{
+			name:       "expired by wall clock",
+			maxEntries: 16,
+			packets: []packet{
+				{data: "a", ts: 0, dup: false},
+				{data: "a", ts: 0, wall: time.Second, dup: false},
+			},
+		},
+		{
+			name:       "evicted by size",
+			maxEntries: 2,
+			packets: []packet{
+				{data: "a", dup: false},
+				{data: "b", dup: false},
+				{data: "c", dup: false},
+				{data: "a", dup: false},
+				{data: "c", dup: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDeduper(50*time.Millisecond, tt.maxEntries)
+			var wall time.Time
+			d.now = func() time.Time { return wall }
+			for i, p := range tt.packets {
+				wall = base.Add(p.wall)
+				if got := d.Duplicate([]byte(p.data), base.Add(p.ts)); got != p.dup {
+					t.Fatalf("packet %d (%s): Duplicate = %t, want %t", i, p.data, got, p.dup)
+				}
+			}
+			if stats := d.Stats(); stats.Entries > tt.maxEntries {
+				t.Fatalf("entries = %d, exceeds max %d", stats.Entries, tt.maxEntries)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package capture
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const (
+	// QUICPort QUIC使用的UDP端口，该端口上的UDP报文尝试按QUIC包头解析
+	QUICPort      = 443
+	maxQUICCIDLen = 20
+)
+
+// QUICInfo QUIC包头中的连接ID信息(RFC 9000 17节)，连接ID以十六进制字符串表示
+type QUICInfo struct {
+	LongHeader bool
+	Version    uint32
+	DCID       string
+	SCID       string
+	// ShortHeaderID 短包头中紧随首字节的最多20字节，目的连接ID长度需结合长包头中已知的ID长度确定
+	ShortHeaderID string
+}
+
+// 解析QUIC包头，不是QUIC报文时返回nil
+func parseQUIC(payload []byte) *QUICInfo {
+	if len(payload) < 2 || payload[0]&0x40 == 0 {
+		// 固定位(0x40)为0的不是QUIC v1/v2报文
+		return nil
+	}
+	if payload[0]&0x80 == 0 {
+		end := 1 + maxQUICCIDLen
+		if end > len(payload) {
+			end = len(payload)
+		}
+		return &QUICInfo{ShortHeaderID: hex.EncodeToString(payload[1:end])}
+	}
+
+	// 长包头：首字节 | 版本(4) | DCID长度(1) | DCID | SCID长度(1) | SCID
+	if len(payload) < 7 {
+		return nil
+	}
+	info := &QUICInfo{LongHeader: true, Version: binary.BigEndian.Uint32(payload[1:5])}
+	offset := 5
+	dcid, offset, ok := readCID(payload, offset)
+	if !ok {
+		return nil
+	}
+	scid, _, ok := readCID(payload, offset)
+	if !ok {
+		return nil
+	}
+	info.DCID, info.SCID = dcid, scid
+	return info
+}
+
+func readCID(payload []byte, offset int) (string, int, bool) {
+	if offset >= len(payload) {
+		return "", offset, false
+	}
+	length := int(payload[offset])
+	offset++
+	if length > maxQUICCIDLen || offset+length > len(payload) {
+		return "", offset, false
+	}
+	return hex.EncodeToString(payload[offset : offset+length]), offset + length, true
+}
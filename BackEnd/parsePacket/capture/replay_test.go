@@ -0,0 +1,159 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// testdata/three.pcap 与 testdata/three.pcapng 内容相同：
+// 10.0.0.2:40000 -> 93.184.216.34:443 的3个TCP数据段，时间戳依次相隔100ms
+const (
+	fixturePackets  = 3
+	fixtureDuration = 200 * time.Millisecond
+)
+
+var fixtureStart = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+func TestOpenCaptureFile(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data []byte // 非空时为无法识别的文件内容
+	}{
+		{name: "pcap", file: "testdata/three.pcap"},
+		{name: "pcapng", file: "testdata/three.pcapng"},
+		{name: "unknown magic", data: []byte("not a capture file")},
+		{name: "truncated header", data: []byte{0xd4, 0xc3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.data
+			if tt.file != "" {
+				var err error
+				if data, err = os.ReadFile(tt.file); err != nil {
+					t.Fatal(err)
+				}
+			}
+			reader, err := openCaptureFile(bytes.NewReader(data))
+			if tt.data != nil {
+				if err == nil {
+					t.Fatal("invalid file accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reader.LinkType() != layers.LinkTypeEthernet {
+				t.Fatalf("link type %v, want Ethernet", reader.LinkType())
+			}
+		})
+	}
+}
+
+// 回放全部文件，返回收到的数据包与耗时
+func replayAll(t *testing.T, ctx context.Context, source *FileSource) ([]PacketInfo, time.Duration, error) {
+	t.Helper()
+	SetDeduper(NewDeduper(50*time.Millisecond, 1<<10))
+	out := make(chan PacketInfo, fixturePackets*len(source.Files))
+	start := time.Now()
+	err := source.Run(ctx, out)
+	elapsed := time.Since(start)
+	close(out)
+	var packets []PacketInfo
+	for p := range out {
+		packets = append(packets, p)
+	}
+	return packets, elapsed, err
+}
+
+func TestReplayPacing(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      []string
+		speed      float64
+		minElapsed time.Duration
+		maxElapsed time.Duration
+	}{
+		{name: "as fast as possible", files: []string{"testdata/three.pcap"}, speed: 0, maxElapsed: fixtureDuration},
+		{name: "real time", files: []string{"testdata/three.pcapng"}, speed: 1, minElapsed: fixtureDuration},
+		{name: "double speed", files: []string{"testdata/three.pcap"}, speed: 2, minElapsed: fixtureDuration / 2, maxElapsed: fixtureDuration},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, elapsed, err := replayAll(t, context.Background(), &FileSource{Files: tt.files, Speed: tt.speed})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if elapsed < tt.minElapsed || (tt.maxElapsed > 0 && elapsed >= tt.maxElapsed) {
+				t.Fatalf("replay took %v, want [%v, %v)", elapsed, tt.minElapsed, tt.maxElapsed)
+			}
+			if len(packets) != fixturePackets {
+				t.Fatalf("got %d packets, want %d", len(packets), fixturePackets)
+			}
+			// 无论回放速度如何，数据包均保留文件中的原始时间戳
+			for i, p := range packets {
+				if want := fixtureStart.Add(time.Duration(i) * 100 * time.Millisecond); !p.Timestamp.Equal(want) {
+					t.Errorf("packet %d timestamp %v, want %v", i, p.Timestamp, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayStopsAtEOF(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    int
+		wantErr bool
+	}{
+		{name: "pcap", files: []string{"testdata/three.pcap"}, want: fixturePackets},
+		{name: "pcapng", files: []string{"testdata/three.pcapng"}, want: fixturePackets},
+		{name: "missing file", files: []string{"testdata/missing.pcap"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			var packets []PacketInfo
+			var err error
+			go func() {
+				defer close(done)
+				packets, _, err = replayAll(t, context.Background(), &FileSource{Files: tt.files})
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("replay did not return at end of file")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %t", err, tt.wantErr)
+			}
+			if len(packets) != tt.want {
+				t.Fatalf("got %d packets, want %d", len(packets), tt.want)
+			}
+			if tt.want > 0 && packets[0].Device != "replay:"+filepath.Base(tt.files[0]) {
+				t.Errorf("device %q", packets[0].Device)
+			}
+		})
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// 1/100倍速时第二个包需等待10s
+	packets, elapsed, err := replayAll(t, ctx, &FileSource{Files: []string{"testdata/three.pcap"}, Speed: 0.01})
+	if err == nil || ctx.Err() == nil {
+		t.Fatalf("err = %v, want cancellation", err)
+	}
+	if len(packets) != 1 || elapsed > 5*time.Second {
+		t.Fatalf("got %d packets after %v, want 1 before cancellation", len(packets), elapsed)
+	}
+}
@@ -0,0 +1,150 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// PacketSource 数据包来源：实时抓包、离线回放、合成数据、远程推送等均实现该接口
+type PacketSource interface {
+	// Name 来源名称，用于日志
+	Name() string
+	// Run 持续将数据包写入out，直至来源耗尽、出错或ctx被取消；Run不负责关闭out
+	Run(ctx context.Context, out chan<- PacketInfo) error
+}
+
+// RunSources 并行运行多个数据来源，写入同一个out，全部结束后返回各来源的错误
+func RunSources(ctx context.Context, out chan<- PacketInfo, sources ...PacketSource) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(sources))
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source PacketSource) {
+			defer wg.Done()
+			if err := source.Run(ctx, out); err != nil && !errors.Is(err, context.Canceled) {
+				log.Printf("packet source %s stopped: %v", source.Name(), err)
+				errs[i] = fmt.Errorf("%s: %v", source.Name(), err)
+			}
+		}(i, source)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// 向out写入数据包，ctx取消时放弃写入并返回false
+func emit(ctx context.Context, out chan<- PacketInfo, packet PacketInfo) bool {
+	select {
+	case out <- packet:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// GeneratorSource 由函数合成数据包，可用于压测或在无libpcap/root权限的环境下注入PacketInfo
+type GeneratorSource struct {
+	Label string
+	// Next 返回下一个数据包，第二个返回值为false时来源结束
+	Next func() (PacketInfo, bool)
+	// Interval 相邻两个数据包的间隔，0表示不等待
+	Interval time.Duration
+}
+
+// NewSliceSource 依次产出给定的数据包
+func NewSliceSource(label string, packets []PacketInfo) *GeneratorSource {
+	i := 0
+	return &GeneratorSource{
+		Label: label,
+		Next: func() (PacketInfo, bool) {
+			if i >= len(packets) {
+				return PacketInfo{}, false
+			}
+			i++
+			return packets[i-1], true
+		},
+	}
+}
+
+func (s *GeneratorSource) Name() string { return "generator:" + s.Label }
+
+func (s *GeneratorSource) Run(ctx context.Context, out chan<- PacketInfo) error {
+	for {
+		packet, ok := s.Next()
+		if !ok {
+			return nil
+		}
+		if !emit(ctx, out, packet) {
+			return ctx.Err()
+		}
+		if s.Interval > 0 {
+			select {
+			case <-time.After(s.Interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// RemoteSource 从远程探针的TCP连接读取逐行JSON编码的PacketInfo
+type RemoteSource struct {
+	Addr string
+	// Reconnect 连接断开后的重连间隔，0表示不重连
+	Reconnect time.Duration
+}
+
+func (s *RemoteSource) Name() string { return "remote:" + s.Addr }
+
+func (s *RemoteSource) Run(ctx context.Context, out chan<- PacketInfo) error {
+	for {
+		err := s.readFeed(ctx, out)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.Reconnect <= 0 {
+			return err
+		}
+		log.Printf("packet source %s disconnected: %v, reconnecting in %v", s.Name(), err, s.Reconnect)
+		select {
+		case <-time.After(s.Reconnect):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *RemoteSource) readFeed(ctx context.Context, out chan<- PacketInfo) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// ctx取消时关闭连接以中断阻塞的读取
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var packet PacketInfo
+		if err := json.Unmarshal(scanner.Bytes(), &packet); err != nil {
+			log.Printf("packet source %s: bad record: %v", s.Name(), err)
+			continue
+		}
+		if !emit(ctx, out, packet) {
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("connection closed by peer")
+}
@@ -0,0 +1,147 @@
+package process
+
+import (
+	"strings"
+	"time"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+// 未获得RTT时判定乱序所用的默认时间阈值，与Wireshark tcp.analysis一致
+const defaultOutOfOrderThreshold = 3 * time.Millisecond
+
+// SegmentKind 报文段分析结果
+type SegmentKind int
+
+const (
+	SegmentNormal SegmentKind = iota
+	SegmentRetransmission
+	SegmentFastRetransmission
+	SegmentOutOfOrder
+	SegmentKeepAlive
+	SegmentDupAck
+	SegmentZeroWindow
+)
+
+// Lost 重传类报文段视为发生了丢包
+func (k SegmentKind) Lost() bool {
+	return k == SegmentRetransmission || k == SegmentFastRetransmission
+}
+
+// TCPAnalysis 单方向的TCP分析计数
+type TCPAnalysis struct {
+	DataSegments        uint64 `json:"data_segments"`
+	Retransmissions     uint64 `json:"retransmissions"`
+	FastRetransmissions uint64 `json:"fast_retransmissions"`
+	OutOfOrder          uint64 `json:"out_of_order"`
+	DupAcks             uint64 `json:"dup_acks"`
+	ZeroWindows         uint64 `json:"zero_windows"`
+	KeepAlives          uint64 `json:"keep_alives"`
+}
+
+// LossRate 重传报文段占数据报文段的比例
+func (a TCPAnalysis) LossRate() float32 {
+	if a.DataSegments == 0 {
+		return 0
+	}
+	return float32(a.Retransmissions+a.FastRetransmissions) / float32(a.DataSegments)
+}
+
+// 单方向的序列号跟踪状态
+type tcpDirection struct {
+	initialized bool
+	nextSeq     uint32 // 该方向已发送的最大 seq+len
+	lastSegTime time.Time
+
+	ackValid   bool
+	lastAck    uint32
+	lastWindow uint16
+	dupAcks    int // 连续重复ACK个数
+}
+
+// 考虑回绕的序列号比较
+func seqLess(a, b uint32) bool { return int32(a-b) < 0 }
+
+// 报文段占用的序列号长度，SYN与FIN各占一个序列号
+func segmentLength(tcpInfo *capture.TCPInfo) uint32 {
+	segLen := tcpInfo.PayloadSize
+	if strings.Contains(tcpInfo.Flags, "SYN") {
+		segLen++
+	}
+	if strings.Contains(tcpInfo.Flags, "FIN") {
+		segLen++
+	}
+	return segLen
+}
+
+// 分析一个报文段：sender为发送方向的状态，peer为反方向状态（用于识别快速重传）
+func analyzeSegment(sender, peer *tcpDirection, stats *TCPAnalysis, tcpInfo *capture.TCPInfo, now time.Time, rtt time.Duration) SegmentKind {
+	flags := tcpInfo.Flags
+	syn := strings.Contains(flags, "SYN")
+	fin := strings.Contains(flags, "FIN")
+	rst := strings.Contains(flags, "RST")
+	ack := strings.Contains(flags, "ACK")
+
+	segLen := segmentLength(tcpInfo)
+	seq := tcpInfo.SeqNum
+	end := seq + segLen
+
+	kind := SegmentNormal
+	switch {
+	case rst:
+	case !sender.initialized:
+		sender.initialized = true
+		sender.nextSeq = end
+	case segLen <= 1 && !syn && !fin && seq == sender.nextSeq-1:
+		// 保活报文：序列号为已确认数据的最后一个字节
+		kind = SegmentKeepAlive
+		stats.KeepAlives++
+	case segLen > 0 && seqLess(seq, sender.nextSeq):
+		threshold := rtt
+		if threshold <= 0 {
+			threshold = defaultOutOfOrderThreshold
+		}
+		switch {
+		case peer.dupAcks >= 2 && peer.lastAck == seq:
+			kind = SegmentFastRetransmission
+			stats.FastRetransmissions++
+		case now.Sub(sender.lastSegTime) < threshold:
+			kind = SegmentOutOfOrder
+			stats.OutOfOrder++
+		default:
+			kind = SegmentRetransmission
+			stats.Retransmissions++
+		}
+	}
+	if sender.initialized && seqLess(sender.nextSeq, end) {
+		sender.nextSeq = end
+	}
+	if segLen > 0 && kind != SegmentKeepAlive {
+		stats.DataSegments++
+		sender.lastSegTime = now
+	}
+
+	if !ack || rst {
+		return kind
+	}
+	if tcpInfo.Window == 0 && !syn && !fin {
+		stats.ZeroWindows++
+		if kind == SegmentNormal {
+			kind = SegmentZeroWindow
+		}
+	}
+	// 重复ACK：不携带数据，且确认号与窗口均未变化
+	if segLen == 0 && kind != SegmentKeepAlive && sender.ackValid && tcpInfo.AckNum == sender.lastAck && tcpInfo.Window == sender.lastWindow && tcpInfo.Window != 0 {
+		sender.dupAcks++
+		stats.DupAcks++
+		if kind == SegmentNormal {
+			kind = SegmentDupAck
+		}
+	} else if !sender.ackValid || tcpInfo.AckNum != sender.lastAck {
+		sender.dupAcks = 0
+	}
+	sender.ackValid = true
+	sender.lastAck = tcpInfo.AckNum
+	sender.lastWindow = tcpInfo.Window
+	return kind
+}
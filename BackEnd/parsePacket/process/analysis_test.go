@@ -0,0 +1,130 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+func TestAnalyzeSegment(t *testing.T) {
+	type seg struct {
+		dir    Direction
+		flags  string
+		seq    uint32
+		ack    uint32
+		len    uint32
+		window uint16 // 0表示65535
+		zero   bool   // 零窗口
+		at     int    // 毫秒
+		want   SegmentKind
+	}
+	const c, s = ClientToServer, ServerToClient
+	tests := []struct {
+		name     string
+		segments []seg
+		want     TCPAnalysis // 客户端方向的计数
+	}{
+		{
+			name: "in order",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 101, ack: 1, len: 100, at: 1, want: SegmentNormal},
+			},
+			want: TCPAnalysis{DataSegments: 2},
+		},
+		{
+			name: "retransmission",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 300, want: SegmentRetransmission},
+			},
+			want: TCPAnalysis{DataSegments: 2, Retransmissions: 1},
+		},
+		{
+			name: "out of order",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 101, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 1, want: SegmentOutOfOrder},
+			},
+			want: TCPAnalysis{DataSegments: 2, OutOfOrder: 1},
+		},
+		{
+			name: "fast retransmission after dup acks",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 101, ack: 1, len: 100, at: 1, want: SegmentNormal},
+				{dir: s, flags: "ACK", seq: 1, ack: 1, window: 1000, at: 20, want: SegmentNormal},
+				{dir: s, flags: "ACK", seq: 1, ack: 1, window: 1000, at: 21, want: SegmentDupAck},
+				{dir: s, flags: "ACK", seq: 1, ack: 1, window: 1000, at: 22, want: SegmentDupAck},
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 23, want: SegmentFastRetransmission},
+			},
+			want: TCPAnalysis{DataSegments: 3, FastRetransmissions: 1},
+		},
+		{
+			name: "keep alive",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 100, ack: 1, at: 5000, want: SegmentKeepAlive},
+			},
+			want: TCPAnalysis{DataSegments: 1, KeepAlives: 1},
+		},
+		{
+			name: "zero window",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, window: 1000, at: 0, want: SegmentNormal},
+				{dir: c, flags: "ACK", seq: 1, ack: 1, zero: true, at: 1, want: SegmentZeroWindow},
+				// 零窗口期间的相同ACK不计为重复ACK
+				{dir: c, flags: "ACK", seq: 1, ack: 1, zero: true, at: 2, want: SegmentZeroWindow},
+			},
+			want: TCPAnalysis{ZeroWindows: 2},
+		},
+		{
+			name: "reset is not analyzed",
+			segments: []seg{
+				{dir: c, flags: "ACK", seq: 1, ack: 1, len: 100, at: 0, want: SegmentNormal},
+				{dir: c, flags: "RST", seq: 1, at: 500, want: SegmentNormal},
+			},
+			want: TCPAnalysis{DataSegments: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var directions [2]tcpDirection
+			var analysis [2]TCPAnalysis
+			for i, sg := range tt.segments {
+				window := sg.window
+				if window == 0 && !sg.zero {
+					window = 65535
+				}
+				info := &capture.TCPInfo{SeqNum: sg.seq, AckNum: sg.ack, PayloadSize: sg.len, Window: window, Flags: sg.flags}
+				now := testStart.Add(time.Duration(sg.at) * time.Millisecond)
+				got := analyzeSegment(&directions[sg.dir], &directions[1-sg.dir], &analysis[sg.dir], info, now, 0)
+				if got != sg.want {
+					t.Fatalf("segment %d: kind = %d, want %d", i, got, sg.want)
+				}
+			}
+			if analysis[ClientToServer] != tt.want {
+				t.Fatalf("client analysis = %+v, want %+v", analysis[ClientToServer], tt.want)
+			}
+		})
+	}
+}
+
+func TestSeqLessWraparound(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{0xfffffff0, 0x10, true},
+		{0x10, 0xfffffff0, false},
+		{5, 5, false},
+	}
+	for _, tt := range tests {
+		if got := seqLess(tt.a, tt.b); got != tt.want {
+			t.Errorf("seqLess(%#x, %#x) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package process
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"UserPortrait/parsePacket/attribution"
+	"UserPortrait/parsePacket/capture"
+)
+
+// Endpoint 连接的一端
+type Endpoint struct {
+	IP   string `json:"ip"`
+	Port uint16 `json:"port"`
+}
+
+func (e Endpoint) String() string { return fmt.Sprintf("%s:%d", e.IP, e.Port) }
+
+func (e Endpoint) less(o Endpoint) bool {
+	if e.IP != o.IP {
+		return e.IP < o.IP
+	}
+	return e.Port < o.Port
+}
+
+// FlowKey 归一化的五元组：两端按大小排序，同一连接两个方向的数据包得到相同的键
+type FlowKey struct {
+	Protocol string
+	Low      Endpoint
+	High     Endpoint
+}
+
+func newFlowKey(protocol string, src, dst Endpoint) FlowKey {
+	if dst.less(src) {
+		return FlowKey{Protocol: protocol, Low: dst, High: src}
+	}
+	return FlowKey{Protocol: protocol, Low: src, High: dst}
+}
+
+// TCPState TCP连接状态
+type TCPState int
+
+const (
+	// StateMidstream 未观察到握手，连接在抓包开始前已建立
+	StateMidstream TCPState = iota
+	StateSynSent
+	StateSynReceived
+	StateEstablished
+	// StateClosing 至少一方已发送FIN
+	StateClosing
+	StateClosed
+)
+
+var tcpStateNames = map[TCPState]string{
+	StateMidstream:   "MIDSTREAM",
+	StateSynSent:     "SYN_SENT",
+	StateSynReceived: "SYN_RECEIVED",
+	StateEstablished: "ESTABLISHED",
+	StateClosing:     "CLOSING",
+	StateClosed:      "CLOSED",
+}
+
+func (s TCPState) String() string { return tcpStateNames[s] }
+
+// 连接关闭原因
+const (
+	CloseFIN      = "fin"
+	CloseRST      = "rst"
+	CloseTimeout  = "timeout"
+	CloseShutdown = "shutdown"
+)
+
+// Direction 数据包相对于连接发起方的方向
+type Direction int
+
+const (
+	ClientToServer Direction = iota
+	ServerToClient
+)
+
+// Flow 双向连接状态；Client为发起方（发送SYN的一端，未观察到握手时按 guessSrcIsClient 推断）
+type Flow struct {
+	Key       FlowKey
+	Client    Endpoint
+	Server    Endpoint
+	ClientMAC string
+	StationID uint
+	State     TCPState
+
+	Start        time.Time
+	LastSeen     time.Time
+	SynTime      time.Time
+	SynAckTime   time.Time
+	HandshakeRTT time.Duration
+
+	BytesToServer   uint64
+	BytesToClient   uint64
+	PacketsToServer uint64
+	PacketsToClient uint64
+
+	// Analysis 按方向（下标为Direction）统计的重传、乱序等分析计数
+	Analysis [2]TCPAnalysis
+
+	// QUIC 为UDP连接中识别出的QUIC连接
+	QUIC        bool
+	QUICVersion uint32
+	// 该连接登记在连接表中的QUIC连接ID及登记时的服务端，仅在FlowTable.mu下访问
+	quicIDs    []string
+	quicServer Endpoint
+
+	finFromClient bool
+	finFromServer bool
+	closeReason   string
+	directions    [2]tcpDirection
+	rtt           rttEstimator
+
+	mux sync.Mutex
+}
+
+// FlowRecord 连接结束（正常关闭、重置或超时）时输出的完整记录
+type FlowRecord struct {
+	Protocol        string        `json:"protocol"`
+	Client          Endpoint      `json:"client"`
+	Server          Endpoint      `json:"server"`
+	ClientMAC       string        `json:"client_mac"`
+	StationID       uint          `json:"station_id"`
+	Start           time.Time     `json:"start"`
+	End             time.Time     `json:"end"`
+	Duration        time.Duration `json:"duration"`
+	BytesToServer   uint64        `json:"bytes_to_server"`
+	BytesToClient   uint64        `json:"bytes_to_client"`
+	PacketsToServer uint64        `json:"packets_to_server"`
+	PacketsToClient uint64        `json:"packets_to_client"`
+	HandshakeRTT    time.Duration `json:"handshake_rtt"`
+	RTT             RTTStats      `json:"rtt"`
+	ClientAnalysis  TCPAnalysis   `json:"client_analysis"`
+	ServerAnalysis  TCPAnalysis   `json:"server_analysis"`
+	LossRate        float32       `json:"loss_rate"`
+	FinalState      string        `json:"final_state"`
+	CloseReason     string        `json:"close_reason"`
+	QUICVersion     uint32        `json:"quic_version,omitempty"`
+}
+
+// PacketResult 单个数据包在连接上下文中的处理结果，在连接锁内生成，供后续入库使用
+type PacketResult struct {
+	StationID uint
+	MAC       string
+	UserIP    string
+	RemoteIP  string
+	Payload   uint
+	Latency   uint // 毫秒，未知时为0
+	LossFlag  bool // 该报文段为重传或快速重传
+	// DataSegment 该报文段计入 TCPAnalysis.DataSegments，为丢包率的分母；纯ACK、保活报文与UDP数据包不计入
+	DataSegment bool
+	Kind        SegmentKind
+}
+
+func (f *Flow) record(end time.Time) FlowRecord {
+	protocol, finalState := f.Key.Protocol, f.State.String()
+	if f.QUIC {
+		protocol = "QUIC"
+	}
+	if f.Key.Protocol != "TCP" {
+		finalState = ""
+	}
+	total := TCPAnalysis{
+		DataSegments:        f.Analysis[ClientToServer].DataSegments + f.Analysis[ServerToClient].DataSegments,
+		Retransmissions:     f.Analysis[ClientToServer].Retransmissions + f.Analysis[ServerToClient].Retransmissions,
+		FastRetransmissions: f.Analysis[ClientToServer].FastRetransmissions + f.Analysis[ServerToClient].FastRetransmissions,
+	}
+	return FlowRecord{
+		Protocol:        protocol,
+		Client:          f.Client,
+		Server:          f.Server,
+		ClientMAC:       f.ClientMAC,
+		StationID:       f.StationID,
+		Start:           f.Start,
+		End:             end,
+		Duration:        end.Sub(f.Start),
+		BytesToServer:   f.BytesToServer,
+		BytesToClient:   f.BytesToClient,
+		PacketsToServer: f.PacketsToServer,
+		PacketsToClient: f.PacketsToClient,
+		HandshakeRTT:    f.HandshakeRTT,
+		RTT:             f.rtt.stats(),
+		ClientAnalysis:  f.Analysis[ClientToServer],
+		ServerAnalysis:  f.Analysis[ServerToClient],
+		LossRate:        total.LossRate(),
+		FinalState:      finalState,
+		CloseReason:     f.closeReason,
+		QUICVersion:     f.QUICVersion,
+	}
+}
+
+// 根据TCP标志位推进状态机，返回连接是否在本包后结束
+func (f *Flow) advance(dir Direction, flags string, now time.Time) bool {
+	syn := strings.Contains(flags, "SYN")
+	ack := strings.Contains(flags, "ACK")
+	fin := strings.Contains(flags, "FIN")
+	rst := strings.Contains(flags, "RST")
+
+	if rst {
+		f.State = StateClosed
+		f.closeReason = CloseRST
+		return true
+	}
+
+	switch {
+	case syn && !ack && dir == ClientToServer:
+		if f.State == StateMidstream || f.State == StateSynSent {
+			f.State = StateSynSent
+			f.SynTime = now
+		}
+	case syn && ack && dir == ServerToClient:
+		if f.State == StateSynSent || f.State == StateSynReceived {
+			f.State = StateSynReceived
+			f.SynAckTime = now
+		}
+	case ack && dir == ClientToServer && f.State == StateSynReceived:
+		f.State = StateEstablished
+		f.HandshakeRTT = now.Sub(f.SynTime)
+	}
+
+	if fin {
+		if dir == ClientToServer {
+			f.finFromClient = true
+		} else {
+			f.finFromServer = true
+		}
+		f.State = StateClosing
+		return false
+	}
+	// 双方均已发送FIN，收到最后的ACK后连接结束
+	if f.finFromClient && f.finFromServer && ack {
+		f.State = StateClosed
+		f.closeReason = CloseFIN
+		return true
+	}
+	return false
+}
+
+// FlowTable 双向连接表，连接关闭或超时后通过onClose输出一次FlowRecord；处理线程池的每个分片各有一个连接表
+type FlowTable struct {
+	mu             sync.Mutex
+	flows          map[FlowKey]*Flow
+	idleTimeout    time.Duration
+	udpIdleTimeout time.Duration
+	// 已关闭连接保留一段时间，以吸收关闭后迟到的ACK/重传，避免被识别为新连接
+	linger  time.Duration
+	onClose func(FlowRecord)
+
+	// QUIC连接ID索引，连接迁移（五元组变化）后仍能归入同一连接；
+	// quicIDLens 按服务端记录已登记的连接ID长度及个数，用于确定短包头中连接ID的长度
+	quicIDs    map[string]*Flow
+	quicIDLens map[Endpoint]map[int]int
+
+	// 以数据包时间为准的时钟，离线回放时同样适用
+	lastPacket time.Time
+	lastWall   time.Time
+}
+
+func NewFlowTable(idleTimeout time.Duration, udpIdleTimeout time.Duration, onClose func(FlowRecord)) *FlowTable {
+	return &FlowTable{
+		flows:          make(map[FlowKey]*Flow),
+		idleTimeout:    idleTimeout,
+		udpIdleTimeout: udpIdleTimeout,
+		linger:         5 * time.Second,
+		onClose:        onClose,
+		quicIDs:        make(map[string]*Flow),
+		quicIDLens:     make(map[Endpoint]map[int]int),
+	}
+}
+
+// 当前时间：最近数据包时间加上此后经过的实际时间
+func (t *FlowTable) now() time.Time {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.lastPacket.IsZero() {
+		return time.Now()
+	}
+	return t.lastPacket.Add(time.Since(t.lastWall))
+}
+
+// 推进数据包时钟，需持有t.mu
+func (t *FlowTable) tick(ts time.Time) {
+	if ts.After(t.lastPacket) {
+		t.lastPacket = ts
+		t.lastWall = time.Now()
+	}
+}
+
+// 知名端口上限，端口号小于该值的一端视为服务端
+const wellKnownPortLimit = 1024
+
+// 未观察到握手时推断数据包源端是否为发起方：仅一端为知名端口时该端为服务端；
+// 否则仅一端位于基站网段时该端为用户；均无法判断时取源端
+func guessSrcIsClient(src, dst Endpoint) bool {
+	if srcWellKnown, dstWellKnown := src.Port < wellKnownPortLimit, dst.Port < wellKnownPortLimit; srcWellKnown != dstWellKnown {
+		return dstWellKnown
+	}
+	if srcLocal, dstLocal := attribution.InSubnet(src.IP), attribution.InSubnet(dst.IP); srcLocal != dstLocal {
+		return srcLocal
+	}
+	return true
+}
+
+// 查找或创建数据包所属连接，需持有t.mu；srcIsClient 表示新建连接时以源端作为发起方
+func (t *FlowTable) lookupLocked(packet capture.PacketInfo, src, dst Endpoint, srcIsClient bool) *Flow {
+	key := newFlowKey(packet.Protocol, src, dst)
+	flow, exists := t.flows[key]
+	if !exists {
+		flow = &Flow{
+			Key:       key,
+			Client:    src,
+			Server:    dst,
+			ClientMAC: packet.SrcMAC,
+			State:     StateMidstream,
+			Start:     packet.Timestamp,
+			LastSeen:  packet.Timestamp,
+		}
+		gatewayMAC := packet.DstMAC
+		if !srcIsClient {
+			flow.Client, flow.Server, flow.ClientMAC = dst, src, packet.DstMAC
+			gatewayMAC = packet.SrcMAC
+		}
+		// 连接建立时按归属规则判定基站，之后规则变化不影响已有连接
+		flow.StationID = attribution.Resolve(attribution.Input{
+			Device:     packet.Device,
+			VLAN:       packet.VLAN,
+			ClientIP:   flow.Client.IP,
+			GatewayMAC: gatewayMAC,
+		})
+		t.flows[key] = flow
+	}
+	return flow
+}
+
+// 数据包相对于连接发起方的方向，需持有f.mux
+func (f *Flow) directionOf(src Endpoint) Direction {
+	if src == f.Client {
+		return ClientToServer
+	}
+	return ServerToClient
+}
+
+// TrackTCP 在连接表中处理一个TCP数据包
+func (t *FlowTable) TrackTCP(packet capture.PacketInfo) PacketResult {
+	tcpInfo := packet.TCPInfo
+	src := Endpoint{IP: packet.SourceIP, Port: tcpInfo.SrcPort}
+	dst := Endpoint{IP: packet.DestIP, Port: tcpInfo.DstPort}
+	syn := strings.Contains(tcpInfo.Flags, "SYN")
+	ack := strings.Contains(tcpInfo.Flags, "ACK")
+	// 首个数据包为SYN时发起方是源端，为SYN-ACK时是目的端，其余情况按端口与网段推断
+	srcIsClient := syn && !ack
+	if !syn {
+		srcIsClient = guessSrcIsClient(src, dst)
+	}
+
+	t.mu.Lock()
+	t.tick(packet.Timestamp)
+	flow := t.lookupLocked(packet, src, dst, srcIsClient)
+	// 在释放t.mu前获取连接锁，避免Expire在此间隙输出并移除该连接，使数据包计入已输出的连接
+	flow.mux.Lock()
+	if syn && !ack && flow.State == StateClosed {
+		// 保留期内收到新的SYN（端口复用），旧连接已输出，开始新的连接
+		t.removeLocked(flow.Key, flow)
+		flow.mux.Unlock()
+		flow = t.lookupLocked(packet, src, dst, true)
+		flow.mux.Lock()
+	}
+	t.mu.Unlock()
+
+	result, closed := flow.update(flow.directionOf(src), packet)
+	var record FlowRecord
+	if closed {
+		record = flow.record(packet.Timestamp)
+	}
+	flow.mux.Unlock()
+
+	if closed && t.onClose != nil {
+		t.onClose(record)
+	}
+	return result
+}
+
+func (f *Flow) update(dir Direction, packet capture.PacketInfo) (PacketResult, bool) {
+	tcpInfo := packet.TCPInfo
+	now := packet.Timestamp
+	// 连接已关闭，仅吸收迟到的数据包
+	if f.State == StateClosed {
+		f.LastSeen = now
+		return PacketResult{StationID: f.StationID, MAC: f.ClientMAC, UserIP: f.Client.IP, RemoteIP: f.Server.IP}, false
+	}
+
+	if dir == ClientToServer {
+		f.BytesToServer += uint64(tcpInfo.PayloadSize)
+		f.PacketsToServer++
+	} else {
+		f.BytesToClient += uint64(tcpInfo.PayloadSize)
+		f.PacketsToClient++
+	}
+	if now.After(f.LastSeen) {
+		f.LastSeen = now
+	}
+
+	dataSegments := f.Analysis[dir].DataSegments
+	kind := analyzeSegment(&f.directions[dir], &f.directions[1-dir], &f.Analysis[dir], tcpInfo, now, f.rtt.current())
+	f.rtt.observe(dir, tcpInfo, segmentLength(tcpInfo), kind, now)
+
+	closed := f.advance(dir, tcpInfo.Flags, now)
+	return PacketResult{
+		StationID:   f.StationID,
+		MAC:         f.ClientMAC,
+		UserIP:      f.Client.IP,
+		RemoteIP:    f.Server.IP,
+		Payload:     uint(tcpInfo.PayloadSize),
+		Latency:     uint(f.rtt.current().Milliseconds()),
+		LossFlag:    kind.Lost(),
+		DataSegment: f.Analysis[dir].DataSegments > dataSegments,
+		Kind:        kind,
+	}, closed
+}
+
+// Expire 输出并移除空闲超时的连接，同时清理已过保留期的已关闭连接
+func (t *FlowTable) Expire() {
+	now := t.now()
+	var expired []FlowRecord
+
+	t.mu.Lock()
+	for key, flow := range t.flows {
+		timeout := t.idleTimeout
+		if key.Protocol != "TCP" {
+			timeout = t.udpIdleTimeout
+		}
+		flow.mux.Lock()
+		idle := now.Sub(flow.LastSeen)
+		switch {
+		case flow.State == StateClosed && idle > t.linger:
+			t.removeLocked(key, flow)
+		case flow.State != StateClosed && idle > timeout:
+			flow.closeReason = CloseTimeout
+			expired = append(expired, flow.record(flow.LastSeen))
+			t.removeLocked(key, flow)
+		}
+		flow.mux.Unlock()
+	}
+	t.mu.Unlock()
+
+	if t.onClose != nil {
+		for _, record := range expired {
+			t.onClose(record)
+		}
+	}
+}
+
+// CloseAll 以reason输出并移除全部未关闭的连接，用于退出前输出连接记录
+func (t *FlowTable) CloseAll(reason string) {
+	var closed []FlowRecord
+
+	t.mu.Lock()
+	for key, flow := range t.flows {
+		flow.mux.Lock()
+		if flow.State != StateClosed {
+			flow.closeReason = reason
+			closed = append(closed, flow.record(flow.LastSeen))
+		}
+		t.removeLocked(key, flow)
+		flow.mux.Unlock()
+	}
+	t.mu.Unlock()
+
+	if t.onClose != nil {
+		for _, record := range closed {
+			t.onClose(record)
+		}
+	}
+}
+
+func (t *FlowTable) removeLocked(key FlowKey, flow *Flow) {
+	delete(t.flows, key)
+	lens := t.quicIDLens[flow.quicServer]
+	for _, id := range flow.quicIDs {
+		delete(t.quicIDs, id)
+		if lens[len(id)]--; lens[len(id)] <= 0 {
+			delete(lens, len(id))
+		}
+	}
+	if lens != nil && len(lens) == 0 {
+		delete(t.quicIDLens, flow.quicServer)
+	}
+}
+
+// Len 当前跟踪的连接数
+func (t *FlowTable) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.flows)
+}
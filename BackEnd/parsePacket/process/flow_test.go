@@ -0,0 +1,233 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"UserPortrait/parsePacket/attribution"
+	"UserPortrait/parsePacket/capture"
+)
+
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	testClient = Endpoint{IP: "10.0.0.2", Port: 50000}
+	testServer = Endpoint{IP: "93.184.216.34", Port: 443}
+)
+
+// 测试用TCP报文段，at为相对testStart的毫秒数
+type segment struct {
+	fromClient bool
+	flags      string
+	seq, ack   uint32
+	payload    uint32
+	at         int
+}
+
+func (s segment) packet() capture.PacketInfo {
+	src, dst := testClient, testServer
+	srcMAC, dstMAC := "aa:aa:aa:aa:aa:aa", "bb:bb:bb:bb:bb:bb"
+	if !s.fromClient {
+		src, dst = dst, src
+		srcMAC, dstMAC = dstMAC, srcMAC
+	}
+	return capture.PacketInfo{
+		Timestamp: testStart.Add(time.Duration(s.at) * time.Millisecond),
+		SrcMAC:    srcMAC,
+		DstMAC:    dstMAC,
+		SourceIP:  src.IP,
+		DestIP:    dst.IP,
+		Protocol:  "TCP",
+		TCPInfo: &capture.TCPInfo{
+			SrcPort:     src.Port,
+			DstPort:     dst.Port,
+			SeqNum:      s.seq,
+			AckNum:      s.ack,
+			PayloadSize: s.payload,
+			Window:      65535,
+			Flags:       s.flags,
+		},
+	}
+}
+
+var handshake = []segment{
+	{fromClient: true, flags: "SYN", seq: 100, at: 0},
+	{fromClient: false, flags: "SYN|ACK", seq: 500, ack: 101, at: 20},
+	{fromClient: true, flags: "ACK", seq: 101, ack: 501, at: 21},
+}
+
+func TestFlowTableTCPStates(t *testing.T) {
+	tests := []struct {
+		name        string
+		segments    []segment
+		wantRecords int
+		wantState   string
+		wantReason  string
+		wantClient  Endpoint
+		wantRTT     time.Duration
+	}{
+		{
+			name:        "handshake",
+			segments:    handshake,
+			wantRecords: 0,
+			wantState:   "ESTABLISHED",
+			wantClient:  testClient,
+			wantRTT:     21 * time.Millisecond,
+		},
+		{
+			name: "fin teardown",
+			segments: append(append([]segment{}, handshake...),
+				segment{fromClient: true, flags: "FIN|ACK", seq: 101, ack: 501, at: 30},
+				segment{fromClient: false, flags: "FIN|ACK", seq: 501, ack: 102, at: 40},
+				segment{fromClient: true, flags: "ACK", seq: 102, ack: 502, at: 41},
+			),
+			wantRecords: 1,
+			wantState:   "CLOSED",
+			wantReason:  CloseFIN,
+			wantClient:  testClient,
+			wantRTT:     21 * time.Millisecond,
+		},
+		{
+			name: "reset",
+			segments: append(append([]segment{}, handshake...),
+				segment{fromClient: false, flags: "RST", seq: 501, at: 30},
+			),
+			wantRecords: 1,
+			wantState:   "CLOSED",
+			wantReason:  CloseRST,
+			wantClient:  testClient,
+			wantRTT:     21 * time.Millisecond,
+		},
+		{
+			name: "first packet syn-ack",
+			segments: []segment{
+				{fromClient: false, flags: "SYN|ACK", seq: 500, ack: 101, at: 0},
+				{fromClient: true, flags: "ACK", seq: 101, ack: 501, at: 1},
+			},
+			// 未观察到SYN，仅据SYN-ACK确定发起方
+			wantState:  "MIDSTREAM",
+			wantClient: testClient,
+		},
+		{
+			name: "midstream",
+			segments: []segment{
+				{fromClient: true, flags: "PSH|ACK", seq: 1000, ack: 2000, payload: 100, at: 0},
+			},
+			wantState:  "MIDSTREAM",
+			wantClient: testClient,
+		},
+		{
+			name: "midstream first packet from server",
+			segments: []segment{
+				{fromClient: false, flags: "PSH|ACK", seq: 2000, ack: 1000, payload: 100, at: 0},
+				{fromClient: true, flags: "ACK", seq: 1000, ack: 2100, at: 1},
+			},
+			// 未观察到握手时按知名端口确定发起方，而非取首个数据包的源端
+			wantState:  "MIDSTREAM",
+			wantClient: testClient,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []FlowRecord
+			table := NewFlowTable(time.Minute, time.Minute, func(r FlowRecord) { records = append(records, r) })
+			for _, s := range tt.segments {
+				table.TrackTCP(s.packet())
+			}
+			if len(records) != tt.wantRecords {
+				t.Fatalf("got %d records, want %d", len(records), tt.wantRecords)
+			}
+			if tt.wantRecords == 0 {
+				table.CloseAll(CloseShutdown)
+				if len(records) != 1 {
+					t.Fatalf("CloseAll emitted %d records, want 1", len(records))
+				}
+				tt.wantReason = CloseShutdown
+			}
+			r := records[0]
+			if r.FinalState != tt.wantState || r.CloseReason != tt.wantReason {
+				t.Errorf("state/reason = %s/%s, want %s/%s", r.FinalState, r.CloseReason, tt.wantState, tt.wantReason)
+			}
+			if r.Client != tt.wantClient {
+				t.Errorf("client = %v, want %v", r.Client, tt.wantClient)
+			}
+			if r.HandshakeRTT != tt.wantRTT {
+				t.Errorf("handshake rtt = %v, want %v", r.HandshakeRTT, tt.wantRTT)
+			}
+		})
+	}
+}
+
+func TestGuessSrcIsClient(t *testing.T) {
+	if err := attribution.SetRules([]attribution.Rule{{StationID: 1, Subnets: []string{"10.0.0.0/8"}}}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { attribution.SetRules(nil) })
+	user := Endpoint{IP: "10.1.2.3", Port: 50000}
+	tests := []struct {
+		name     string
+		src, dst Endpoint
+		want     bool
+	}{
+		{"to well-known port", user, Endpoint{IP: "93.184.216.34", Port: 443}, true},
+		{"from well-known port", Endpoint{IP: "93.184.216.34", Port: 53}, user, false},
+		// 端口无法区分时按基站网段判断
+		{"both ephemeral from station subnet", user, Endpoint{IP: "93.184.216.34", Port: 6881}, true},
+		{"both ephemeral to station subnet", Endpoint{IP: "93.184.216.34", Port: 6881}, user, false},
+		{"both well-known to station subnet", Endpoint{IP: "93.184.216.34", Port: 123}, Endpoint{IP: "10.1.2.3", Port: 123}, false},
+		// 均无法判断时取源端
+		{"both in station subnet", user, Endpoint{IP: "10.9.9.9", Port: 6881}, true},
+		{"neither in station subnet", Endpoint{IP: "93.184.216.34", Port: 6881}, Endpoint{IP: "1.1.1.1", Port: 50000}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guessSrcIsClient(tt.src, tt.dst); got != tt.want {
+				t.Fatalf("guessSrcIsClient(%v, %v) = %t, want %t", tt.src, tt.dst, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlowTableSynDuringLinger(t *testing.T) {
+	var records []FlowRecord
+	table := NewFlowTable(time.Minute, time.Minute, func(r FlowRecord) { records = append(records, r) })
+	for _, s := range append(append([]segment{}, handshake...),
+		segment{fromClient: true, flags: "RST", seq: 101, at: 30},
+		// 关闭后迟到的ACK被旧连接吸收
+		segment{fromClient: false, flags: "ACK", seq: 501, ack: 101, at: 35},
+		// 保留期内同一四元组的新SYN开始新连接
+		segment{fromClient: true, flags: "SYN", seq: 9000, at: 1000},
+		segment{fromClient: false, flags: "SYN|ACK", seq: 7000, ack: 9001, at: 1010},
+		segment{fromClient: true, flags: "ACK", seq: 9001, ack: 7001, at: 1011},
+	) {
+		table.TrackTCP(s.packet())
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records before shutdown, want 1", len(records))
+	}
+	if records[0].PacketsToClient != 1 {
+		t.Errorf("closed flow counted %d packets to client, want 1", records[0].PacketsToClient)
+	}
+	table.CloseAll(CloseShutdown)
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	if r := records[1]; r.FinalState != "ESTABLISHED" || r.HandshakeRTT != 11*time.Millisecond || r.PacketsToServer != 2 {
+		t.Errorf("new flow = %s rtt %v packets %d, want ESTABLISHED rtt 11ms packets 2", r.FinalState, r.HandshakeRTT, r.PacketsToServer)
+	}
+}
+
+func TestFlowTableExpire(t *testing.T) {
+	var records []FlowRecord
+	table := NewFlowTable(time.Second, time.Second, func(r FlowRecord) { records = append(records, r) })
+	table.TrackTCP(segment{fromClient: true, flags: "SYN", seq: 100, at: 0}.packet())
+	// 以数据包时钟为准，回放的历史数据同样按空闲时间过期
+	table.lastWall = table.lastWall.Add(-2 * time.Second)
+	table.Expire()
+	if len(records) != 1 || records[0].CloseReason != CloseTimeout {
+		t.Fatalf("records = %+v, want one timeout record", records)
+	}
+	if table.Len() != 0 {
+		t.Fatalf("table still holds %d flows", table.Len())
+	}
+}
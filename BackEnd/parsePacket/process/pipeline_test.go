@@ -0,0 +1,92 @@
+package process
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"UserPortrait/etc"
+	"UserPortrait/parsePacket/capture"
+	"UserPortrait/service"
+	"UserPortrait/service/database"
+)
+
+// 合成数据包经处理线程池与聚合器写入SQLite，检查写库结果
+func TestPipelineToSQLite(t *testing.T) {
+	db, err := database.Open(database.Options{Driver: database.DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	service.InitContainer(service.NewSQLContainer(db))
+	if err := service.InitAggregator(time.Hour, "", 1000); err != nil {
+		t.Fatal(err)
+	}
+
+	segments := append(append([]segment{}, handshake...),
+		segment{fromClient: true, flags: "PSH|ACK", seq: 101, ack: 501, payload: 100, at: 30},
+		segment{fromClient: false, flags: "ACK", seq: 501, ack: 201, at: 50},
+		segment{fromClient: true, flags: "PSH|ACK", seq: 201, ack: 501, payload: 300, at: 60},
+		// 重传
+		segment{fromClient: true, flags: "PSH|ACK", seq: 201, ack: 501, payload: 300, at: 400},
+		segment{fromClient: false, flags: "ACK", seq: 501, ack: 501, at: 420},
+	)
+	var packets []capture.PacketInfo
+	for _, s := range segments {
+		packets = append(packets, s.packet())
+	}
+	source := capture.NewSliceSource("test", packets)
+	ch := make(chan capture.PacketInfo)
+	go func() {
+		defer close(ch)
+		if err := source.Run(context.Background(), ch); err != nil {
+			t.Error(err)
+		}
+	}()
+	CapturePackets(ch, PoolConfig{Workers: 4, QueueDepth: 8, Policy: PolicyBlock})
+	if err := service.StopAggregator(); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []etc.Userinfo
+	db.Table("user_info").Find(&users)
+	if len(users) != 1 || users[0].MacInfo != "aa:aa:aa:aa:aa:aa" {
+		t.Fatalf("users = %+v, want only the client MAC", users)
+	}
+	var records []etc.Universe
+	db.Table("universe").Find(&records)
+	if len(records) != 1 {
+		t.Fatalf("got %d universe rows, want 1: %+v", len(records), records)
+	}
+	r := records[0]
+	if r.UserID != users[0].ID || r.Ip != testClient.IP || r.RemoteIp != testServer.IP || r.StationID != etc.UnassignedStation {
+		t.Errorf("universe row = user %d ip %s remote %s station %d", r.UserID, r.Ip, r.RemoteIp, r.StationID)
+	}
+	if r.Count != uint(len(segments)) || r.Flow != 700 || r.ErrCount != 1 || r.LocSource != etc.LocPending {
+		t.Errorf("universe counters = count %d flow %d errors %d source %q, want %d 700 1 pending",
+			r.Count, r.Flow, r.ErrCount, r.LocSource, len(segments))
+	}
+	// SYN、SYN-ACK与3个数据段（含重传）计入丢包率的分母，纯ACK不计入
+	if r.DataSegments != 5 {
+		t.Errorf("universe data segments %d, want 5", r.DataSegments)
+	}
+	if r.LatencySamples == 0 || r.LatencySamples > r.Count || r.Latency == 0 {
+		t.Errorf("universe latency %d from %d samples", r.Latency, r.LatencySamples)
+	}
+
+	var stations []etc.BaseStation
+	db.Table("base_station").Find(&stations)
+	if len(stations) != 1 {
+		t.Fatalf("got %d base_station rows, want 1", len(stations))
+	}
+	st := stations[0]
+	if st.ConnCount != r.Count || st.TotalFlow != r.Flow || st.ErrCount != r.ErrCount || st.DataSegments != r.DataSegments ||
+		st.AveLatency != r.Latency || st.LatencySamples != r.LatencySamples {
+		t.Errorf("base_station row %+v does not match universe row %+v", st, r)
+	}
+	if st.LossRate != 1.0/5 {
+		t.Errorf("base_station loss rate %f, want 0.2", st.LossRate)
+	}
+}
@@ -0,0 +1,194 @@
+package process
+
+import (
+	"fmt"
+	"hash/fnv"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+// QueuePolicy 分片队列已满时的处理策略
+type QueuePolicy string
+
+const (
+	// PolicyBlock 阻塞等待，不丢包，但会反压上游抓包
+	PolicyBlock QueuePolicy = "block"
+	// PolicyDrop 直接丢弃
+	PolicyDrop QueuePolicy = "drop"
+	// PolicySample 每SampleRate个包阻塞保留1个，其余丢弃
+	PolicySample QueuePolicy = "sample"
+)
+
+// PoolConfig 处理线程池配置
+type PoolConfig struct {
+	Workers    int
+	QueueDepth int
+	Policy     QueuePolicy
+	SampleRate int
+}
+
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		Workers:    runtime.NumCPU(),
+		QueueDepth: 1024,
+		Policy:     PolicyBlock,
+		SampleRate: 10,
+	}
+}
+
+// Validate 检查配置是否合法
+func (cfg PoolConfig) Validate() error {
+	if cfg.Workers <= 0 {
+		return fmt.Errorf("invalid worker count %d", cfg.Workers)
+	}
+	if cfg.QueueDepth < 0 {
+		return fmt.Errorf("invalid queue depth %d", cfg.QueueDepth)
+	}
+	switch cfg.Policy {
+	case PolicyBlock, PolicyDrop:
+	case PolicySample:
+		if cfg.SampleRate <= 0 {
+			return fmt.Errorf("invalid sample rate %d", cfg.SampleRate)
+		}
+	default:
+		return fmt.Errorf("unknown queue policy %q", cfg.Policy)
+	}
+	return nil
+}
+
+// PoolStats 处理计数
+type PoolStats struct {
+	Workers   int    `json:"workers"`
+	Queued    int    `json:"queued"`
+	Processed uint64 `json:"processed"`
+	Dropped   uint64 `json:"dropped"`
+	Failed    uint64 `json:"failed"`
+}
+
+// Pool 按连接分片的处理线程池：同一连接的数据包总由同一worker按序处理，不同连接并行处理；
+// handler 的 shard 参数为处理该包的分片序号，同一分片的调用不会并发，可用于访问按分片划分的状态
+type Pool struct {
+	cfg     PoolConfig
+	handler func(shard int, packet capture.PacketInfo) error
+	queues  []chan capture.PacketInfo
+	wg      sync.WaitGroup
+
+	overflow  uint64 // 队列满的次数，用于sample策略，仅由分发协程访问
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	failed    atomic.Uint64
+}
+
+func NewPool(cfg PoolConfig, handler func(shard int, packet capture.PacketInfo) error) *Pool {
+	p := &Pool{cfg: cfg, handler: handler}
+	for i := 0; i < cfg.Workers; i++ {
+		p.queues = append(p.queues, make(chan capture.PacketInfo, cfg.QueueDepth))
+	}
+	return p
+}
+
+// Run 启动worker并分发数据包，packets关闭且所有队列处理完毕后返回
+func (p *Pool) Run(packets <-chan capture.PacketInfo) {
+	for shard, queue := range p.queues {
+		p.wg.Add(1)
+		go p.work(shard, queue)
+	}
+	for packet := range packets {
+		p.dispatch(packet)
+	}
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+func (p *Pool) dispatch(packet capture.PacketInfo) {
+	queue := p.queues[shardOf(packet, len(p.queues))]
+	select {
+	case queue <- packet:
+		return
+	default:
+	}
+	// 队列已满
+	switch p.cfg.Policy {
+	case PolicyDrop:
+		p.dropped.Add(1)
+	case PolicySample:
+		p.overflow++
+		if p.overflow%uint64(p.cfg.SampleRate) != 0 {
+			p.dropped.Add(1)
+			return
+		}
+		queue <- packet
+	default:
+		queue <- packet
+	}
+}
+
+func (p *Pool) work(shard int, queue <-chan capture.PacketInfo) {
+	defer p.wg.Done()
+	for packet := range queue {
+		if err := p.handle(shard, packet); err != nil {
+			p.failed.Add(1)
+			fmt.Printf("process packet %s -> %s failed: %v\n", packet.SourceIP, packet.DestIP, err)
+			continue
+		}
+		p.processed.Add(1)
+	}
+}
+
+// 单个数据包的处理错误或panic不影响其他数据包
+func (p *Pool) handle(shard int, packet capture.PacketInfo) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return p.handler(shard, packet)
+}
+
+func (p *Pool) Stats() PoolStats {
+	queued := 0
+	for _, queue := range p.queues {
+		queued += len(queue)
+	}
+	return PoolStats{
+		Workers:   len(p.queues),
+		Queued:    queued,
+		Processed: p.processed.Load(),
+		Dropped:   p.dropped.Load(),
+		Failed:    p.failed.Load(),
+	}
+}
+
+// 按归一化五元组选择分片，同一连接两个方向的数据包落在同一分片；
+// QUIC连接迁移后五元组变化而服务端地址不变，QUIC端口上的UDP报文（含未能解析包头的）按服务端地址分片，
+// 迁移前后仍由同一worker及其连接表处理；服务端的判定与连接表一致
+func shardOf(packet capture.PacketInfo, shards int) int {
+	var srcPort, dstPort uint16
+	switch {
+	case packet.TCPInfo != nil:
+		srcPort, dstPort = packet.TCPInfo.SrcPort, packet.TCPInfo.DstPort
+	case packet.UDPInfo != nil:
+		srcPort, dstPort = packet.UDPInfo.SrcPort, packet.UDPInfo.DstPort
+	}
+	src, dst := Endpoint{IP: packet.SourceIP, Port: srcPort}, Endpoint{IP: packet.DestIP, Port: dstPort}
+	key := newFlowKey(packet.Protocol, src, dst)
+	if packet.UDPInfo != nil && (packet.UDPInfo.QUIC != nil || srcPort == capture.QUICPort || dstPort == capture.QUICPort) {
+		server := dst
+		if !guessSrcIsClient(src, dst) {
+			server = src
+		}
+		key = FlowKey{Protocol: packet.Protocol, Low: server, High: server}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key.Protocol))
+	h.Write([]byte(key.Low.IP + ":" + strconv.Itoa(int(key.Low.Port))))
+	h.Write([]byte(key.High.IP + ":" + strconv.Itoa(int(key.High.Port))))
+	return int(h.Sum32() % uint32(shards))
+}
@@ -0,0 +1,154 @@
+package process
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+func TestShardOf(t *testing.T) {
+	client := Endpoint{IP: "10.0.0.2", Port: 50000}
+	migrated := Endpoint{IP: "10.0.1.7", Port: 41000}
+	server := Endpoint{IP: "142.250.1.1", Port: 443}
+	tcp := func(src, dst Endpoint) capture.PacketInfo {
+		return capture.PacketInfo{SourceIP: src.IP, DestIP: dst.IP, Protocol: "TCP",
+			TCPInfo: &capture.TCPInfo{SrcPort: src.Port, DstPort: dst.Port}}
+	}
+	quic := func(src, dst Endpoint) capture.PacketInfo {
+		return quicPacket(src, dst, shortHeader("5e5e5e5e"), 100, 0)
+	}
+	udp := func(src, dst Endpoint) capture.PacketInfo {
+		return quicPacket(src, dst, nil, 100, 0)
+	}
+	tests := []struct {
+		name string
+		a, b capture.PacketInfo
+	}{
+		{"tcp both directions", tcp(client, server), tcp(server, client)},
+		{"quic both directions", quic(client, server), quic(server, client)},
+		{"quic after client migration", quic(client, server), quic(migrated, server)},
+		{"quic to migrated client", quic(client, server), quic(server, migrated)},
+		// 每个分片有独立的连接表，QUIC端口上未能解析包头的报文须与同一连接的QUIC报文落在同一分片
+		{"unparsed packet on quic port", quic(client, server), udp(server, client)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, shards := range []int{1, 3, 8, 64} {
+				if a, b := shardOf(tt.a, shards), shardOf(tt.b, shards); a != b {
+					t.Fatalf("%d shards: %d != %d", shards, a, b)
+				}
+			}
+		})
+	}
+}
+
+func TestPoolPreservesPerFlowOrder(t *testing.T) {
+	const flows, perFlow = 32, 200
+	tests := []struct {
+		name string
+		cfg  PoolConfig
+	}{
+		{"single worker", PoolConfig{Workers: 1, QueueDepth: 4, Policy: PolicyBlock}},
+		{"many workers", PoolConfig{Workers: 8, QueueDepth: 4, Policy: PolicyBlock}},
+		{"unbuffered", PoolConfig{Workers: 4, QueueDepth: 0, Policy: PolicyBlock}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			seen := map[string][]uint32{}
+			shards := map[string]int{}
+			pool := NewPool(tt.cfg, func(shard int, packet capture.PacketInfo) error {
+				mu.Lock()
+				defer mu.Unlock()
+				seen[packet.SourceIP] = append(seen[packet.SourceIP], packet.TCPInfo.SeqNum)
+				if first, ok := shards[packet.SourceIP]; ok && first != shard {
+					t.Errorf("flow %s handled by shard %d and %d", packet.SourceIP, first, shard)
+				}
+				shards[packet.SourceIP] = shard
+				return nil
+			})
+			packets := make(chan capture.PacketInfo)
+			go func() {
+				for seq := uint32(0); seq < perFlow; seq++ {
+					for i := 0; i < flows; i++ {
+						packets <- capture.PacketInfo{
+							SourceIP: fmt.Sprintf("10.0.0.%d", i),
+							DestIP:   "93.184.216.34",
+							Protocol: "TCP",
+							TCPInfo:  &capture.TCPInfo{SrcPort: 50000, DstPort: 443, SeqNum: seq},
+						}
+					}
+				}
+				close(packets)
+			}()
+			pool.Run(packets)
+
+			if got := pool.Stats().Processed; got != flows*perFlow {
+				t.Fatalf("processed %d packets, want %d", got, flows*perFlow)
+			}
+			for ip, seqs := range seen {
+				for i, seq := range seqs {
+					if seq != uint32(i) {
+						t.Fatalf("flow %s: packet %d has seq %d, out of order", ip, i, seq)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPoolQueuePolicies(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      QueuePolicy
+		sampleRate  int
+		wantDropped bool
+	}{
+		{"block keeps everything", PolicyBlock, 0, false},
+		{"drop discards on overflow", PolicyDrop, 0, true},
+		{"sample discards on overflow", PolicySample, 100, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			pool := NewPool(PoolConfig{Workers: 1, QueueDepth: 1, Policy: tt.policy, SampleRate: tt.sampleRate}, func(int, capture.PacketInfo) error {
+				<-release
+				return nil
+			})
+			packets := make(chan capture.PacketInfo)
+			done := make(chan struct{})
+			go func() {
+				pool.Run(packets)
+				close(done)
+			}()
+			packet := capture.PacketInfo{SourceIP: "10.0.0.2", DestIP: "10.0.0.3", Protocol: "TCP", TCPInfo: &capture.TCPInfo{}}
+			const total = 10
+			sent := make(chan struct{})
+			go func() {
+				for i := 0; i < total; i++ {
+					packets <- packet
+				}
+				close(packets)
+				close(sent)
+			}()
+			if !tt.wantDropped {
+				// block策略下分发会等待worker，需先放行
+				close(release)
+				<-sent
+			} else {
+				<-sent
+				close(release)
+			}
+			<-done
+			stats := pool.Stats()
+			if stats.Processed+stats.Dropped != total {
+				t.Fatalf("processed %d + dropped %d != %d", stats.Processed, stats.Dropped, total)
+			}
+			if (stats.Dropped > 0) != tt.wantDropped {
+				t.Fatalf("dropped = %d, want dropped %t", stats.Dropped, tt.wantDropped)
+			}
+		})
+	}
+}
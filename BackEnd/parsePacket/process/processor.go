@@ -4,121 +4,112 @@ import (
 	"UserPortrait/etc"
 	"UserPortrait/service"
 	"fmt"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"UserPortrait/parsePacket/capture"
 )
 
-const connectionTimeout = 60 * time.Second
+const (
+	connectionTimeout = 60 * time.Second
+	udpFlowTimeout    = 30 * time.Second
+)
 
-type ConnectionInfo struct {
-	SynTime     time.Time
-	SynAckTime  time.Time
-	AckTime     time.Time
-	Flow        uint
-	LossFlag    bool
-	StationID   uint
-	MAC         string
-	SourceIP    string
-	DestIP      string
-	DestPort    uint16
-	Latency     uint
-	LastSeqNums map[uint32]struct{} // 存储序列号
-	mux         sync.Mutex
-}
+// 为true时逐包与逐连接打印处理结果，仅用于排查问题
+var debugLog atomic.Bool
 
-var connectionMap sync.Map // 替换为 sync.Map
+// SetDebug 开关逐包与逐连接日志，可在运行中切换
+func SetDebug(on bool) {
+	debugLog.Store(on)
+}
 
-// 处理抓包信息
-func processPacket(packet capture.PacketInfo) {
-	tcpInfo := packet.TCPInfo
-	if tcpInfo == nil {
+// 连接结束时的默认处理：调试模式下打印连接记录
+func logFlowRecord(record FlowRecord) {
+	if !debugLog.Load() {
 		return
 	}
+	fmt.Printf("%v:连接结束: %s %s -> %s, MAC: %s, 上行: %d字节/%d包, 下行: %d字节/%d包, 握手时延: %v, RTT(min/avg/p95/抖动): %v/%v/%v/%v, 持续: %v, 重传率: %.4f, 状态: %s, 原因: %s\n",
+		etc.ParseInfo, record.Protocol, record.Client, record.Server, record.ClientMAC,
+		record.BytesToServer, record.PacketsToServer, record.BytesToClient, record.PacketsToClient,
+		record.HandshakeRTT, record.RTT.Min, record.RTT.Avg, record.RTT.P95, record.RTT.Jitter, record.Duration, record.LossRate, record.FinalState, record.CloseReason)
+}
 
-	// 生成连接的唯一标识符
-	connKey := fmt.Sprintf("%s:%d-%s:%d", packet.SourceIP, tcpInfo.SrcPort, packet.DestIP, tcpInfo.DstPort)
-
-	// 从连接表中获取连接
-	value, exists := connectionMap.Load(connKey)
-	var conn *ConnectionInfo
-	if exists {
-		conn = value.(*ConnectionInfo)
-	} else {
-		conn = &ConnectionInfo{
-			MAC:         packet.SrcMAC,
-			SourceIP:    packet.SourceIP,
-			DestIP:      packet.DestIP,
-			DestPort:    tcpInfo.DstPort,
-			StationID:   1,
-			SynTime:     packet.Timestamp,
-			LastSeqNums: make(map[uint32]struct{}),
-		}
-		connectionMap.Store(connKey, conn)
-	}
-
-	conn.LossFlag = false
-	conn.Latency = 0
-	now := packet.Timestamp
-
-	conn.mux.Lock()
-	defer conn.mux.Unlock()
-
-	// 根据 TCP 标志位处理连接建立
-	if strings.Contains(tcpInfo.Flags, "SYN") && !strings.Contains(tcpInfo.Flags, "ACK") {
-		conn.SynTime = now
-	} else if strings.Contains(tcpInfo.Flags, "SYN") && strings.Contains(tcpInfo.Flags, "ACK") {
-		conn.SynAckTime = now
-	} else if strings.Contains(tcpInfo.Flags, "ACK") && !conn.SynAckTime.IsZero() {
-		conn.AckTime = now
-		conn.Latency = uint(conn.AckTime.Sub(conn.SynTime).Milliseconds())
-	}
-
-	// 检查序列号以判断重传
-	if _, exists := conn.LastSeqNums[tcpInfo.SeqNum]; exists {
-		conn.LossFlag = true
-	} else {
-		conn.LastSeqNums[tcpInfo.SeqNum] = struct{}{}
+// 处理抓包信息，table 为该数据包所在分片的连接表
+func processPacket(table *FlowTable, packet capture.PacketInfo) error {
+	var result PacketResult
+	switch {
+	case packet.TCPInfo != nil:
+		result = table.TrackTCP(packet)
+	case packet.UDPInfo != nil:
+		result = table.TrackUDP(packet)
+	default:
+		return nil
 	}
 
 	packetDate := packet.Timestamp.Format("2006-01-02 15:04:05")
-	fmt.Printf("%v:日期: %s, 连接信息: 基站ID: %d, MAC: %s, IP: %s, 流量: %d字节, 延迟: %d毫秒, 丢包标识: %t\n",
-		etc.ParseInfo, packetDate, conn.StationID, conn.MAC, conn.SourceIP, tcpInfo.PayloadSize, conn.Latency, conn.LossFlag)
-	err := service.Packet2Universe(conn.StationID, conn.LossFlag, conn.MAC, conn.SourceIP, packetDate, uint(tcpInfo.PayloadSize), conn.Latency)
+	if debugLog.Load() {
+		fmt.Printf("%v:日期: %s, 连接信息: 基站ID: %d, MAC: %s, IP: %s, 流量: %d字节, 延迟: %d毫秒, 丢包标识: %t\n",
+			etc.ParseInfo, packetDate, result.StationID, result.MAC, result.UserIP, result.Payload, result.Latency, result.LossFlag)
+	}
+	err := service.Packet2Universe(result.StationID, result.LossFlag, result.DataSegment, result.MAC, result.UserIP, result.RemoteIP, packetDate, result.Payload, result.Latency)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("update universe failed: %v", err)
 	}
-	err = service.Packet2BaseStation(conn.StationID, conn.LossFlag, packetDate, uint(tcpInfo.PayloadSize), conn.Latency)
+	err = service.Packet2BaseStation(result.StationID, result.LossFlag, result.DataSegment, packetDate, result.Payload, result.Latency)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("update base station failed: %v", err)
 	}
+	return nil
 }
 
 // 定时清除超时连接
-func cleanStaleConnections() {
-	ticker := time.NewTicker(1 * time.Minute) // 每分钟清理一次
+func cleanStaleConnections(tables []*FlowTable, stop <-chan struct{}) {
+	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		now := time.Now()
-		connectionMap.Range(func(key, value interface{}) bool {
-			conn := value.(*ConnectionInfo)
-			if now.Sub(conn.SynTime) > connectionTimeout {
-				connectionMap.Delete(key) // 删除超时连接
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			for _, table := range tables {
+				table.Expire()
 			}
-			return true
-		})
+		}
 	}
 }
 
-// 主抓包处理函数
-func CapturePackets() {
-	go cleanStaleConnections()
+// 当前运行的处理线程池，供运行指标查询
+var activePool atomic.Pointer[Pool]
 
-	for {
-		packetInfo := <-capture.PacketChannel
-		processPacket(packetInfo)
+// 主抓包处理函数：消费注入的数据包通道，按连接分片交给线程池并行处理，通道关闭且队列处理完毕后返回
+// 数据包可来自 capture.PacketChannel，也可来自任意 capture.PacketSource
+// 每个分片使用独立的双向连接表：同一连接的数据包总落在同一分片，各worker处理数据包时互不争用连接表的锁
+func CapturePackets(packets <-chan capture.PacketInfo, cfg PoolConfig) {
+	tables := make([]*FlowTable, cfg.Workers)
+	for i := range tables {
+		tables[i] = NewFlowTable(connectionTimeout, udpFlowTimeout, logFlowRecord)
+	}
+	stop := make(chan struct{})
+	go cleanStaleConnections(tables, stop)
+
+	pool := NewPool(cfg, func(shard int, packet capture.PacketInfo) error {
+		return processPacket(tables[shard], packet)
+	})
+	activePool.Store(pool)
+	pool.Run(packets)
+
+	// 输入结束后停止清理，并输出仍在跟踪的连接记录
+	close(stop)
+	for _, table := range tables {
+		table.CloseAll(CloseShutdown)
+	}
+}
+
+// GetPoolStats 返回处理线程池的计数，未启动时为空
+func GetPoolStats() PoolStats {
+	if pool := activePool.Load(); pool != nil {
+		return pool.Stats()
 	}
+	return PoolStats{}
 }
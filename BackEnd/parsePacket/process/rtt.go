@@ -0,0 +1,162 @@
+package process
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+// 被动RTT采样参数
+const (
+	maxOutstanding = 64  // 每个方向最多跟踪的未确认报文段
+	maxTSvals      = 64  // 每个方向最多跟踪的待回显时间戳
+	rttWindow      = 128 // 计算P95所保留的最近样本数
+)
+
+// RTTStats 连接的RTT统计；以抓包点为参照，RTT = 抓包点至服务端往返 + 抓包点至客户端往返
+type RTTStats struct {
+	Samples uint64        `json:"samples"`
+	Min     time.Duration `json:"min"`
+	Avg     time.Duration `json:"avg"`
+	P95     time.Duration `json:"p95"`
+	Jitter  time.Duration `json:"jitter"`
+}
+
+type sentSegment struct {
+	end  uint32
+	sent time.Time
+}
+
+type sentTSval struct {
+	val  uint32
+	sent time.Time
+}
+
+// rttEstimator 通过数据/ACK配对与TCP时间戳回显被动估计RTT
+// half[d] 为方向d发出的报文被对端确认所需的时间，即抓包点到方向d接收端的往返时延
+type rttEstimator struct {
+	outstanding [2][]sentSegment
+	tsvals      [2][]sentTSval
+	half        [2]time.Duration
+
+	samples uint64
+	min     time.Duration
+	sum     time.Duration
+	last    time.Duration
+	jitter  float64
+	recent  []time.Duration
+}
+
+// observe 处理一个报文段，kind为序列号分析结果（重传报文段不参与采样，遵循Karn算法）
+func (r *rttEstimator) observe(dir Direction, tcpInfo *capture.TCPInfo, segLen uint32, kind SegmentKind, now time.Time) {
+	peer := 1 - dir
+	// 未置ACK的报文段（如SYN）中确认号与TSecr无意义，不参与确认与回显匹配
+	ack := strings.Contains(tcpInfo.Flags, "ACK")
+
+	// 对端报文被本报文确认：取被完全确认的最新报文段作为样本
+	if ack {
+		var sample time.Duration
+		acked := 0
+		for i, seg := range r.outstanding[peer] {
+			if seqLess(tcpInfo.AckNum, seg.end) {
+				break
+			}
+			sample = now.Sub(seg.sent)
+			acked = i + 1
+		}
+		if acked > 0 {
+			r.outstanding[peer] = r.outstanding[peer][acked:]
+			r.updateHalf(peer, sample)
+		}
+	}
+
+	// 时间戳回显：对端发出的TSval被本报文的TSecr回显
+	if tcpInfo.HasTimestamp {
+		if ack {
+			for i, ts := range r.tsvals[peer] {
+				if ts.val == tcpInfo.TSecr {
+					r.updateHalf(peer, now.Sub(ts.sent))
+					r.tsvals[peer] = r.tsvals[peer][i+1:]
+					break
+				}
+			}
+		}
+		// 仅记录每个TSval首次出现的时间
+		vals := r.tsvals[dir]
+		if len(vals) == 0 || vals[len(vals)-1].val != tcpInfo.TSval {
+			r.tsvals[dir] = appendBounded(vals, sentTSval{val: tcpInfo.TSval, sent: now}, maxTSvals)
+		}
+	}
+
+	if segLen > 0 && kind == SegmentNormal {
+		seg := sentSegment{end: tcpInfo.SeqNum + segLen, sent: now}
+		r.outstanding[dir] = appendBounded(r.outstanding[dir], seg, maxOutstanding)
+	} else if kind.Lost() {
+		// 重传后无法区分ACK对应哪一次发送，丢弃该方向的待确认报文段
+		r.outstanding[dir] = r.outstanding[dir][:0]
+	}
+}
+
+func (r *rttEstimator) updateHalf(dir Direction, sample time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	r.half[dir] = sample
+	// 另一半程未知时仅记录半程，避免低估RTT
+	if r.half[1-dir] > 0 {
+		r.addSample(r.half[ClientToServer] + r.half[ServerToClient])
+	}
+}
+
+func (r *rttEstimator) addSample(sample time.Duration) {
+	if sample <= 0 {
+		return
+	}
+	if r.samples > 0 {
+		// RFC 3550 抖动估计
+		d := float64(sample - r.last)
+		if d < 0 {
+			d = -d
+		}
+		r.jitter += (d - r.jitter) / 16
+	}
+	if r.samples == 0 || sample < r.min {
+		r.min = sample
+	}
+	r.samples++
+	r.sum += sample
+	r.last = sample
+	r.recent = appendBounded(r.recent, sample, rttWindow)
+}
+
+// current 当前平均RTT，无样本时为0
+func (r *rttEstimator) current() time.Duration {
+	if r.samples == 0 {
+		return 0
+	}
+	return r.sum / time.Duration(r.samples)
+}
+
+func (r *rttEstimator) stats() RTTStats {
+	if r.samples == 0 {
+		return RTTStats{}
+	}
+	sorted := slices.Clone(r.recent)
+	slices.Sort(sorted)
+	return RTTStats{
+		Samples: r.samples,
+		Min:     r.min,
+		Avg:     r.current(),
+		P95:     sorted[(len(sorted)*95+99)/100-1],
+		Jitter:  time.Duration(r.jitter),
+	}
+}
+
+func appendBounded[T any](s []T, v T, limit int) []T {
+	if len(s) >= limit {
+		s = append(s[:0], s[len(s)-limit+1:]...)
+	}
+	return append(s, v)
+}
@@ -0,0 +1,95 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	type obs struct {
+		dir          Direction
+		flags        string
+		seq, ack     uint32
+		len          uint32
+		tsval, tsecr uint32 // 均为0时不带时间戳选项
+		kind         SegmentKind
+		at           int // 毫秒
+	}
+	tests := []struct {
+		name        string
+		observed    []obs
+		wantSamples uint64
+		wantAvg     time.Duration
+	}{
+		{
+			name: "data ack pairs in both directions",
+			observed: []obs{
+				{dir: ClientToServer, flags: "PSH|ACK", seq: 1, ack: 1, len: 100, at: 0},
+				{dir: ServerToClient, flags: "ACK", seq: 1, ack: 101, at: 30},
+				{dir: ServerToClient, flags: "PSH|ACK", seq: 1, ack: 101, len: 50, at: 40},
+				{dir: ClientToServer, flags: "ACK", seq: 101, ack: 51, at: 50},
+			},
+			wantSamples: 1,
+			wantAvg:     40 * time.Millisecond,
+		},
+		{
+			name: "one direction only",
+			observed: []obs{
+				{dir: ClientToServer, flags: "PSH|ACK", seq: 1, ack: 1, len: 100, at: 0},
+				{dir: ServerToClient, flags: "ACK", seq: 1, ack: 101, at: 30},
+			},
+			wantSamples: 0,
+		},
+		{
+			name: "segment without ack flag is ignored",
+			observed: []obs{
+				{dir: ClientToServer, flags: "PSH|ACK", seq: 1, ack: 1, len: 100, at: 0},
+				{dir: ServerToClient, flags: "PSH|ACK", seq: 1, ack: 1, len: 50, at: 5},
+				// 未置ACK的报文段携带的确认号无意义，不应确认任何报文段
+				{dir: ServerToClient, flags: "PSH", seq: 51, ack: 0x7fffffff, at: 6},
+				{dir: ClientToServer, flags: "RST", seq: 101, ack: 0x7fffffff, at: 7},
+				{dir: ServerToClient, flags: "ACK", seq: 51, ack: 101, at: 30},
+				{dir: ClientToServer, flags: "ACK", seq: 101, ack: 51, at: 45},
+			},
+			wantSamples: 1,
+			wantAvg:     70 * time.Millisecond,
+		},
+		{
+			name: "retransmission is not sampled",
+			observed: []obs{
+				{dir: ClientToServer, flags: "PSH|ACK", seq: 1, ack: 1, len: 100, at: 0},
+				{dir: ClientToServer, flags: "PSH|ACK", seq: 1, ack: 1, len: 100, kind: SegmentRetransmission, at: 200},
+				{dir: ServerToClient, flags: "ACK", seq: 1, ack: 101, at: 230},
+			},
+			wantSamples: 0,
+		},
+		{
+			name: "timestamp echo",
+			observed: []obs{
+				{dir: ClientToServer, flags: "ACK", seq: 1, ack: 1, tsval: 1000, tsecr: 1, at: 0},
+				{dir: ServerToClient, flags: "ACK", seq: 1, ack: 1, tsval: 5000, tsecr: 1000, at: 20},
+				{dir: ClientToServer, flags: "ACK", seq: 1, ack: 1, tsval: 1010, tsecr: 5000, at: 25},
+			},
+			wantSamples: 1,
+			wantAvg:     25 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r rttEstimator
+			for _, o := range tt.observed {
+				info := &capture.TCPInfo{SeqNum: o.seq, AckNum: o.ack, PayloadSize: o.len, Flags: o.flags}
+				if o.tsval != 0 || o.tsecr != 0 {
+					info.HasTimestamp, info.TSval, info.TSecr = true, o.tsval, o.tsecr
+				}
+				r.observe(o.dir, info, segmentLength(info), o.kind, testStart.Add(time.Duration(o.at)*time.Millisecond))
+			}
+			stats := r.stats()
+			if stats.Samples != tt.wantSamples || stats.Avg != tt.wantAvg {
+				t.Fatalf("samples/avg = %d/%v, want %d/%v", stats.Samples, stats.Avg, tt.wantSamples, tt.wantAvg)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package process
+
+import (
+	"UserPortrait/parsePacket/capture"
+)
+
+// TrackUDP 在连接表中处理一个UDP数据包；UDP连接无状态，按空闲超时结束
+// QUIC报文按连接ID归并，客户端地址迁移后仍记入同一连接
+func (t *FlowTable) TrackUDP(packet capture.PacketInfo) PacketResult {
+	udpInfo := packet.UDPInfo
+	src := Endpoint{IP: packet.SourceIP, Port: udpInfo.SrcPort}
+	dst := Endpoint{IP: packet.DestIP, Port: udpInfo.DstPort}
+	srcIsClient := guessSrcIsClient(src, dst)
+
+	t.mu.Lock()
+	t.tick(packet.Timestamp)
+	// 五元组已知时直接归入该连接，仅在五元组未知时按连接ID查找迁移前的连接
+	flow := t.flows[newFlowKey(packet.Protocol, src, dst)]
+	if flow == nil && udpInfo.QUIC != nil {
+		flow = t.findQUICLocked(udpInfo.QUIC, src, dst)
+	}
+	var dir Direction
+	if flow != nil {
+		// 与连接表相同的加锁顺序，在释放t.mu前获取连接锁
+		flow.mux.Lock()
+		var ok bool
+		if dir, ok = flow.migrate(src, dst, packet); !ok {
+			flow.mux.Unlock()
+			flow = nil
+		}
+	}
+	if flow == nil {
+		flow = t.lookupLocked(packet, src, dst, srcIsClient)
+		flow.mux.Lock()
+		dir = flow.directionOf(src)
+	}
+	if udpInfo.QUIC != nil && udpInfo.QUIC.LongHeader {
+		t.registerQUICLocked(flow, udpInfo.QUIC.DCID, udpInfo.QUIC.SCID)
+	}
+	t.mu.Unlock()
+	defer flow.mux.Unlock()
+
+	now := packet.Timestamp
+	if dir == ClientToServer {
+		flow.BytesToServer += uint64(udpInfo.PayloadSize)
+		flow.PacketsToServer++
+	} else {
+		flow.BytesToClient += uint64(udpInfo.PayloadSize)
+		flow.PacketsToClient++
+	}
+	if now.After(flow.LastSeen) {
+		flow.LastSeen = now
+	}
+	if quic := udpInfo.QUIC; quic != nil && quic.LongHeader {
+		flow.QUIC = true
+		if quic.Version != 0 {
+			flow.QUICVersion = quic.Version
+		}
+	}
+	return PacketResult{
+		StationID: flow.StationID,
+		MAC:       flow.ClientMAC,
+		UserIP:    flow.Client.IP,
+		RemoteIP:  flow.Server.IP,
+		Payload:   uint(udpInfo.PayloadSize),
+	}
+}
+
+// 确定数据包方向，需持有f.mux；若一端与连接记录一致而另一端不同，视为客户端地址迁移并更新记录。
+// 两端均与连接记录不同时不视为迁移，返回false，由调用方另建连接
+func (f *Flow) migrate(src, dst Endpoint, packet capture.PacketInfo) (Direction, bool) {
+	switch {
+	case src == f.Client:
+		return ClientToServer, true
+	case src == f.Server:
+		if dst != f.Client {
+			f.Client, f.ClientMAC = dst, packet.DstMAC
+		}
+		return ServerToClient, true
+	case dst == f.Server:
+		f.Client, f.ClientMAC = src, packet.SrcMAC
+		return ClientToServer, true
+	default:
+		return ClientToServer, false
+	}
+}
+
+// 按连接ID查找QUIC连接，需持有t.mu
+func (t *FlowTable) findQUICLocked(quic *capture.QUICInfo, src, dst Endpoint) *Flow {
+	if quic.LongHeader {
+		for _, id := range []string{quic.DCID, quic.SCID} {
+			if flow, ok := t.quicIDs[id]; ok && id != "" {
+				return flow
+			}
+		}
+		return nil
+	}
+	// 短包头不含连接ID长度：服务端地址不随客户端迁移而变化，仅尝试该服务端上登记过的长度，
+	// 且命中的连接须登记在同一服务端下，避免不同长度的连接ID前缀相同时误归并
+	for _, server := range []Endpoint{dst, src} {
+		for length := range t.quicIDLens[server] {
+			if length > len(quic.ShortHeaderID) {
+				continue
+			}
+			if flow, ok := t.quicIDs[quic.ShortHeaderID[:length]]; ok && flow.quicServer == server {
+				return flow
+			}
+		}
+	}
+	return nil
+}
+
+// 登记长包头中出现的连接ID，需持有t.mu与flow.mux；连接ID的长度记在首次登记时的服务端下
+func (t *FlowTable) registerQUICLocked(flow *Flow, ids ...string) {
+	if len(flow.quicIDs) == 0 {
+		flow.quicServer = flow.Server
+	}
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if _, exists := t.quicIDs[id]; exists {
+			continue
+		}
+		lens := t.quicIDLens[flow.quicServer]
+		if lens == nil {
+			lens = make(map[int]int)
+			t.quicIDLens[flow.quicServer] = lens
+		}
+		t.quicIDs[id] = flow
+		lens[len(id)]++
+		flow.quicIDs = append(flow.quicIDs, id)
+	}
+}
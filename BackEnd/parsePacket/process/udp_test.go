@@ -0,0 +1,112 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"UserPortrait/parsePacket/capture"
+)
+
+func quicPacket(src, dst Endpoint, quic *capture.QUICInfo, payload uint16, at int) capture.PacketInfo {
+	return capture.PacketInfo{
+		Timestamp: testStart.Add(time.Duration(at) * time.Millisecond),
+		SrcMAC:    "aa:aa:aa:aa:aa:aa",
+		DstMAC:    "bb:bb:bb:bb:bb:bb",
+		SourceIP:  src.IP,
+		DestIP:    dst.IP,
+		Protocol:  "UDP",
+		UDPInfo:   &capture.UDPInfo{SrcPort: src.Port, DstPort: dst.Port, PayloadSize: payload, QUIC: quic},
+	}
+}
+
+func longHeader(dcid, scid string) *capture.QUICInfo {
+	return &capture.QUICInfo{LongHeader: true, Version: 1, DCID: dcid, SCID: scid}
+}
+
+func shortHeader(id string) *capture.QUICInfo {
+	// 短包头中连接ID之后紧跟报文号等字节
+	return &capture.QUICInfo{ShortHeaderID: id + "5a5a5a5a"}
+}
+
+func TestFlowTableQUICConnectionIDs(t *testing.T) {
+	client := Endpoint{IP: "10.0.0.2", Port: 50000}
+	migrated := Endpoint{IP: "10.0.1.7", Port: 41000}
+	server := Endpoint{IP: "142.250.1.1", Port: 443}
+	other := Endpoint{IP: "142.250.9.9", Port: 443}
+
+	tests := []struct {
+		name    string
+		packets []capture.PacketInfo
+		// 各连接记录的服务端与上下行包数，按服务端、客户端排序后比较
+		want []FlowRecord
+	}{
+		{
+			name: "client migration keeps the connection",
+			packets: []capture.PacketInfo{
+				quicPacket(client, server, longHeader("01020304", "c1c1c1c1c1c1c1c1"), 1200, 0),
+				quicPacket(server, client, longHeader("c1c1c1c1c1c1c1c1", "5e5e5e5e"), 1200, 10),
+				quicPacket(client, server, shortHeader("5e5e5e5e"), 100, 20),
+				quicPacket(migrated, server, shortHeader("5e5e5e5e"), 100, 30),
+				quicPacket(server, migrated, shortHeader("c1c1c1c1c1c1c1c1"), 100, 40),
+			},
+			want: []FlowRecord{
+				{Client: migrated, Server: server, PacketsToServer: 3, PacketsToClient: 2, QUICVersion: 1},
+			},
+		},
+		{
+			name: "connection id lengths are scoped by server",
+			packets: []capture.PacketInfo{
+				// 服务端server使用8字节连接ID，服务端other使用4字节连接ID，且前者以后者为前缀
+				quicPacket(client, server, longHeader("01020304", "c1c1c1c1"), 1200, 0),
+				quicPacket(server, client, longHeader("c1c1c1c1", "5e5e5e5e0a0b0c0d"), 1200, 10),
+				quicPacket(client, other, longHeader("09090909", "c2c2c2c2"), 1200, 20),
+				quicPacket(other, client, longHeader("c2c2c2c2", "5e5e5e5e"), 1200, 30),
+				quicPacket(migrated, server, shortHeader("5e5e5e5e0a0b0c0d"), 100, 40),
+			},
+			want: []FlowRecord{
+				{Client: migrated, Server: server, PacketsToServer: 2, PacketsToClient: 1, QUICVersion: 1},
+				{Client: client, Server: other, PacketsToServer: 1, PacketsToClient: 1, QUICVersion: 1},
+			},
+		},
+		{
+			name: "known connection id from unrelated endpoints starts a new flow",
+			packets: []capture.PacketInfo{
+				quicPacket(client, server, longHeader("01020304", "c1c1c1c1"), 1200, 0),
+				quicPacket(server, client, longHeader("c1c1c1c1", "5e5e5e5e"), 1200, 10),
+				quicPacket(migrated, other, longHeader("5e5e5e5e", "c1c1c1c1"), 1200, 20),
+			},
+			want: []FlowRecord{
+				{Client: client, Server: server, PacketsToServer: 1, PacketsToClient: 1, QUICVersion: 1},
+				{Client: migrated, Server: other, PacketsToServer: 1, QUICVersion: 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[Endpoint]FlowRecord{}
+			table := NewFlowTable(time.Minute, time.Minute, func(r FlowRecord) { got[r.Server] = r })
+			for _, packet := range tt.packets {
+				table.TrackUDP(packet)
+			}
+			table.CloseAll(CloseShutdown)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d flows, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for _, want := range tt.want {
+				r, ok := got[want.Server]
+				if !ok {
+					t.Fatalf("no flow for server %v", want.Server)
+				}
+				if r.Client != want.Client || r.PacketsToServer != want.PacketsToServer || r.PacketsToClient != want.PacketsToClient ||
+					r.QUICVersion != want.QUICVersion || r.Protocol != "QUIC" {
+					t.Errorf("flow %v = client %v packets %d/%d version %d protocol %s, want client %v packets %d/%d version %d",
+						want.Server, r.Client, r.PacketsToServer, r.PacketsToClient, r.QUICVersion, r.Protocol,
+						want.Client, want.PacketsToServer, want.PacketsToClient, want.QUICVersion)
+				}
+			}
+			if len(table.quicIDs) != 0 || len(table.quicIDLens) != 0 {
+				t.Errorf("connection id index not cleared: %d ids, %d servers", len(table.quicIDs), len(table.quicIDLens))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package routers
+
+import (
+	"UserPortrait/configs"
+	"UserPortrait/middleware"
+	"UserPortrait/service"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// InitRouter 注册全部HTTP接口
+func InitRouter() *gin.Engine {
+	r := gin.Default()
+	// 允许的来源支持热加载，每次请求按当前配置判断
+	CORS := cors.Config{
+		AllowOriginFunc: func(origin string) bool {
+			for _, allowed := range configs.Get().Server.CORSOrigins {
+				if allowed == "*" || allowed == origin {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	r.Use(cors.New(CORS))
+
+	public := r.Group("/public")
+	{
+		public.POST("/register", service.Register)
+		public.POST("/login", service.Login)
+		public.POST("/refresh", service.RefreshToken)
+		public.GET("/getUserBasicInfo", service.GetUserBasicInfo)
+
+		public.POST("/admin_login", service.AdminLogin)
+		public.GET("/getPrediction", service.GetPrediction)
+		public.POST("/triggerTraining", service.TriggerTraining)
+	}
+	private := r.Group("")
+	{
+		// TODO:主页面请求内容，暂用Ping替代
+		private.GET("/main", service.Ping)
+
+		us := private.Group("/user")
+		us.Use(middleware.UserJwtAuthentication())
+		us.POST("/avatar", service.UploadAvatar)
+		us.POST("/score", service.SubmitScore)
+		us.POST("/reset_password", service.ResetPassword)
+		us.POST("/logout", service.Logout)
+		us.POST("/logout_all", service.LogoutAll)
+		us.GET("/getDailyFlow", service.GetUserDailyFlow)
+		us.GET("/getFrequentPlaces", service.GetFreqLocation)
+		// 添加预测接口
+		// us.GET("/getPrediction", service.GetPrediction)
+		sc := private.Group("/score")
+		sc.GET("/average_score", service.GetAverageScore)
+
+		ad := private.Group("/admin")
+		ad.Use(middleware.AdminJwtAuthentication())
+		ad.POST("/admin_register", service.AdminRegister)
+		ad.GET("/getStationInfo", service.GetBaseStationInfo)
+		ad.GET("/stations", service.ListStations)
+		ad.GET("/station", service.GetStation)
+		ad.POST("/station", service.CreateStation)
+		ad.PUT("/station", service.UpdateStation)
+		ad.DELETE("/station", service.DeleteStation)
+		ad.POST("/reloadStationRules", service.ReloadStationRules)
+		ad.POST("/logout", service.Logout)
+		ad.POST("/logout_all", service.LogoutAll)
+		ad.GET("/user", service.LookupUser)
+		ad.GET("/getUserDailyFlow", service.AdminGetUserDailyFlow)
+		ad.GET("/getUserFrequentPlaces", service.AdminGetUserFreqLocation)
+		ad.POST("/impersonate", service.ImpersonateUser)
+		ad.GET("/getRuntimeStats", service.GetRuntimeStats)
+		ad.GET("/config", service.GetConfig)
+		ad.POST("/reloadConfig", service.ReloadConfig)
+		// 添加手动触发训练接口
+		// ad.POST("/triggerTraining", service.TriggerTraining)
+	}
+	return r
+}
@@ -0,0 +1,183 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"UserPortrait/configs"
+	"UserPortrait/service"
+	"UserPortrait/service/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+type testServer struct {
+	t      *testing.T
+	engine *gin.Engine
+}
+
+// 以SQLite内存数据库启动完整路由
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	cfg := configs.Default()
+	cfg.Auth.TokenSecret = "test-secret"
+	cfg.Auth.Salt = "user-salt"
+	cfg.Auth.AdminSalt = "admin-salt"
+	configs.Set(cfg)
+	db, err := database.Open(database.Options{Driver: database.DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	service.InitContainer(service.NewSQLContainer(db))
+	service.InitTokenRevocation()
+	if err := service.CreateAdmin("root", "admin-pass"); err != nil {
+		t.Fatal(err)
+	}
+	return &testServer{t: t, engine: InitRouter()}
+}
+
+// 发送表单请求，返回状态码与JSON响应
+func (s *testServer) post(path string, bearer string, form url.Values) (int, map[string]any) {
+	s.t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	w := httptest.NewRecorder()
+	s.engine.ServeHTTP(w, req)
+	body := map[string]any{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func (s *testServer) mustPost(path string, bearer string, form url.Values) map[string]any {
+	s.t.Helper()
+	code, body := s.post(path, bearer, form)
+	if code != http.StatusOK {
+		s.t.Fatalf("POST %s: %d %v", path, code, body)
+	}
+	return body
+}
+
+func (s *testServer) loginUser() (access string, refresh string) {
+	s.t.Helper()
+	body := s.mustPost("/public/login", "", url.Values{"login_name": {"alice"}, "login_password": {"user-pass"}})
+	return body["token"].(string), body["refresh_token"].(string)
+}
+
+func (s *testServer) loginAdmin() string {
+	s.t.Helper()
+	body := s.mustPost("/public/admin_login", "", url.Values{"admin_name": {"root"}, "password": {"admin-pass"}})
+	return body["token"].(string)
+}
+
+func (s *testServer) registerUser() {
+	s.t.Helper()
+	s.mustPost("/public/register", "", url.Values{"username": {"alice"}, "password": {"user-pass"}, "MAC": {"aa:bb:cc:dd:ee:ff"}})
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser()
+	_, refresh := s.loginUser()
+
+	body := s.mustPost("/public/refresh", "", url.Values{"refresh_token": {refresh}})
+	pair := body["data"].(map[string]any)
+	rotated := pair["refresh_token"].(string)
+	if rotated == refresh {
+		t.Fatal("refresh token not rotated")
+	}
+	// 旧刷新token再次使用视为泄露，同族的刷新token全部作废
+	if code, _ := s.post("/public/refresh", "", url.Values{"refresh_token": {refresh}}); code != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: %d, want 401", code)
+	}
+	if code, _ := s.post("/public/refresh", "", url.Values{"refresh_token": {rotated}}); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token of a reused family: %d, want 401", code)
+	}
+	// 其他登录的刷新token不受影响
+	_, other := s.loginUser()
+	s.mustPost("/public/refresh", "", url.Values{"refresh_token": {other}})
+}
+
+func TestLogout(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser()
+	first, firstRefresh := s.loginUser()
+	second, _ := s.loginUser()
+
+	s.mustPost("/user/logout", first, url.Values{"refresh_token": {firstRefresh}})
+	if code, _ := s.post("/user/logout", first, nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token after logout: %d, want 401", code)
+	}
+	if code, _ := s.post("/public/refresh", "", url.Values{"refresh_token": {firstRefresh}}); code != http.StatusUnauthorized {
+		t.Fatalf("refresh token after logout: %d, want 401", code)
+	}
+
+	// iat精确到毫秒，确保退出全部登录晚于签发
+	time.Sleep(2 * time.Millisecond)
+	s.mustPost("/user/logout_all", second, nil)
+	if code, _ := s.post("/user/logout", second, nil); code != http.StatusUnauthorized {
+		t.Fatalf("access token after logout_all: %d, want 401", code)
+	}
+	// 退出全部登录之后的新登录可用
+	third, _ := s.loginUser()
+	s.mustPost("/user/logout", third, nil)
+}
+
+func TestImpersonation(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser()
+	admin := s.loginAdmin()
+	body := s.mustPost("/admin/impersonate", admin, url.Values{"user_id": {"1"}})
+	impersonation := body["token"].(string)
+
+	// 代入身份只能查看
+	writes := []struct {
+		path string
+		form url.Values
+	}{
+		{"/user/reset_password", url.Values{"password": {"taken-over"}}},
+		{"/user/logout_all", nil},
+		{"/user/score", url.Values{"score": {"1"}}},
+		{"/user/avatar", nil},
+	}
+	for _, w := range writes {
+		if code, body := s.post(w.path, impersonation, w.form); code != http.StatusForbidden {
+			t.Errorf("POST %s with impersonation token: %d %v, want 403", w.path, code, body)
+		}
+	}
+	// 密码未被修改
+	s.loginUser()
+
+	// 签发代入token的管理员退出全部登录后，代入token一并失效
+	time.Sleep(2 * time.Millisecond)
+	s.mustPost("/admin/logout_all", admin, nil)
+	if code, _ := s.post("/user/reset_password", impersonation, url.Values{"password": {"taken-over"}}); code != http.StatusUnauthorized {
+		t.Fatalf("impersonation token after admin logout_all: %d, want 401", code)
+	}
+}
+
+func TestAdminRegisterRequiresAdmin(t *testing.T) {
+	s := newTestServer(t)
+	s.registerUser()
+	form := url.Values{"admin_name": {"mallory"}, "password": {"pass"}}
+	if code, _ := s.post("/public/admin_register", "", form); code != http.StatusNotFound {
+		t.Fatalf("public admin_register: %d, want 404", code)
+	}
+	user, _ := s.loginUser()
+	if code, _ := s.post("/admin/admin_register", user, form); code != http.StatusUnauthorized && code != http.StatusForbidden {
+		t.Fatalf("admin_register with user token: %d, want 401 or 403", code)
+	}
+	s.mustPost("/admin/admin_register", s.loginAdmin(), form)
+	s.mustPost("/public/admin_login", "", url.Values{"admin_name": {"mallory"}, "password": {"pass"}})
+}
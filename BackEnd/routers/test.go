@@ -1,3 +1,5 @@
+package routers
+
 // package main
 
 // import (
@@ -3,30 +3,44 @@ package service
 import (
 	"UserPortrait/Controllers"
 	"UserPortrait/etc"
-	"UserPortrait/service/database"
 	"UserPortrait/token"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 	"net/http"
 )
 
-func AdminRegister(c *gin.Context) {
-	db, err := database.InitDB()
+// ErrAdminExists 管理员用户名已被占用
+var ErrAdminExists = errors.New("admin already exists")
+
+// CreateAdmin 创建管理员账号，密码以bcrypt存储；供管理员接口与命令行共用
+func CreateAdmin(name string, password string) error {
+	if name == "" || password == "" {
+		return errors.New("admin name and password must not be empty")
+	}
+	repos, err := getContainer()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"message": "数据库连接失败,请重试",
-		})
-		fmt.Printf("%v:%v\n", etc.RegisterErr, err)
-		return
+		return err
+	}
+	_, err = repos.Admins.FindAdminByName(name)
+	if err == nil {
+		return ErrAdminExists
+	}
+	if !errors.Is(err, Controllers.ErrNotFound) {
+		return err
 	}
-	var sql = Controllers.SqlController{DB: db}
-	var administrator etc.Admininfo
+	pswd, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return repos.Admins.InsertAdmin(etc.Admininfo{Adminname: name, Password: string(pswd)})
+}
+
+// AdminRegister 已登录的管理员创建新管理员，首个管理员由命令行 create-admin 创建
+func AdminRegister(c *gin.Context) {
 	newName := c.PostForm("admin_name")
 	newPswd := c.PostForm("password")
-	pswd, _ := bcrypt.GenerateFromPassword([]byte(newPswd), bcrypt.DefaultCost)
 	if newName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"message": "用户名不能为空",
@@ -42,10 +56,13 @@ func AdminRegister(c *gin.Context) {
 		return
 	}
 
-	// 无问题，更进结构体
-	administrator.Adminname = newName
-	administrator.Password = string(pswd)
-	err = sql.InsertAdmin(administrator)
+	err := CreateAdmin(newName, newPswd)
+	if errors.Is(err, ErrAdminExists) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "用户名已存在",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "注册失败,请重试",
@@ -60,7 +77,7 @@ func AdminRegister(c *gin.Context) {
 }
 
 func AdminLogin(c *gin.Context) {
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -68,7 +85,6 @@ func AdminLogin(c *gin.Context) {
 		fmt.Printf("%v:%v\n", etc.LoginErr, err)
 		return
 	}
-	var sql = Controllers.SqlController{DB: db}
 	var admin etc.Admininfo
 	adminName := c.PostForm("admin_name")
 	adminPswd := c.PostForm("password")
@@ -88,9 +104,9 @@ func AdminLogin(c *gin.Context) {
 	}
 	admin.Adminname = adminName
 	admin.Password = adminPswd
-	result, err := sql.FindAdminByName(admin.Adminname)
+	result, err := repos.Admins.FindAdminByName(admin.Adminname)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, Controllers.ErrNotFound) {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"message": "用户名或密码错误",
 			})
@@ -110,7 +126,7 @@ func AdminLogin(c *gin.Context) {
 		fmt.Println(etc.LoginErr + "Password Error")
 		return
 	}
-	geneToken, errt := token.GenerateAdminToken(result.ID)
+	pair, errt := issueLoginTokens(token.Principal{ID: result.ID, Role: token.RoleAdmin})
 	if errt != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "服务器内部错误",
@@ -119,8 +135,10 @@ func AdminLogin(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{
-		"message": "登录成功",
-		"token":   geneToken,
+		"message":       "登录成功",
+		"token":         pair.AccessToken,
+		"refresh_token": pair.RefreshToken,
+		"expires_in":    pair.ExpiresIn,
 	})
 	return
 
@@ -3,7 +3,7 @@ package service
 import (
 	"UserPortrait/Controllers"
 	"UserPortrait/functions"
-	"UserPortrait/service/database"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"net/http"
@@ -12,7 +12,7 @@ import (
 
 func GetBaseStationInfo(c *gin.Context) {
 	//TODO: 查询返回近24小时基站信息
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -22,8 +22,6 @@ func GetBaseStationInfo(c *gin.Context) {
 	}
 	stationId, _ := strconv.ParseUint(c.Query("station_id"), 10, 32)
 	//fmt.Printf("Query Num Type:%T,%T", stationId, c.Query("station_id"))
-	TableName := functions.ChooseTable(uint(stationId), "base_station")
-	sql := Controllers.SqlController{DB: db}
 	Yesterday, Today, lastPeriodId, currPeriodId, err := functions.GetDailyInfo()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -31,7 +29,13 @@ func GetBaseStationInfo(c *gin.Context) {
 		})
 		return
 	}
-	result, err := sql.DailyStationRecords(uint(stationId), TableName, Yesterday, Today, lastPeriodId, currPeriodId)
+	result, err := repos.Stations.DailyStationRecords(uint(stationId), Yesterday, Today, lastPeriodId, currPeriodId)
+	if errors.Is(err, Controllers.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "基站不存在",
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "获取基站信息失败,请重试",
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"UserPortrait/configs"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// GetConfig 管理员用：获取当前生效的配置，密钥类配置项已脱敏
+func GetConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取配置成功",
+		"data":    configs.Get().String(),
+	})
+}
+
+// ReloadConfig 管理员用：重新加载配置文件与环境变量，仅支持热加载的配置项立即生效
+func ReloadConfig(c *gin.Context) {
+	result, err := configs.Reload()
+	if err != nil {
+		fmt.Println("reload config err:", err)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "配置重载失败",
+			"error":   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "配置重载成功",
+		"data":    result,
+	})
+}
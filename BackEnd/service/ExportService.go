@@ -0,0 +1,10 @@
+package service
+
+// ExportTable 逐行导出表数据，供命令行 export 使用，可导出的表见 Controllers.ExportTables
+func ExportTable(table string, from string, to string, fn func(columns []string, values []any) error) error {
+	repos, err := getContainer()
+	if err != nil {
+		return err
+	}
+	return repos.Export.ExportTable(table, from, to, fn)
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"UserPortrait/etc"
+	"UserPortrait/service/geo"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 新插入的universe记录先以 etc.LocPending 写库，再由后台worker异步定位并补充位置信息，
+// 定位不阻塞写库事务；队列已满、定位出错或进程退出时未处理的记录保持待定位，由定期回填重新入队
+
+var enricher atomic.Pointer[geoEnricher]
+
+// EnricherStats 异步定位队列的运行指标
+type EnricherStats struct {
+	Queued   int    `json:"queued"`
+	Enqueued uint64 `json:"enqueued"`
+	Dropped  uint64 `json:"dropped"`
+	Located  uint64 `json:"located"`
+	Unknown  uint64 `json:"unknown"`
+	Failed   uint64 `json:"failed"`
+}
+
+// 以唯一键标识一条universe记录
+type universeSlot struct {
+	StationID uint
+	UserID    uint
+	IP        string
+	Date      string
+	PeriodID  uint
+}
+
+func slotOf(record etc.Universe) universeSlot {
+	return universeSlot{StationID: record.StationID, UserID: record.UserID, IP: record.Ip, Date: record.Date, PeriodID: record.PeriodID}
+}
+
+type geoEnricher struct {
+	queue  chan etc.Universe
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// 已入队尚未处理完的记录，避免回填时重复入队
+	mu       sync.Mutex
+	inflight map[universeSlot]struct{}
+
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	located  atomic.Uint64
+	unknown  atomic.Uint64
+	failed   atomic.Uint64
+}
+
+// StartGeoEnricher 启动 workers 个异步定位worker，并每隔 backfill 将数据库中待定位的记录重新入队（启动时立即执行一次）
+func StartGeoEnricher(workers int, depth int, backfill time.Duration) error {
+	repos, err := getContainer()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &geoEnricher{
+		queue:    make(chan etc.Universe, depth),
+		ctx:      ctx,
+		cancel:   cancel,
+		inflight: make(map[universeSlot]struct{}),
+	}
+	if !enricher.CompareAndSwap(nil, e) {
+		cancel()
+		return fmt.Errorf("geo enricher already started")
+	}
+	for i := 0; i < workers; i++ {
+		e.wg.Add(1)
+		go func() {
+			defer e.wg.Done()
+			e.work(repos)
+		}()
+	}
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		e.backfill(repos, backfill)
+	}()
+	return nil
+}
+
+// StopGeoEnricher 最多等待drain处理完已入队的记录后停止异步定位，进行中的定位请求被取消，
+// 未处理的记录留待下次启动时回填
+func StopGeoEnricher(drain time.Duration) {
+	e := enricher.Swap(nil)
+	if e == nil {
+		return
+	}
+	deadline := time.Now().Add(drain)
+	for e.pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+	}
+	e.cancel()
+	e.wg.Wait()
+	fmt.Printf("geo enricher stopped: %+v\n", e.stats())
+}
+
+// 将记录加入异步定位队列，未启动异步定位或队列已满时记录保持待定位
+func enqueueLocations(records []etc.Universe) {
+	e := enricher.Load()
+	if e == nil {
+		return
+	}
+	for _, record := range records {
+		e.enqueue(record)
+	}
+}
+
+func (e *geoEnricher) enqueue(record etc.Universe) {
+	slot := slotOf(record)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.inflight[slot]; ok {
+		return
+	}
+	select {
+	case e.queue <- record:
+		e.inflight[slot] = struct{}{}
+		e.enqueued.Add(1)
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *geoEnricher) pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.inflight)
+}
+
+func (e *geoEnricher) done(record etc.Universe) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.inflight, slotOf(record))
+}
+
+func (e *geoEnricher) work(repos *Container) {
+	for {
+		select {
+		case <-e.ctx.Done():
+			return
+		case record := <-e.queue:
+			e.locate(repos, record)
+			e.done(record)
+		}
+	}
+}
+
+func (e *geoEnricher) locate(repos *Container, record etc.Universe) {
+	loc, err := locateUniverse(e.ctx, repos, record)
+	switch {
+	case err == nil:
+		record.City, record.District, record.Latitude, record.Longitude = loc.City, loc.District, loc.Latitude, loc.Longitude
+		record.LocSource = loc.Source
+		e.located.Add(1)
+	case errors.Is(err, geo.ErrNotFound):
+		record.LocSource = etc.LocUnknown
+		e.unknown.Add(1)
+	default:
+		// 保持待定位，等待回填重试
+		if e.ctx.Err() == nil {
+			fmt.Printf("UID%v: locate %s failed: %v\n", record.UserID, record.Ip, err)
+		}
+		e.failed.Add(1)
+		return
+	}
+	if err := repos.Universe.UpdateUniverseLocation(record); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// 定期将待定位的记录入队，每次至多填满队列的空余；按唯一键顺序分批遍历，遍历完后从头开始，
+// 定位反复失败的记录不会一直占用队列而使其后的记录得不到处理
+func (e *geoEnricher) backfill(repos *Container, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var cursor etc.Universe
+	for {
+		if free := cap(e.queue) - len(e.queue); free > 0 {
+			records, err := repos.Universe.ListPendingLocations(cursor, free)
+			if err != nil {
+				fmt.Println(err)
+			}
+			for _, record := range records {
+				e.enqueue(record)
+			}
+			if len(records) < free {
+				cursor = etc.Universe{}
+			} else {
+				cursor = records[len(records)-1]
+			}
+		}
+		select {
+		case <-e.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (e *geoEnricher) stats() EnricherStats {
+	return EnricherStats{
+		Queued:   len(e.queue),
+		Enqueued: e.enqueued.Load(),
+		Dropped:  e.dropped.Load(),
+		Located:  e.located.Load(),
+		Unknown:  e.unknown.Load(),
+		Failed:   e.failed.Load(),
+	}
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/configs"
+	"UserPortrait/etc"
+	"UserPortrait/service/geo"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// geoCache 为带缓存的定位链，InitGeoLocator 后非nil
+	geoCache atomic.Pointer[geo.Cache]
+	geoMu    sync.Mutex
+	// 已打开的离线库按路径复用；热加载更换路径后旧库不关闭，避免进行中的查询访问已关闭的库
+	mmdbLocators = map[string]*geo.MMDBLocator{}
+	// 各定位来源的统计按名称保留，定位链重建后继续累计
+	geoMetrics sync.Map
+	// 未命中静态表的特殊地址按类别计数
+	geoSpecial sync.Map
+)
+
+// GeoStats 定位缓存、各来源与异步定位队列的运行指标
+type GeoStats struct {
+	Cache     geo.CacheStats               `json:"cache"`
+	Providers map[string]geo.ProviderStats `json:"providers"`
+	Special   map[string]uint64            `json:"special"`
+	Enricher  *EnricherStats               `json:"enricher,omitempty"`
+}
+
+func GetGeoStats() GeoStats {
+	stats := GeoStats{Providers: map[string]geo.ProviderStats{}, Special: map[string]uint64{}}
+	if cache := geoCache.Load(); cache != nil {
+		stats.Cache = cache.Stats()
+	}
+	geoMetrics.Range(func(key, value any) bool {
+		stats.Providers[key.(string)] = value.(*geo.Metrics).Stats()
+		return true
+	})
+	geoSpecial.Range(func(key, value any) bool {
+		stats.Special[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	if e := enricher.Load(); e != nil {
+		enricherStats := e.stats()
+		stats.Enricher = &enricherStats
+	}
+	return stats
+}
+
+func instrumentGeo(locator geo.GeoLocator) geo.GeoLocator {
+	metrics, _ := geoMetrics.LoadOrStore(locator.Name(), &geo.Metrics{})
+	return geo.Instrument(locator, metrics.(*geo.Metrics))
+}
+
+// InitGeoLocator 按当前配置构建IP定位链，static 来源包含配置中的静态表与各基站子网（使用基站坐标，来源记为 station），
+// mmdb、tencent 不查询私有等特殊地址；基站或配置变更后重新调用即可生效，同时清空定位缓存
+func InitGeoLocator() error {
+	geoMu.Lock()
+	defer geoMu.Unlock()
+	cfg := configs.Get().Geo
+	var chain geo.Chain
+	for _, provider := range cfg.Providers {
+		switch provider {
+		case "static":
+			chain = append(chain, instrumentGeo(geo.NewStaticLocator(staticGeoEntries(cfg.Static))))
+		case "mmdb":
+			if cfg.MMDBPath == "" {
+				fmt.Println("geo: mmdb skipped, geo.mmdb_path not set")
+				continue
+			}
+			locator, ok := mmdbLocators[cfg.MMDBPath]
+			if !ok {
+				var err error
+				if locator, err = geo.OpenMMDB(cfg.MMDBPath, cfg.Language); err != nil {
+					return err
+				}
+				mmdbLocators[cfg.MMDBPath] = locator
+			}
+			chain = append(chain, geo.PublicOnly(instrumentGeo(locator)))
+		case "tencent":
+			if configs.Get().TencentMap.Key == "" {
+				fmt.Println("geo: tencent skipped, tencent_map.key not set")
+				continue
+			}
+			chain = append(chain, geo.PublicOnly(instrumentGeo(geo.NewTencentLocator(cfg.TencentTimeout))))
+		}
+	}
+	opts := geo.CacheOptions{TTL: cfg.CacheTTL, NegativeTTL: cfg.NegativeTTL, Size: cfg.CacheSize}
+	if cache := geoCache.Load(); cache != nil {
+		cache.Reset(chain, opts)
+	} else {
+		geoCache.Store(geo.NewCache(chain, opts))
+	}
+	return nil
+}
+
+// 配置中的静态表在前，同一网段以配置为准
+func staticGeoEntries(static []configs.StaticLocation) []geo.StaticEntry {
+	var entries []geo.StaticEntry
+	for _, item := range static {
+		prefix, err := netip.ParsePrefix(item.CIDR)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, geo.StaticEntry{Prefix: prefix, Location: geo.Location{
+			City:      item.City,
+			District:  item.District,
+			Latitude:  item.Latitude,
+			Longitude: item.Longitude,
+		}})
+	}
+	repos, err := getContainer()
+	if err == nil {
+		var stations []etc.Station
+		if stations, err = repos.Stations.ListStations(); err == nil {
+			for _, station := range stations {
+				for _, subnet := range station.Subnets {
+					prefix, err := netip.ParsePrefix(subnet)
+					if err != nil {
+						continue
+					}
+					loc := stationLocation(station)
+					loc.Source = etc.LocStation
+					entries = append(entries, geo.StaticEntry{Prefix: prefix, Location: loc})
+				}
+			}
+		}
+	}
+	if err != nil {
+		fmt.Println("geo: load station subnets failed:", err)
+	}
+	return entries
+}
+
+// 基站没有行政区划信息，以基站名称作为地点名称
+func stationLocation(station etc.Station) geo.Location {
+	return geo.Location{City: station.Name, Latitude: station.Latitude, Longitude: station.Longitude}
+}
+
+// 基站变更后刷新定位链中的基站子网，定位链尚未使用时不做处理
+func reloadGeoLocator() {
+	if geoCache.Load() == nil {
+		return
+	}
+	if err := InitGeoLocator(); err != nil {
+		fmt.Println("geo: reload locator failed:", err)
+	}
+}
+
+// 查询IP的位置，定位链未初始化时按当前配置初始化
+func locateIP(ctx context.Context, ip string) (geo.Location, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return geo.Location{}, fmt.Errorf("invalid ip %q: %v", ip, err)
+	}
+	cache := geoCache.Load()
+	if cache == nil {
+		if err := InitGeoLocator(); err != nil {
+			return geo.Location{}, err
+		}
+		cache = geoCache.Load()
+	}
+	return cache.Locate(ctx, addr)
+}
+
+// 定位一条universe记录：先按定位链查询记录的IP；私有等特殊地址未命中静态表时，
+// 依次使用所属基站的坐标、对端地址的位置，Source 记录所用方法
+func locateUniverse(ctx context.Context, repos *Container, record etc.Universe) (geo.Location, error) {
+	loc, err := locateIP(ctx, record.Ip)
+	if !errors.Is(err, geo.ErrNotFound) {
+		return loc, err
+	}
+	addr, _ := netip.ParseAddr(record.Ip)
+	kind, special := geo.Special(addr)
+	if !special {
+		return loc, err
+	}
+	count, _ := geoSpecial.LoadOrStore(kind, new(atomic.Uint64))
+	count.(*atomic.Uint64).Add(1)
+	if record.StationID != etc.UnassignedStation {
+		station, err := repos.Stations.FindStationByID(record.StationID)
+		if err != nil && !errors.Is(err, Controllers.ErrNotFound) {
+			return geo.Location{}, err
+		}
+		if err == nil && (station.Latitude != 0 || station.Longitude != 0) {
+			loc = stationLocation(station)
+			loc.Source = etc.LocStation
+			return loc, nil
+		}
+	}
+	if record.RemoteIp != "" {
+		if loc, err := locateIP(ctx, record.RemoteIp); err == nil {
+			loc.Source = etc.LocRemote
+			return loc, nil
+		} else if !errors.Is(err, geo.ErrNotFound) {
+			return geo.Location{}, err
+		}
+	}
+	return geo.Location{}, geo.ErrNotFound
+}
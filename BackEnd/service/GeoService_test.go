@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"UserPortrait/configs"
+	"UserPortrait/etc"
+	"UserPortrait/service/database"
+)
+
+func TestLocateUniverseSources(t *testing.T) {
+	db := newAggregatorTestDB(t)
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	repos, err := getContainer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	station := etc.Station{Name: "基站A", Latitude: 30.5, Longitude: 114.3, Subnets: []string{"10.1.0.0/16"}}
+	if err := repos.Stations.InsertStation(&station); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := configs.Default()
+	cfg.Geo.Providers = []string{"static"}
+	cfg.Geo.Static = []configs.StaticLocation{{CIDR: "10.9.0.0/16", City: "机房", Latitude: 31, Longitude: 121}}
+	configs.Set(cfg)
+	t.Cleanup(func() {
+		configs.Set(nil)
+		geoCache.Store(nil)
+	})
+	if err := InitGeoLocator(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		record     etc.Universe
+		wantSource string
+		wantCity   string
+	}{
+		{"station subnet", etc.Universe{StationID: etc.UnassignedStation, Ip: "10.1.2.3"}, etc.LocStation, "基站A"},
+		{"configured static entry", etc.Universe{StationID: station.ID, Ip: "10.9.0.1"}, "static", "机房"},
+		{"private address falls back to its station", etc.Universe{StationID: station.ID, Ip: "192.168.1.2"}, etc.LocStation, "基站A"},
+		{"private address falls back to the remote address", etc.Universe{StationID: etc.UnassignedStation, Ip: "192.168.1.2", RemoteIp: "10.9.0.8"}, etc.LocRemote, "机房"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := locateUniverse(context.Background(), repos, tt.record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.Source != tt.wantSource || loc.City != tt.wantCity {
+				t.Fatalf("located %s/%s, want %s/%s", loc.City, loc.Source, tt.wantCity, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,363 @@
+package service
+
+import (
+	"UserPortrait/service/geo"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 数据包在内存中按 (基站, 用户MAC, IP, 日期, 时段) 与 (基站, 日期, 时段) 累加，定期批量写入数据库
+
+type universeKey struct {
+	StationID uint   `json:"station_id"`
+	MAC       string `json:"mac"`
+	IP        string `json:"ip"`
+	Date      string `json:"date"`
+	PeriodID  uint   `json:"period_id"`
+}
+
+type stationKey struct {
+	StationID uint   `json:"station_id"`
+	Date      string `json:"date"`
+	PeriodID  uint   `json:"period_id"`
+}
+
+// 累加计数，DataSegments 为TCP数据段数（ErrCount 的分母），LatencySamples 为有RTT样本的数据包数；
+// RemoteIP 为universe记录首个公网对端地址
+type counters struct {
+	Count          uint   `json:"count"`
+	ErrCount       uint   `json:"err_count"`
+	DataSegments   uint   `json:"data_segments"`
+	Flow           uint   `json:"flow"`
+	LatencySum     uint   `json:"latency_sum"`
+	LatencySamples uint   `json:"latency_samples"`
+	RemoteIP       string `json:"remote_ip,omitempty"`
+}
+
+func (c *counters) add(lossFlag bool, dataSegment bool, flow uint, latency uint) {
+	c.Count++
+	c.Flow += flow
+	if lossFlag {
+		c.ErrCount++
+	}
+	if dataSegment {
+		c.DataSegments++
+	}
+	// 尚无RTT样本的数据包不参与时延平均
+	if latency > 0 {
+		c.LatencySum += latency
+		c.LatencySamples++
+	}
+}
+
+func (c *counters) merge(o counters) {
+	c.Count += o.Count
+	c.ErrCount += o.ErrCount
+	c.DataSegments += o.DataSegments
+	c.Flow += o.Flow
+	c.LatencySum += o.LatencySum
+	c.LatencySamples += o.LatencySamples
+	if c.RemoteIP == "" {
+		c.RemoteIP = o.RemoteIP
+	}
+}
+
+// 有样本数据包的平均时延，无样本时为0
+func (c counters) latency() uint {
+	if c.LatencySamples == 0 {
+		return 0
+	}
+	return c.LatencySum / c.LatencySamples
+}
+
+// 落盘格式，用于关闭时未能写入数据库的缓冲数据
+type spillEntry[K comparable] struct {
+	Key      K        `json:"key"`
+	Counters counters `json:"counters"`
+}
+
+type spillData struct {
+	Universe []spillEntry[universeKey] `json:"universe"`
+	Stations []spillEntry[stationKey]  `json:"stations"`
+}
+
+// AggregatorStats 聚合器运行计数
+type AggregatorStats struct {
+	PendingUniverse int    `json:"pending_universe"`
+	PendingStations int    `json:"pending_stations"`
+	Flushes         uint64 `json:"flushes"`
+	FlushErrors     uint64 `json:"flush_errors"`
+	RowsFlushed     uint64 `json:"rows_flushed"`
+	RowsDropped     uint64 `json:"rows_dropped"`
+}
+
+// Aggregator 内存聚合器
+type Aggregator struct {
+	mu       sync.Mutex
+	universe map[universeKey]*counters
+	stations map[stationKey]*counters
+
+	flushMu    sync.Mutex // 保证同一时刻只有一次写库
+	interval   time.Duration
+	spillFile  string
+	maxPending int
+	// spillLoaded 启动时载入了spill文件且其数据尚未全部写库，仅在flushMu下访问
+	spillLoaded bool
+	stop        chan struct{}
+	done        chan struct{}
+
+	flushes     atomic.Uint64
+	flushErrors atomic.Uint64
+	rowsFlushed atomic.Uint64
+	rowsDropped atomic.Uint64
+}
+
+var aggregator *Aggregator
+
+// InitAggregator 初始化并启动聚合器：每隔interval写库一次；spillFile非空时，启动时载入上次遗留的缓冲数据，关闭时写库失败的数据保存于此；
+// 写库失败的记录放回缓冲重试，缓冲中的记录数达到maxPending后不再放回新的记录
+func InitAggregator(interval time.Duration, spillFile string, maxPending int) error {
+	agg := &Aggregator{
+		universe:   make(map[universeKey]*counters),
+		stations:   make(map[stationKey]*counters),
+		interval:   interval,
+		spillFile:  spillFile,
+		maxPending: maxPending,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if err := agg.loadSpill(); err != nil {
+		return err
+	}
+	aggregator = agg
+	go agg.run()
+	return nil
+}
+
+// StopAggregator 停止定时写库并写入剩余数据，写库失败时落盘
+func StopAggregator() error {
+	if aggregator == nil {
+		return nil
+	}
+	close(aggregator.stop)
+	<-aggregator.done
+	if err := aggregator.Flush(); err != nil {
+		if spillErr := aggregator.saveSpill(); spillErr != nil {
+			return fmt.Errorf("final flush failed: %v, save spill file failed: %v", err, spillErr)
+		}
+		return fmt.Errorf("final flush failed, buffered data saved to %s: %v", aggregator.spillFile, err)
+	}
+	return nil
+}
+
+// GetAggregatorStats 返回聚合器的运行计数
+func GetAggregatorStats() AggregatorStats {
+	if aggregator == nil {
+		return AggregatorStats{}
+	}
+	return aggregator.Stats()
+}
+
+func (a *Aggregator) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+			if err := a.Flush(); err != nil {
+				fmt.Printf("flush aggregated packets failed: %v\n", err)
+			}
+		}
+	}
+}
+
+func (a *Aggregator) addUniverse(key universeKey, remoteIP string, lossFlag bool, dataSegment bool, flow uint, latency uint) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.universe[key]
+	if !ok {
+		c = &counters{}
+		a.universe[key] = c
+	}
+	c.add(lossFlag, dataSegment, flow, latency)
+	// 对端同为特殊地址时无助于定位
+	if c.RemoteIP == "" {
+		if addr, err := netip.ParseAddr(remoteIP); err == nil && !geo.IsSpecial(addr) {
+			c.RemoteIP = remoteIP
+		}
+	}
+}
+
+func (a *Aggregator) addStation(key stationKey, lossFlag bool, dataSegment bool, flow uint, latency uint) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c, ok := a.stations[key]
+	if !ok {
+		c = &counters{}
+		a.stations[key] = c
+	}
+	c.add(lossFlag, dataSegment, flow, latency)
+}
+
+// 取出当前缓冲，之后到达的数据包写入新的缓冲
+func (a *Aggregator) swap() (map[universeKey]*counters, map[stationKey]*counters) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	universe, stations := a.universe, a.stations
+	a.universe = make(map[universeKey]*counters)
+	a.stations = make(map[stationKey]*counters)
+	return universe, stations
+}
+
+// 写库失败的记录放回缓冲，下次重试；缓冲中的记录数达到maxPending后，缓冲中没有的记录被丢弃，返回丢弃的记录数。
+// 数据库长时间不可用时缓冲不会无限增长；基站记录行数少且汇总全部用户，优先放回
+func (a *Aggregator) requeue(universe map[universeKey]*counters, stations map[stationKey]*counters) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	free := a.maxPending - len(a.universe) - len(a.stations)
+	return requeueInto(a.stations, stations, &free) + requeueInto(a.universe, universe, &free)
+}
+
+// 将rows累加回m，m中没有的记录最多新增*free条，返回丢弃的记录数
+func requeueInto[K comparable](m map[K]*counters, rows map[K]*counters, free *int) int {
+	dropped := 0
+	for key, c := range rows {
+		if _, ok := m[key]; !ok {
+			if *free <= 0 {
+				dropped++
+				continue
+			}
+			*free--
+		}
+		mergeInto(m, key, *c)
+	}
+	return dropped
+}
+
+func mergeInto[K comparable](m map[K]*counters, key K, c counters) {
+	if existing, ok := m[key]; ok {
+		existing.merge(c)
+		return
+	}
+	m[key] = &c
+}
+
+// Flush 将缓冲数据批量写入数据库，失败的记录保留在缓冲中
+func (a *Aggregator) Flush() error {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+
+	universe, stations := a.swap()
+	if len(universe) == 0 && len(stations) == 0 {
+		return nil
+	}
+	failedUniverse, failedStations, err := flushAggregated(universe, stations)
+	written := len(universe) - len(failedUniverse) + len(stations) - len(failedStations)
+	a.flushes.Add(1)
+	a.rowsFlushed.Add(uint64(written))
+	failed := len(failedUniverse) > 0 || len(failedStations) > 0
+	if failed {
+		if dropped := a.requeue(failedUniverse, failedStations); dropped > 0 {
+			a.rowsDropped.Add(uint64(dropped))
+			fmt.Printf("aggregator buffer full (%d rows), dropped %d rows that failed to flush\n", a.maxPending, dropped)
+		}
+	}
+	if err != nil {
+		a.flushErrors.Add(1)
+	}
+	if a.spillLoaded && written > 0 {
+		a.settleSpill(failed)
+	}
+	return err
+}
+
+// 启动时载入的spill文件在其数据写库之后才删除，期间进程异常退出时下次启动仍可载入；
+// 仅部分记录写库成功时，以缓冲中尚未写库的数据重写该文件，避免再次载入时重复累加已写库的记录
+func (a *Aggregator) settleSpill(pending bool) {
+	if pending {
+		if err := a.saveSpill(); err != nil {
+			fmt.Printf("rewrite spill file %s failed: %v\n", a.spillFile, err)
+		}
+		return
+	}
+	if err := os.Remove(a.spillFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("remove spill file %s failed: %v\n", a.spillFile, err)
+		return
+	}
+	a.spillLoaded = false
+}
+
+func (a *Aggregator) Stats() AggregatorStats {
+	a.mu.Lock()
+	pendingUniverse, pendingStations := len(a.universe), len(a.stations)
+	a.mu.Unlock()
+	return AggregatorStats{
+		PendingUniverse: pendingUniverse,
+		PendingStations: pendingStations,
+		Flushes:         a.flushes.Load(),
+		FlushErrors:     a.flushErrors.Load(),
+		RowsFlushed:     a.rowsFlushed.Load(),
+		RowsDropped:     a.rowsDropped.Load(),
+	}
+}
+
+func (a *Aggregator) saveSpill() error {
+	if a.spillFile == "" {
+		return fmt.Errorf("no spill file configured")
+	}
+	a.mu.Lock()
+	var data spillData
+	for key, c := range a.universe {
+		data.Universe = append(data.Universe, spillEntry[universeKey]{Key: key, Counters: *c})
+	}
+	for key, c := range a.stations {
+		data.Stations = append(data.Stations, spillEntry[stationKey]{Key: key, Counters: *c})
+	}
+	a.mu.Unlock()
+
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，避免写到一半时留下损坏的文件
+	tmp := a.spillFile + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.spillFile)
+}
+
+func (a *Aggregator) loadSpill() error {
+	if a.spillFile == "" {
+		return nil
+	}
+	content, err := os.ReadFile(a.spillFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read spill file failed: %v", err)
+	}
+	var data spillData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("parse spill file failed: %v", err)
+	}
+	for _, entry := range data.Universe {
+		mergeInto(a.universe, entry.Key, entry.Counters)
+	}
+	for _, entry := range data.Stations {
+		mergeInto(a.stations, entry.Key, entry.Counters)
+	}
+	fmt.Printf("loaded %d universe and %d station records from %s\n", len(data.Universe), len(data.Stations), a.spillFile)
+	// 文件保留至数据写库之后，见 settleSpill
+	a.spillLoaded = true
+	return nil
+}
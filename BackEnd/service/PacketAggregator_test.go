@@ -0,0 +1,110 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"UserPortrait/etc"
+	"UserPortrait/service/database"
+
+	"gorm.io/gorm"
+)
+
+// 未执行迁移的SQLite库，写库全部失败；迁移后写库成功
+func newAggregatorTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Open(database.Options{Driver: database.DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	InitContainer(NewSQLContainer(db))
+	t.Cleanup(func() { InitContainer(nil) })
+	return db
+}
+
+func startTestAggregator(t *testing.T, spillFile string, maxPending int) *Aggregator {
+	t.Helper()
+	if err := InitAggregator(time.Hour, spillFile, maxPending); err != nil {
+		t.Fatal(err)
+	}
+	agg := aggregator
+	t.Cleanup(func() {
+		close(agg.stop)
+		<-agg.done
+		aggregator = nil
+	})
+	return agg
+}
+
+func TestAggregatorKeepsSpillUntilFlushed(t *testing.T) {
+	db := newAggregatorTestDB(t)
+	spillFile := filepath.Join(t.TempDir(), "spill.json")
+	content := `{"universe":[{"key":{"station_id":1,"mac":"aa:aa:aa:aa:aa:aa","ip":"10.0.0.2","date":"2024-05-01","period_id":3},"counters":{"count":4,"data_segments":4,"flow":400}}],` +
+		`"stations":[{"key":{"station_id":1,"date":"2024-05-01","period_id":3},"counters":{"count":4,"data_segments":4,"flow":400}}]}`
+	if err := os.WriteFile(spillFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	agg := startTestAggregator(t, spillFile, 100)
+	if _, err := os.Stat(spillFile); err != nil {
+		t.Fatalf("spill file removed right after loading: %v", err)
+	}
+
+	// 写库失败，spill文件保留，进程此时退出下次启动仍可载入
+	if err := agg.Flush(); err == nil {
+		t.Fatal("flush into unmigrated database succeeded")
+	}
+	if _, err := os.Stat(spillFile); err != nil {
+		t.Fatalf("spill file removed after failed flush: %v", err)
+	}
+
+	if _, err := database.MigrateUp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(spillFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("spill file kept after successful flush: %v", err)
+	}
+	var station etc.BaseStation
+	if err := db.Table("base_station").Take(&station).Error; err != nil {
+		t.Fatal(err)
+	}
+	if station.ConnCount != 4 || station.TotalFlow != 400 {
+		t.Fatalf("base_station row %+v, want the spilled counters", station)
+	}
+}
+
+func TestAggregatorRequeueLimit(t *testing.T) {
+	newAggregatorTestDB(t)
+	agg := startTestAggregator(t, "", 3)
+	station := stationKey{StationID: 1, Date: "2024-05-01", PeriodID: 3}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"} {
+		agg.addUniverse(universeKey{StationID: 1, MAC: "aa:aa:aa:aa:aa:aa", IP: ip, Date: "2024-05-01", PeriodID: 3}, "", false, true, 100, 0)
+	}
+	agg.addStation(station, false, true, 400, 0)
+
+	if err := agg.Flush(); err == nil {
+		t.Fatal("flush into unmigrated database succeeded")
+	}
+	stats := agg.Stats()
+	if stats.PendingUniverse+stats.PendingStations != 3 || stats.RowsDropped != 2 {
+		t.Fatalf("pending %d+%d dropped %d, want 3 pending and 2 dropped", stats.PendingUniverse, stats.PendingStations, stats.RowsDropped)
+	}
+	// 基站记录优先放回
+	if stats.PendingStations != 1 {
+		t.Fatalf("station record dropped")
+	}
+
+	// 缓冲已满时，已在缓冲中的记录仍可累加
+	agg.addStation(station, false, true, 100, 0)
+	if err := agg.Flush(); err == nil {
+		t.Fatal("flush into unmigrated database succeeded")
+	}
+	if got := agg.Stats(); got.RowsDropped != 2 || agg.stations[station].Flow != 500 {
+		t.Fatalf("dropped %d station flow %d, want 2 and 500", got.RowsDropped, agg.stations[station].Flow)
+	}
+}
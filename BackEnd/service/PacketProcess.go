@@ -4,105 +4,114 @@ import (
 	"UserPortrait/Controllers"
 	"UserPortrait/etc"
 	"UserPortrait/functions"
-	"UserPortrait/service/database"
 	"errors"
 	"fmt"
-	"gorm.io/gorm"
 )
 
 // 根据解包脚本更新universe信息，保证流时、空时分布的核心
-// 需别处增加判定station_id的部分
+// 数据包先在内存中累加，由聚合器定期批量写库
+// stationId 由连接建立时的归属规则判定，未匹配时为 etc.UnassignedStation；remoteIP 为连接对端地址，用于私有地址的定位；
+// dataSegment 表示该包为TCP数据段，作为丢包率的分母
 
-func Packet2Universe(stationId uint, lossFlag bool, MAC string, IP string, datetime string, flow uint, latency uint) (err error) {
-	universeTable := functions.ChooseTable(stationId, "universe")
-	db, err := database.InitDB()
-	if err != nil {
-		return err
+func Packet2Universe(stationId uint, lossFlag bool, dataSegment bool, MAC string, IP string, remoteIP string, datetime string, flow uint, latency uint) (err error) {
+	if aggregator == nil {
+		return fmt.Errorf("aggregator not initialized")
 	}
-	var sql = Controllers.SqlController{DB: db}
 	if MAC == "" {
 		fmt.Println("MAC is empty")
 		return fmt.Errorf("err:MAC is empty")
 	}
-	var NotExist bool
-	var user etc.Userinfo
-	var newuni etc.Universe
-	var uni etc.Universe
-	var ID uint = 0
-	// 若已存在用户user保存了该MAC
-	FoundUser := db.Table("user_info").Where("mac_info = ?", MAC).Take(&user)
-	if FoundUser.Error != nil {
-		NotExist = errors.Is(FoundUser.Error, gorm.ErrRecordNotFound)
-		if !NotExist {
-			fmt.Println(FoundUser.Error)
-			return FoundUser.Error
-		}
+	// 分解时段信息
+	date, periodID, err := functions.GetPeriod(datetime)
+	if err != nil {
+		return err
 	}
-	if NotExist {
-		// 若该MAC未注册，创建用户NewUser，再更新或创建universe记录
-		newUser := etc.Userinfo{MacInfo: MAC}
-		db.Table("user_info").Create(&newUser)
-		ID = newUser.ID
-	} else {
-		ID = user.ID
+	aggregator.addUniverse(universeKey{StationID: stationId, MAC: MAC, IP: IP, Date: date, PeriodID: periodID}, remoteIP, lossFlag, dataSegment, flow, latency)
+	return nil
+}
+
+// 在Universe更改后执行，更新基站记录
+
+func Packet2BaseStation(stationId uint, lossFlag bool, dataSegment bool, datetime string, flow uint, latency uint) error {
+	if aggregator == nil {
+		return fmt.Errorf("aggregator not initialized")
 	}
-	// 分解时段信息
 	date, periodID, err := functions.GetPeriod(datetime)
 	if err != nil {
+		fmt.Println(err)
 		return err
 	}
+	aggregator.addStation(stationKey{StationID: stationId, Date: date, PeriodID: periodID}, lossFlag, dataSegment, flow, latency)
+	return nil
+}
 
-	FoundUniverse := db.Table(universeTable).Where("user_id =? AND ip =? AND date =? AND period_id =?", ID, IP, date, periodID).Take(&uni)
-	if FoundUniverse.Error != nil {
-		if errors.Is(FoundUniverse.Error, gorm.ErrRecordNotFound) {
-			newuni = etc.Universe{UserID: ID, Ip: IP, Date: date, Flow: flow, Latency: latency, PeriodID: periodID}
-			etc.UniverseChannel <- newuni
-			// 若该记录不存在，则创建记录
-			if err = sql.InsertUniverse(universeTable); err != nil {
+// 在同一事务中批量写入聚合数据，每条记录使用独立的保存点，返回写入失败的记录；
+// 事务提交后将新插入的universe记录加入异步定位队列
+func flushAggregated(universe map[universeKey]*counters, stations map[stationKey]*counters) (map[universeKey]*counters, map[stationKey]*counters, error) {
+	repos, err := getContainer()
+	if err != nil {
+		return universe, stations, err
+	}
+	failedUniverse := make(map[universeKey]*counters)
+	failedStations := make(map[stationKey]*counters)
+	var errs []error
+	var inserted []etc.Universe
+	err = repos.Transaction(func(tx *Container) error {
+		for key, c := range universe {
+			var record etc.Universe
+			var isNew bool
+			err := tx.Transaction(func(row *Container) (err error) {
+				record, isNew, err = flushUniverse(row, key, *c)
 				return err
+			})
+			if err != nil {
+				failedUniverse[key] = c
+				errs = append(errs, err)
+			} else if isNew {
+				inserted = append(inserted, record)
 			}
-		} else {
-			return FoundUniverse.Error
-		}
-	} else {
-		// 若该记录存在，即时间段与IP均重复，则累加flow，取latency平均；若LossFlag为true，则err_count+1
-		errCount := uni.ErrCount
-		flow += uni.Flow
-		if lossFlag {
-			errCount += 1
-			newuni = etc.Universe{UserID: uni.UserID, Ip: IP, Date: date, Flow: flow, Latency: uni.Latency, PeriodID: periodID, Count: uni.Count + 1, ErrCount: errCount}
-		} else {
-			latency = (uni.Latency*uni.Count + latency) / (uni.Count + 1)
-			newuni = etc.Universe{UserID: uni.UserID, Ip: IP, Date: date, Flow: flow, Latency: latency, PeriodID: periodID, Count: uni.Count + 1, ErrCount: uni.ErrCount}
 		}
-		etc.UniverseChannel <- newuni
-		if err := sql.UpdateUniverse(universeTable); err != nil {
-			return err
+		// 基站记录在universe之后更新
+		for key, c := range stations {
+			err := tx.Transaction(func(row *Container) error {
+				return flushStation(row, key, *c)
+			})
+			if err != nil {
+				failedStations[key] = c
+				errs = append(errs, err)
+			}
 		}
-
+		return nil
+	})
+	if err != nil {
+		// 提交失败，全部记录待重试
+		return universe, stations, err
 	}
-	return nil
+	enqueueLocations(inserted)
+	return failedUniverse, failedStations, errors.Join(errs...)
 }
 
-// 在Universe更改后执行，更新基站记录
-
-func Packet2BaseStation(stationId uint, lossFlag bool, datetime string, flow uint, latency uint) error {
-	stationTable := functions.ChooseTable(stationId, "base_station")
-	db, err := database.InitDB()
-	if err != nil {
-		return err
+// 写入一条universe记录，返回写入的记录及其是否为新插入
+func flushUniverse(repos *Container, key universeKey, c counters) (etc.Universe, bool, error) {
+	// 若已存在用户user保存了该MAC
+	user, err := repos.Users.FindUserByMAC(key.MAC)
+	if errors.Is(err, Controllers.ErrNotFound) {
+		// 若该MAC未注册，创建用户NewUser，再更新或创建universe记录
+		user = etc.Userinfo{MacInfo: key.MAC}
+		err = repos.Users.InsertUser(&user)
 	}
-	var sql = Controllers.SqlController{DB: db}
-	date, periodID, err := functions.GetPeriod(datetime)
 	if err != nil {
 		fmt.Println(err)
-		return err
+		return etc.Universe{}, false, err
 	}
-	var newrecord = etc.BaseStation{Date: date, PeriodID: periodID, TotalFlow: flow, AveLatency: latency}
-	if lossFlag {
-		newrecord.ErrCount = 1
-	}
-	etc.StationChannel <- newrecord
-	err = sql.UpdateStationAfterUni(stationTable)
-	return err
+
+	// 记录不存在则创建，已存在则累加
+	newuni := etc.Universe{StationID: key.StationID, UserID: user.ID, Ip: key.IP, Date: key.Date, Flow: c.Flow, Latency: c.latency(), LatencySamples: c.LatencySamples, PeriodID: key.PeriodID, Count: c.Count, ErrCount: c.ErrCount, DataSegments: c.DataSegments, LocSource: etc.LocPending, RemoteIp: c.RemoteIP}
+	isNew, err := repos.Universe.UpsertUniverse(newuni)
+	return newuni, isNew, err
+}
+
+func flushStation(repos *Container, key stationKey, c counters) error {
+	record := etc.BaseStation{StationID: key.StationID, Date: key.Date, PeriodID: key.PeriodID, ConnCount: c.Count, ErrCount: c.ErrCount, DataSegments: c.DataSegments, TotalFlow: c.Flow, AveLatency: c.latency(), LatencySamples: c.LatencySamples}
+	return repos.Stations.UpsertStation(record)
 }
@@ -2,22 +2,23 @@ package service
 
 import (
 	"UserPortrait/Controllers"
-	"UserPortrait/service/database"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-// 用户提交评分
+// 当前登录用户提交评分
 func SubmitScore(c *gin.Context) {
-	userID, _ := strconv.ParseUint(c.PostForm("id"), 10, 32)
+	userID, ok := currentOwnUserID(c)
+	if !ok {
+		return
+	}
 	score, _ := strconv.ParseFloat(c.PostForm("score"), 32)
 	date := time.Now().Format(time.DateOnly)
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -25,10 +26,9 @@ func SubmitScore(c *gin.Context) {
 		fmt.Printf("login err:%v", err)
 		return
 	}
-	sql := Controllers.SqlController{DB: db}
-	err = sql.FindScoreRecord(uint(userID), date)
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		err = sql.InsertScore(uint(userID), float32(score))
+	err = repos.Scores.FindScoreRecord(userID, date)
+	if errors.Is(err, Controllers.ErrNotFound) {
+		err = repos.Scores.InsertScore(userID, float32(score))
 		if err != nil {
 			fmt.Println("UID ", userID, ": InsertScore err:", err)
 
@@ -41,7 +41,7 @@ func SubmitScore(c *gin.Context) {
 			"message": "评分提交成功",
 		})
 	} else {
-		err = sql.UpdateScore(uint(userID), float32(score))
+		err = repos.Scores.UpdateScore(userID, float32(score))
 		if err != nil {
 			fmt.Println("UID ", userID, ": UpdateScore err:", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -57,7 +57,7 @@ func SubmitScore(c *gin.Context) {
 
 // 获取每日平均分的map列表
 func GetAverageScore(c *gin.Context) {
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -65,8 +65,7 @@ func GetAverageScore(c *gin.Context) {
 		fmt.Printf("login err:%v", err)
 		return
 	}
-	sql := Controllers.SqlController{DB: db}
-	scores, err := sql.AverageScoreByDate()
+	scores, err := repos.Scores.AverageScoreByDate()
 	if err != nil {
 		fmt.Println("GetAverageScore err:", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/etc"
+	"UserPortrait/parsePacket/attribution"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// 基站信息管理，请求体为 etc.Station 的JSON格式
+// 基站的网卡、网段、VLAN与网关MAC同时作为流量归属规则，增删改后立即生效
+
+func ListStations(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	stations, err := repos.Stations.ListStations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "获取基站列表失败,请重试",
+		})
+		fmt.Println("List stations error:", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取基站列表成功",
+		"data":    stations,
+	})
+}
+
+func GetStation(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	stationId, err := strconv.ParseUint(c.Query("station_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "基站ID无效",
+		})
+		return
+	}
+	station, err := repos.Stations.FindStationByID(uint(stationId))
+	if errors.Is(err, Controllers.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "基站不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "获取基站失败,请重试",
+		})
+		fmt.Println("Get station error:", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取基站成功",
+		"data":    station,
+	})
+}
+
+func CreateStation(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	var station etc.Station
+	if err := c.ShouldBindJSON(&station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "请求格式错误",
+		})
+		return
+	}
+	station.ID = 0
+	if err := validateStation(repos.Stations, station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	if err := repos.Stations.InsertStation(&station); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "创建基站失败,请重试",
+		})
+		fmt.Println("Create station error:", err)
+		return
+	}
+	reloadStationRules(repos.Stations)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "创建基站成功",
+		"data":    station,
+	})
+}
+
+func UpdateStation(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	var station etc.Station
+	if err := c.ShouldBindJSON(&station); err != nil || station.ID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "请求格式错误",
+		})
+		return
+	}
+	if err := validateStation(repos.Stations, station); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": err.Error(),
+		})
+		return
+	}
+	err = repos.Stations.UpdateStation(station)
+	if errors.Is(err, Controllers.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "基站不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "更新基站失败,请重试",
+		})
+		fmt.Println("Update station error:", err)
+		return
+	}
+	reloadStationRules(repos.Stations)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "更新基站成功",
+		"data":    station,
+	})
+}
+
+func DeleteStation(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	stationId, err := strconv.ParseUint(c.Query("station_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "基站ID无效",
+		})
+		return
+	}
+	err = repos.Stations.DeleteStation(uint(stationId))
+	if errors.Is(err, Controllers.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "基站不存在",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "删除基站失败,请重试",
+		})
+		fmt.Println("Delete station error:", err)
+		return
+	}
+	reloadStationRules(repos.Stations)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "删除基站成功",
+	})
+}
+
+// ReloadStationRules 管理员用：直接修改数据库后手动重新载入归属规则
+func ReloadStationRules(c *gin.Context) {
+	if err := LoadStationRules(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "载入归属规则失败,请重试",
+			"error":   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "载入归属规则成功",
+		"data":    attribution.GetStats(),
+	})
+}
+
+// LoadStationRules 从基站表载入流量归属规则
+func LoadStationRules() error {
+	repos, err := getContainer()
+	if err != nil {
+		return err
+	}
+	stations, err := repos.Stations.ListStations()
+	if err != nil {
+		return err
+	}
+	if err := attribution.SetRules(stationRules(stations)); err != nil {
+		return err
+	}
+	reloadGeoLocator()
+	return nil
+}
+
+func reloadStationRules(stationRepo Controllers.StationRepository) {
+	stations, err := stationRepo.ListStations()
+	if err == nil {
+		err = attribution.SetRules(stationRules(stations))
+	}
+	if err != nil {
+		fmt.Println("Reload station rules error:", err)
+	}
+	reloadGeoLocator()
+}
+
+func stationRules(stations []etc.Station) []attribution.Rule {
+	rules := make([]attribution.Rule, 0, len(stations))
+	for _, station := range stations {
+		rules = append(rules, attribution.Rule{
+			StationID:   station.ID,
+			Interfaces:  station.Interfaces,
+			Subnets:     station.Subnets,
+			VLANs:       station.VLANs,
+			GatewayMACs: station.GatewayMACs,
+		})
+	}
+	return rules
+}
+
+// 检查基站名称、坐标，并检查其归属规则格式及与其他基站是否冲突
+func validateStation(stationRepo Controllers.StationRepository, station etc.Station) error {
+	if station.Name == "" {
+		return errors.New("基站名称不能为空")
+	}
+	if station.Latitude < -90 || station.Latitude > 90 || station.Longitude < -180 || station.Longitude > 180 {
+		return errors.New("基站坐标无效")
+	}
+	if station.Radius < 0 {
+		return errors.New("覆盖半径无效")
+	}
+	stations, err := stationRepo.ListStations()
+	if err != nil {
+		return err
+	}
+	others := stations[:0]
+	for _, other := range stations {
+		if other.ID != station.ID {
+			others = append(others, other)
+		}
+	}
+	// 新建基站尚无ID，校验时使用占位ID
+	if station.ID == 0 {
+		station.ID = ^uint(0)
+	}
+	if err := attribution.Validate(stationRules(append(others, station))); err != nil {
+		return fmt.Errorf("归属规则无效: %v", err)
+	}
+	return nil
+}
+
+// SeedStations 按名称导入基站，已存在的同名基站被更新；全部在同一事务中完成，任一基站校验失败则全部回滚
+func SeedStations(stations []etc.Station) (created int, updated int, err error) {
+	repos, err := getContainer()
+	if err != nil {
+		return 0, 0, err
+	}
+	err = repos.Transaction(func(tx *Container) error {
+		created, updated = 0, 0
+		existing, err := tx.Stations.ListStations()
+		if err != nil {
+			return err
+		}
+		ids := make(map[string]uint, len(existing))
+		for _, station := range existing {
+			ids[station.Name] = station.ID
+		}
+		for _, station := range stations {
+			station.ID = ids[station.Name]
+			if err := validateStation(tx.Stations, station); err != nil {
+				return fmt.Errorf("station %q: %v", station.Name, err)
+			}
+			if station.ID != 0 {
+				if err := tx.Stations.UpdateStation(station); err != nil {
+					return err
+				}
+				updated++
+				continue
+			}
+			if err := tx.Stations.InsertStation(&station); err != nil {
+				return err
+			}
+			ids[station.Name] = station.ID
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	reloadStationRules(repos.Stations)
+	return created, updated, nil
+}
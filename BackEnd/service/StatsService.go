@@ -0,0 +1,27 @@
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync"
+)
+
+var statsProviders sync.Map
+
+// RegisterStats 注册运行指标提供者，由 GetRuntimeStats 统一输出
+func RegisterStats(name string, provider func() any) {
+	statsProviders.Store(name, provider)
+}
+
+// GetRuntimeStats 管理员用：获取抓包、处理等模块的运行指标
+func GetRuntimeStats(c *gin.Context) {
+	stats := gin.H{}
+	statsProviders.Range(func(key, value any) bool {
+		stats[key.(string)] = value.(func() any)()
+		return true
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "获取运行指标成功",
+		"data":    stats,
+	})
+}
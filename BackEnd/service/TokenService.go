@@ -0,0 +1,261 @@
+package service
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/configs"
+	"UserPortrait/etc"
+	"UserPortrait/token"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// 登录时签发短期access token与刷新token；刷新token只能使用一次，每次刷新时轮换。
+// 退出登录吊销当前access token与其刷新token族，退出全部登录与重置密码吊销该用户此前签发的全部token
+
+// tokenPair 登录与刷新接口返回的token
+type tokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// 签发一对token；family 为空时开始新的刷新token族
+func issueTokens(repos *Container, p token.Principal, family string) (tokenPair, error) {
+	auth := configs.Get().Auth
+	var accessToken string
+	var err error
+	switch p.Role {
+	case token.RoleUser:
+		accessToken, err = token.GenerateUserToken(p.ID)
+	case token.RoleAdmin:
+		accessToken, err = token.GenerateAdminToken(p.ID)
+	default:
+		err = token.ErrInvalidRole
+	}
+	if err != nil {
+		return tokenPair{}, err
+	}
+	if family == "" {
+		if family, err = token.NewFamily(); err != nil {
+			return tokenPair{}, err
+		}
+	}
+	refreshToken, hash, err := token.NewRefreshToken()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	record := etc.RefreshToken{
+		TokenHash: hash,
+		Family:    family,
+		Role:      p.Role,
+		SubjectID: p.ID,
+		ExpiresAt: time.Now().Add(auth.RefreshTokenLifespan),
+	}
+	if err := repos.Tokens.InsertRefreshToken(&record); err != nil {
+		return tokenPair{}, err
+	}
+	return tokenPair{AccessToken: accessToken, RefreshToken: refreshToken, ExpiresIn: int64(auth.TokenLifespan.Seconds())}, nil
+}
+
+// 为登录成功的用户或管理员签发token
+func issueLoginTokens(p token.Principal) (tokenPair, error) {
+	repos, err := getContainer()
+	if err != nil {
+		return tokenPair{}, err
+	}
+	return issueTokens(repos, p, "")
+}
+
+// RefreshToken 以刷新token换取新的一对token，旧刷新token随即作废；
+// 已作废的刷新token被再次使用时视为泄露，同族的全部刷新token一并作废
+func RefreshToken(c *gin.Context) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	refreshToken := c.PostForm("refresh_token")
+	if refreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "刷新token不能为空",
+		})
+		return
+	}
+	record, err := repos.Tokens.FindRefreshToken(token.HashRefreshToken(refreshToken))
+	if errors.Is(err, Controllers.ErrNotFound) || (err == nil && time.Now().After(record.ExpiresAt)) {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "刷新token无效或已过期,请重新登录",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库查询错误，请重试",
+		})
+		fmt.Println("Find refresh token error:", err)
+		return
+	}
+	var pair tokenPair
+	reused := false
+	err = repos.Transaction(func(tx *Container) error {
+		rotated, err := tx.Tokens.RevokeRefreshToken(record.ID)
+		if err != nil {
+			return err
+		}
+		if !rotated {
+			reused = true
+			return tx.Tokens.RevokeRefreshFamily(record.Family)
+		}
+		pair, err = issueTokens(tx, token.Principal{ID: record.SubjectID, Role: record.Role}, record.Family)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "刷新token失败,请重试",
+		})
+		fmt.Println("Refresh token error:", err)
+		return
+	}
+	if reused {
+		fmt.Printf("refresh token reused: %s %v, family %s revoked\n", record.Role, record.SubjectID, record.Family)
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "刷新token已失效,请重新登录",
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "刷新成功",
+		"data":    pair,
+	})
+}
+
+// Logout 退出登录：吊销本次请求的access token，表单中带 refresh_token 时一并作废其所在的刷新token族
+func Logout(c *gin.Context) {
+	principal, ok := token.GetPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "请先登录",
+		})
+		return
+	}
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	err = repos.Transaction(func(tx *Container) error {
+		if err := tx.Tokens.RevokeAccessToken(principal.TokenID, principal.ExpiresAt); err != nil {
+			return err
+		}
+		refreshToken := c.PostForm("refresh_token")
+		if refreshToken == "" {
+			return nil
+		}
+		record, err := tx.Tokens.FindRefreshToken(token.HashRefreshToken(refreshToken))
+		// 只能作废自己的刷新token
+		if errors.Is(err, Controllers.ErrNotFound) || (err == nil && (record.Role != principal.Role || record.SubjectID != principal.ID)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Tokens.RevokeRefreshFamily(record.Family)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "退出登录失败,请重试",
+		})
+		fmt.Println("Logout error:", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出登录",
+	})
+}
+
+// LogoutAll 退出全部登录：吊销当前用户或管理员此前签发的全部token，管理员签发的代入token一并失效；代入用户身份时不可用
+func LogoutAll(c *gin.Context) {
+	principal, ok := token.GetPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "请先登录",
+		})
+		return
+	}
+	if rejectImpersonation(c) {
+		return
+	}
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return
+	}
+	if err := revokeAllTokens(repos, principal.Role, principal.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "退出全部登录失败,请重试",
+		})
+		fmt.Println("Logout all error:", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "已退出全部登录",
+	})
+}
+
+// 吊销该用户或管理员此前签发的全部token，之后签发的token不受影响
+func revokeAllTokens(repos *Container, role string, subjectId uint) error {
+	return repos.Tokens.RevokeSubjectTokens(role, subjectId, time.Now().Truncate(time.Millisecond))
+}
+
+// InitTokenRevocation 使认证中间件检查吊销列表
+func InitTokenRevocation() {
+	token.SetRevocationChecker(func(claims *token.Claims) (bool, error) {
+		repos, err := getContainer()
+		if err != nil {
+			return false, err
+		}
+		principal, err := claims.Principal()
+		if err != nil {
+			return false, err
+		}
+		revoked, err := repos.Tokens.AccessTokenRevoked(claims.ID, principal.Role, principal.ID, claims.IssuedAt.Time)
+		if err != nil || revoked || principal.ImpersonatorID == 0 {
+			return revoked, err
+		}
+		// 代入token以被代入用户的身份记录，签发它的管理员退出全部登录时也一并失效
+		return repos.Tokens.SubjectTokensRevoked(token.RoleAdmin, principal.ImpersonatorID, claims.IssuedAt.Time)
+	})
+}
+
+// PurgeExpiredTokens 每隔 interval 清除已过期的刷新token与吊销记录，直至ctx取消
+func PurgeExpiredTokens(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			repos, err := getContainer()
+			if err == nil {
+				err = repos.Tokens.PurgeExpiredTokens(time.Now())
+			}
+			if err != nil {
+				fmt.Println("purge expired tokens failed:", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/etc"
+	"UserPortrait/token"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// 管理员查看指定用户的数据；用户接口均以token中的用户为准，管理员需通过以下接口或代入用户身份访问
+
+// LookupUser 管理员用：按 user_id、username 或 mac 查询用户
+func LookupUser(c *gin.Context) {
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "查询用户成功",
+		"data": gin.H{
+			"id":       user.ID,
+			"username": user.Username,
+			"mac_info": user.MacInfo,
+		},
+	})
+}
+
+// AdminGetUserDailyFlow 管理员用：指定用户近24小时的流量
+func AdminGetUserDailyFlow(c *gin.Context) {
+	if user, ok := targetUser(c); ok {
+		userDailyFlow(c, user.ID)
+	}
+}
+
+// AdminGetUserFreqLocation 管理员用：指定用户的常去地点
+func AdminGetUserFreqLocation(c *gin.Context) {
+	if user, ok := targetUser(c); ok {
+		userFreqLocation(c, user.ID)
+	}
+}
+
+// ImpersonateUser 管理员用：签发代入指定用户身份的短期token，可查看该用户的数据，修改类接口返回403
+func ImpersonateUser(c *gin.Context) {
+	admin, ok := token.GetPrincipal(c)
+	if !ok || admin.Role != token.RoleAdmin {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "请先登录",
+		})
+		return
+	}
+	user, ok := targetUser(c)
+	if !ok {
+		return
+	}
+	userToken, err := token.GenerateImpersonationToken(user.ID, admin.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "服务器内部错误",
+		})
+		fmt.Println("Impersonate error:", err)
+		return
+	}
+	fmt.Printf("admin %v impersonates user %v\n", admin.ID, user.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"message": "代入用户身份成功",
+		"token":   userToken,
+	})
+}
+
+// 按请求中的 user_id、username 或 mac（依次优先）查找目标用户，失败时已写入响应
+func targetUser(c *gin.Context) (etc.Userinfo, bool) {
+	repos, err := getContainer()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库连接失败,请重试",
+		})
+		fmt.Printf("DB err:%v\n", err)
+		return etc.Userinfo{}, false
+	}
+	var user etc.Userinfo
+	switch {
+	case c.Query("user_id") != "" || c.PostForm("user_id") != "":
+		userId, parseErr := strconv.ParseUint(c.DefaultQuery("user_id", c.PostForm("user_id")), 10, 32)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "用户ID无效",
+			})
+			return etc.Userinfo{}, false
+		}
+		user, err = repos.Users.FindUserByID(uint(userId))
+	case c.Query("username") != "":
+		user, err = repos.Users.FindUserByName(c.Query("username"))
+	case c.Query("mac") != "":
+		user, err = repos.Users.FindUserByMAC(c.Query("mac"))
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"message": "请指定 user_id、username 或 mac",
+		})
+		return etc.Userinfo{}, false
+	}
+	if errors.Is(err, Controllers.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"message": "用户不存在",
+		})
+		return etc.Userinfo{}, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"message": "数据库查询错误，请重试",
+		})
+		fmt.Println("Find user error:", err)
+		return etc.Userinfo{}, false
+	}
+	return user, true
+}
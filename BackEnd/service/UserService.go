@@ -5,16 +5,13 @@ import (
 	"UserPortrait/configs"
 	"UserPortrait/etc"
 	"UserPortrait/functions"
-	"UserPortrait/service/database"
 	"UserPortrait/token"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 	"net/http"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 )
@@ -23,7 +20,7 @@ import (
 
 func Register(c *gin.Context) {
 	context := c
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -31,7 +28,6 @@ func Register(c *gin.Context) {
 		fmt.Printf("register err:%v\n", err)
 		return
 	}
-	var sql = Controllers.SqlController{DB: db}
 	var user etc.Userinfo
 
 	newname := context.PostForm("username")
@@ -44,13 +40,19 @@ func Register(c *gin.Context) {
 		return
 	}
 	pswd, _ := bcrypt.GenerateFromPassword([]byte(context.PostForm("password")), bcrypt.DefaultCost)
-	user, err = sql.FindUserByMAC(newMAC)
+	user, err = repos.Users.FindUserByMAC(newMAC)
 	if err != nil {
 		// MAC不存在，可以注册
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, Controllers.ErrNotFound) {
 			fmt.Printf("register: 用户 %v 不存在，可以注册\n", newname)
 			user = etc.Userinfo{Username: newname, Password: string(pswd), MacInfo: newMAC}
-			sql.InsertUser(user)
+			if err := repos.Users.InsertUser(&user); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"message": "注册失败,请重试",
+				})
+				fmt.Printf("register err:%v\n", err)
+				return
+			}
 			context.JSON(http.StatusOK, gin.H{
 				"message": "恭喜您，注册成功！",
 			})
@@ -73,7 +75,13 @@ func Register(c *gin.Context) {
 			return
 		} else {
 			// MAC存在，而无user信息，仍需注册，此时用Update替换空串
-			sql.UpdateUserByID(user.ID, newname, string(pswd))
+			if err := repos.Users.UpdateUserByID(user.ID, newname, string(pswd)); err != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"message": "注册失败,请重试",
+				})
+				fmt.Printf("register err:%v\n", err)
+				return
+			}
 			context.JSON(http.StatusOK, gin.H{
 				"message": "恭喜您，注册成功！",
 			})
@@ -86,7 +94,7 @@ func Register(c *gin.Context) {
 // 用户登录
 func Login(c *gin.Context) {
 	context := c
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -95,12 +103,11 @@ func Login(c *gin.Context) {
 		fmt.Printf("login err:%v", err)
 		return
 	}
-	var sql = Controllers.SqlController{DB: db}
 	var user etc.Userinfo
 	username := context.PostForm("login_name")
-	user, err = sql.FindUserByName(username)
+	user, err = repos.Users.FindUserByName(username)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, Controllers.ErrNotFound) {
 			context.JSON(http.StatusUnauthorized, gin.H{
 				"message": "用户名不存在,请注册！",
 				"token":   "",
@@ -117,15 +124,21 @@ func Login(c *gin.Context) {
 		}
 	} else {
 		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(context.PostForm("login_password"))) == nil {
-			// 登录成功，返回生成的token
-			Token, errfortoken := token.GenerateUserToken(user.ID)
-			for errfortoken != nil {
-				Token, errfortoken = token.GenerateUserToken(user.ID)
-				fmt.Printf("login err:token generate failed,retrying\n")
+			// 登录成功，返回生成的access token与刷新token
+			pair, errfortoken := issueLoginTokens(token.Principal{ID: user.ID, Role: token.RoleUser})
+			if errfortoken != nil {
+				context.JSON(http.StatusInternalServerError, gin.H{
+					"message": "登录失败,请重试",
+					"token":   "",
+				})
+				fmt.Printf("login err:token generate failed:%v\n", errfortoken)
+				return
 			}
 			context.JSON(http.StatusOK, gin.H{
-				"message": "登录成功",
-				"token":   Token,
+				"message":       "登录成功",
+				"token":         pair.AccessToken,
+				"refresh_token": pair.RefreshToken,
+				"expires_in":    pair.ExpiresIn,
 			})
 			fmt.Printf("login: user %v login success\n", username)
 			return
@@ -140,9 +153,13 @@ func Login(c *gin.Context) {
 	}
 }
 
-// 用户头像上传
+// 用户头像上传，以当前登录用户的ID命名
 func UploadAvatar(c *gin.Context) {
 	context := c
+	userid, ok := currentOwnUserID(context)
+	if !ok {
+		return
+	}
 	image, err := context.FormFile("avatar")
 	if err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{
@@ -150,19 +167,28 @@ func UploadAvatar(c *gin.Context) {
 		})
 		return
 	}
-	imageType := strings.Split(image.Filename, ".")[1]
-	if imageType == "jpg" || imageType == "jpeg" || imageType == "png" {
-		userid := context.PostForm("user_id")
-		newfilename := fmt.Sprintf("%v.%v", userid, imageType)
-		dst := filepath.Join(configs.AvatarUploadPath, newfilename)
-		if err := c.SaveUploadedFile(image, dst); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		c.JSON(http.StatusOK, gin.H{"message": "头像保存成功"})
-	} else {
+	imageType, ok := avatarType(image.Filename)
+	if !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请上传jpg/jpeg/png格式图片"})
+		return
 	}
+	newfilename := fmt.Sprintf("%v.%v", userid, imageType)
+	dst := filepath.Join(configs.Get().Server.AvatarUploadPath, newfilename)
+	if err := c.SaveUploadedFile(image, dst); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "头像保存成功"})
+}
+
+// 按文件名最后一个扩展名判断头像格式，不区分大小写；无扩展名或格式不支持时返回false
+func avatarType(filename string) (string, bool) {
+	imageType := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	switch imageType {
+	case "jpg", "jpeg", "png":
+		return imageType, true
+	}
+	return "", false
 }
 
 // GetUserBasicInfo TODO: 用户基本信息获取
@@ -173,10 +199,14 @@ func GetUserBasicInfo(c *gin.Context) {
 	return
 }
 
-// 重置密码
+// 重置当前登录用户的密码，并吊销该用户已签发的全部token
 func ResetPassword(c *gin.Context) {
 	context := c
-	db, err := database.InitDB()
+	userId, ok := currentOwnUserID(context)
+	if !ok {
+		return
+	}
+	repos, err := getContainer()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -184,16 +214,14 @@ func ResetPassword(c *gin.Context) {
 		fmt.Printf("reset password err:%v\n", err)
 		return
 	}
-	var sql = Controllers.SqlController{DB: db}
 	var user etc.Userinfo
-	username := context.PostForm("username")
-	user, err = sql.FindUserByName(username)
+	user, err = repos.Users.FindUserByID(userId)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+		if errors.Is(err, Controllers.ErrNotFound) {
 			context.JSON(http.StatusUnauthorized, gin.H{
-				"message": "用户名不存在,请注册！",
+				"message": "用户不存在,请注册！",
 			})
-			fmt.Printf("reset password err:user %v is not existed\n", username)
+			fmt.Printf("reset password err:user %v is not existed\n", userId)
 			return
 		} else {
 			context.JSON(http.StatusInternalServerError, gin.H{
@@ -204,18 +232,38 @@ func ResetPassword(c *gin.Context) {
 		}
 	} else {
 		newpswd, _ := bcrypt.GenerateFromPassword([]byte(context.PostForm("password")), bcrypt.DefaultCost)
-		sql.UpdateUserByID(user.ID, user.Username, string(newpswd))
+		// 修改密码后吊销该用户已签发的全部token，需重新登录
+		err := repos.Transaction(func(tx *Container) error {
+			if err := tx.Users.UpdateUserByID(user.ID, user.Username, string(newpswd)); err != nil {
+				return err
+			}
+			return revokeAllTokens(tx, token.RoleUser, user.ID)
+		})
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{
+				"message": "密码重置失败,请重试",
+			})
+			fmt.Printf("reset password err:%v\n", err)
+			return
+		}
 		context.JSON(http.StatusOK, gin.H{
-			"message": "密码重置成功",
+			"message": "密码重置成功,请重新登录",
 		})
-		fmt.Printf("reset password: user %v reset password success\n", username)
+		fmt.Printf("reset password: user %v reset password success\n", user.Username)
 		return
 	}
 }
 
+// 当前登录用户近24小时的流量
 func GetUserDailyFlow(c *gin.Context) {
+	if userId, ok := currentUserID(c); ok {
+		userDailyFlow(c, userId)
+	}
+}
+
+func userDailyFlow(c *gin.Context, userId uint) {
 	//TODO: 查询返回近24小时流量信息
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -223,9 +271,6 @@ func GetUserDailyFlow(c *gin.Context) {
 		fmt.Printf("login err:%v", err)
 		return
 	}
-	id_string := c.Query("user_id")
-	userId, _ := strconv.ParseUint(id_string, 10, 64)
-	sql := Controllers.SqlController{DB: db}
 	Yesterday, Today, lastPeriodId, currPeriodId, err := functions.GetDailyInfo()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -233,7 +278,7 @@ func GetUserDailyFlow(c *gin.Context) {
 		})
 		return
 	}
-	result, err := sql.UserDailyFlow(uint(userId), Yesterday, Today, lastPeriodId, currPeriodId)
+	result, err := repos.Users.UserDailyFlow(userId, Yesterday, Today, lastPeriodId, currPeriodId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "获取用户流量信息失败,请重试",
@@ -248,9 +293,16 @@ func GetUserDailyFlow(c *gin.Context) {
 	return
 }
 
+// 当前登录用户的常去地点
 func GetFreqLocation(c *gin.Context) {
+	if userId, ok := currentUserID(c); ok {
+		userFreqLocation(c, userId)
+	}
+}
+
+func userFreqLocation(c *gin.Context, userId uint) {
 	//TODO: 查询用户常用地点信息
-	db, err := database.InitDB()
+	repos, err := getContainer()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "数据库连接失败,请重试",
@@ -258,10 +310,7 @@ func GetFreqLocation(c *gin.Context) {
 		fmt.Printf("DB err:%v", err)
 		return
 	}
-	id_string := c.Query("user_id")
-	userId, _ := strconv.ParseUint(id_string, 10, 64)
-	sql := Controllers.SqlController{DB: db}
-	result, err := sql.UserFreqLoc(uint(userId), "universe1")
+	result, err := repos.Users.UserFreqLoc(userId)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "获取用户常用地点信息失败,请重试",
@@ -274,6 +323,43 @@ func GetFreqLocation(c *gin.Context) {
 	})
 }
 
+// 获取认证中间件记录的当前用户ID，未登录时返回401
+func currentUserID(c *gin.Context) (uint, bool) {
+	principal, ok := token.GetPrincipal(c)
+	if !ok || principal.Role != token.RoleUser {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"message": "请先登录",
+		})
+		return 0, false
+	}
+	return principal.ID, true
+}
+
+// 获取可修改账号数据的当前用户ID：管理员代入用户身份时只能查看，修改类接口返回403
+func currentOwnUserID(c *gin.Context) (uint, bool) {
+	userId, ok := currentUserID(c)
+	if !ok {
+		return 0, false
+	}
+	if rejectImpersonation(c) {
+		return 0, false
+	}
+	return userId, true
+}
+
+// 本次请求使用代入token时返回403并返回true
+func rejectImpersonation(c *gin.Context) bool {
+	principal, _ := token.GetPrincipal(c)
+	if principal.ImpersonatorID == 0 {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{
+		"message": "代入用户身份时只能查看，不能修改",
+	})
+	fmt.Printf("admin %v impersonating user %v tried %s\n", principal.ImpersonatorID, principal.ID, c.FullPath())
+	return true
+}
+
 // Ping 插入数据测试
 func Ping(c *gin.Context) {
 	cc := c
@@ -0,0 +1,28 @@
+package service
+
+import "testing"
+
+func TestAvatarType(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+		ok       bool
+	}{
+		{"avatar.png", "png", true},
+		{"avatar.JPG", "jpg", true},
+		{"my.photo.jpeg", "jpeg", true},
+		{"avatar.png.exe", "", false},
+		{"avatar", "", false},
+		{"avatar.", "", false},
+		{".png", "png", true},
+		{"avatar.gif", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, ok := avatarType(tt.filename)
+			if got != tt.want || ok != tt.ok {
+				t.Fatalf("avatarType(%q) = %q, %t, want %q, %t", tt.filename, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
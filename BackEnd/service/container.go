@@ -0,0 +1,77 @@
+package service
+
+import (
+	"UserPortrait/Controllers"
+	"UserPortrait/service/database"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// Container 处理函数所依赖的数据访问接口
+type Container struct {
+	Users    Controllers.UserRepository
+	Admins   Controllers.AdminRepository
+	Universe Controllers.UniverseRepository
+	Stations Controllers.StationRepository
+	Scores   Controllers.ScoreRepository
+	Tokens   Controllers.TokenRepository
+	Export   Controllers.ExportRepository
+
+	// transaction 在同一事务中执行fn，为空时直接执行
+	transaction func(fn func(*Container) error) error
+}
+
+// NewSQLContainer 以gorm连接构建容器，Transaction 中的容器绑定事务，嵌套调用时使用保存点
+func NewSQLContainer(db *gorm.DB) *Container {
+	sql := &Controllers.SqlController{DB: db}
+	return &Container{
+		Users:    sql,
+		Admins:   sql,
+		Universe: sql,
+		Stations: sql,
+		Scores:   sql,
+		Tokens:   sql,
+		Export:   sql,
+		transaction: func(fn func(*Container) error) error {
+			return db.Transaction(func(tx *gorm.DB) error {
+				return fn(NewSQLContainer(tx))
+			})
+		},
+	}
+}
+
+// Transaction 在同一事务中执行fn，fn返回错误时回滚
+func (c *Container) Transaction(fn func(*Container) error) error {
+	if c.transaction == nil {
+		return fn(c)
+	}
+	return c.transaction(fn)
+}
+
+var (
+	containerMu sync.Mutex
+	container   *Container
+)
+
+// InitContainer 注入容器，测试中可注入替身实现
+func InitContainer(c *Container) {
+	containerMu.Lock()
+	defer containerMu.Unlock()
+	container = c
+}
+
+// 获取容器，未注入时按数据库配置创建
+func getContainer() (*Container, error) {
+	containerMu.Lock()
+	defer containerMu.Unlock()
+	if container != nil {
+		return container, nil
+	}
+	db, err := database.InitDB()
+	if err != nil {
+		return nil, err
+	}
+	container = NewSQLContainer(db)
+	return container, nil
+}
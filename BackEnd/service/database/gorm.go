@@ -3,36 +3,130 @@ package database
 import (
 	"UserPortrait/configs"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// 支持的数据库驱动
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
+// Options 数据库连接配置
+type Options struct {
+	// Driver 为 mysql 或 sqlite
+	Driver string
+	// DSN sqlite为数据库文件路径，":memory:" 表示内存数据库
+	DSN             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// OptionsFrom 由配置生成连接参数，mysql未指定DSN时按主机、账号与库名拼接
+func OptionsFrom(cfg configs.DatabaseConfig) Options {
+	opts := Options{
+		Driver:          cfg.Driver,
+		DSN:             cfg.DSN,
+		MaxOpenConns:    cfg.MaxOpenConns,
+		MaxIdleConns:    cfg.MaxIdleConns,
+		ConnMaxLifetime: cfg.ConnMaxLifetime,
+	}
+	if opts.Driver == DriverMySQL && opts.DSN == "" {
+		opts.DSN = cfg.User + ":" + cfg.Password + "@tcp(" + cfg.Host + ")/" + cfg.Name + "?charset=utf8mb4&parseTime=True"
+	}
+	return opts
+}
+
+// DefaultOptions 使用当前配置中的数据库连接参数
+func DefaultOptions() Options {
+	return OptionsFrom(configs.Get().Database)
+}
+
 // Gorm会自动创建和管理连接池，因此不需手动关闭连接
-var db *gorm.DB
+var (
+	mu      sync.Mutex
+	db      *gorm.DB
+	options = DefaultOptions()
+)
+
+// Configure 设置数据库连接配置，仅在启动时、首次 InitDB 之前调用。
+// 服务容器缓存了首次建立的连接，连接建立后的调用被忽略，数据库配置修改后需重启生效
+func Configure(opts Options) {
+	mu.Lock()
+	defer mu.Unlock()
+	if db != nil {
+		fmt.Println("database already connected, new database options take effect after restart")
+		return
+	}
+	options = opts
+}
 
 func InitDB() (*gorm.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
 	if db != nil {
 		return db, nil
-	} else {
-		dsn := configs.DBUser + ":" + configs.DBPassword + "@tcp(" + configs.DBHost + ")/IUPG?charset=utf8mb4&parseTime=True"
-		newDb, err := gorm.Open(mysql.Open(dsn), &gorm.Config{
-			DisableForeignKeyConstraintWhenMigrating: true,
-			Logger:                                   logger.Default.LogMode(logger.Warn),
-		})
-		db = newDb
-		if err != nil {
-			errors := fmt.Errorf("failed to connect database, %v", err)
-			return nil, errors
-		}
-		sqlDB, err := newDb.DB()
-		if err != nil {
-			errors := fmt.Errorf("failed to get database connection, %v", err)
-			return nil, errors
-		}
-		sqlDB.SetMaxOpenConns(configs.DBMaxOpenConns)
-		sqlDB.SetMaxIdleConns(configs.DBMaxIdleConns)
-		sqlDB.SetConnMaxLifetime(configs.DBConnMaxLifetime)
-		return newDb, nil
 	}
+	newDb, err := Open(options)
+	if err != nil {
+		return nil, err
+	}
+	db = newDb
+	return db, nil
+}
+
+// Open 按配置建立新的数据库连接，不影响 InitDB 使用的共享连接
+func Open(opts Options) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+	switch opts.Driver {
+	case DriverMySQL:
+		dialector = mysql.Open(opts.DSN)
+	case DriverSQLite:
+		dialector = sqlite.Open(sqliteDSN(opts.DSN))
+		// SQLite同一时刻只允许一个写连接；内存数据库每个连接相互独立，必须共用一个连接
+		opts.MaxOpenConns, opts.MaxIdleConns = 1, 1
+		opts.ConnMaxLifetime = 0
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", opts.Driver)
+	}
+	newDb, err := gorm.Open(dialector, &gorm.Config{
+		DisableForeignKeyConstraintWhenMigrating: true,
+		Logger:                                   logger.Default.LogMode(logger.Warn),
+	})
+	if err != nil {
+		errors := fmt.Errorf("failed to connect database, %v", err)
+		return nil, errors
+	}
+	sqlDB, err := newDb.DB()
+	if err != nil {
+		errors := fmt.Errorf("failed to get database connection, %v", err)
+		return nil, errors
+	}
+	sqlDB.SetMaxOpenConns(opts.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(opts.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(opts.ConnMaxLifetime)
+	return newDb, nil
+}
+
+// 默认使用内存数据库，并设置忙等待超时以减少 database is locked 错误
+func sqliteDSN(dsn string) string {
+	if dsn == "" {
+		dsn = ":memory:"
+	}
+	if strings.Contains(dsn, "_pragma=busy_timeout") {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "_pragma=busy_timeout(5000)"
 }
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration 一个版本的表结构变更，版本号递增且发布后不可修改
+// MySQL的DDL会隐式提交事务，Down需能在Up执行到一半时重复执行
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration 已执行的迁移记录
+type SchemaMigration struct {
+	Version   uint      `gorm:"primary_key;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(128)"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (m *SchemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationState 迁移的执行状态
+type MigrationState struct {
+	Version   uint
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+func sortedMigrations() []Migration {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	return sorted
+}
+
+func appliedMigrations(db *gorm.DB) (map[uint]SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("create schema_migrations failed: %v", err)
+	}
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[uint]SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// MigrateUp 按版本顺序执行所有未执行的迁移，返回本次执行的迁移
+func MigrateUp(db *gorm.DB) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, m := range sortedMigrations() {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s up failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrateDown 按版本倒序回滚最近steps个已执行的迁移，返回本次回滚的迁移
+func MigrateDown(db *gorm.DB, steps int) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	sorted := sortedMigrations()
+	var done []Migration
+	for i := len(sorted) - 1; i >= 0 && len(done) < steps; i-- {
+		m := sorted[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", m.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d %s down failed: %v", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// MigrationStatus 返回全部迁移及其执行状态
+func MigrationStatus(db *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var states []MigrationState
+	for _, m := range sortedMigrations() {
+		record, ok := applied[m.Version]
+		states = append(states, MigrationState{Version: m.Version, Name: m.Name, Applied: ok, AppliedAt: record.AppliedAt})
+	}
+	return states, nil
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := Open(Options{Driver: DriverSQLite, DSN: ":memory:"})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	return db
+}
+
+func TestMigrateUpDownUp(t *testing.T) {
+	db := openTestDB(t)
+	for round := 0; round < 2; round++ {
+		if _, err := MigrateUp(db); err != nil {
+			t.Fatalf("round %d up: %v", round, err)
+		}
+		m := db.Migrator()
+		for _, index := range []string{"idx_universe_slot", "idx_universe_user", "idx_universe_loc_source"} {
+			if !m.HasIndex(&universeV5{}, index) {
+				t.Fatalf("round %d: index %s missing after up", round, index)
+			}
+		}
+		if !m.HasColumn(&universeV5{}, "RemoteIp") {
+			t.Fatalf("round %d: remote_ip missing after up", round)
+		}
+		// 逐个版本回滚，检查删除列后保留的索引
+		if _, err := MigrateDown(db, len(migrations)-3); err != nil {
+			t.Fatalf("round %d down to v3: %v", round, err)
+		}
+		if m.HasColumn(&universeV5{}, "LocSource") || m.HasColumn(&universeV5{}, "RemoteIp") {
+			t.Fatalf("round %d: columns kept after down", round)
+		}
+		for _, index := range []string{"idx_universe_slot", "idx_universe_user"} {
+			if !m.HasIndex(&universeV2{}, index) {
+				t.Fatalf("round %d: index %s lost after down", round, index)
+			}
+		}
+	}
+}
+
+func TestImportLegacyTables(t *testing.T) {
+	db := openTestDB(t)
+	statements := []string{
+		"CREATE TABLE universe2 (user_id integer, ip text, district text, city text, latitude real, longitude real, period_id integer, date text, count integer, flow integer, latency integer, err_count integer)",
+		"INSERT INTO universe2 VALUES (7, '10.0.0.2', '海淀区', '北京市', 39.9, 116.3, 3, '2024-05-01', 4, 1000, 20, 1)",
+		"INSERT INTO universe2 VALUES (8, '10.0.0.3', '', '', 0, 0, 3, '2024-05-01', 1, 10, 0, 0)",
+		"CREATE TABLE base_station2 (conn_count integer, err_count integer, date text, period_id integer, total_flow integer, ave_latency integer, loss_rate real)",
+		"INSERT INTO base_station2 VALUES (5, 1, '2024-05-01', 3, 1010, 20, 0.1)",
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("%s: %v", statement, err)
+		}
+	}
+	// 超过一批的旧表数据
+	const rows = legacyBatchSize*2 + 7
+	if err := db.Exec("CREATE TABLE base_station3 (conn_count integer, err_count integer, date text, period_id integer, total_flow integer, ave_latency integer, loss_rate real)").Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < rows; i++ {
+		if err := db.Exec("INSERT INTO base_station3 VALUES (1, 0, '2024-05-02', ?, 1, 1, 0)", i).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := MigrateUp(db); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	var station stationV2
+	if err := db.First(&station, 2).Error; err != nil {
+		t.Fatalf("legacy station not created: %v", err)
+	}
+	var stationCount int64
+	db.Model(&stationV2{}).Count(&stationCount)
+	if stationCount != 2 {
+		t.Fatalf("created %d stations, want only the ones with legacy tables", stationCount)
+	}
+
+	var records []universeV9
+	db.Order("user_id").Find(&records)
+	if len(records) != 2 {
+		t.Fatalf("imported %d universe rows, want 2", len(records))
+	}
+	tests := []struct {
+		userID    uint
+		count     uint
+		locSource string
+	}{
+		{7, 4, "tencent"},
+		{8, 1, "pending"},
+	}
+	for i, tt := range tests {
+		r := records[i]
+		// 导入的记录无法区分数据段，按数据包数计
+		if r.StationID != 2 || r.UserID != tt.userID || r.Count != tt.count || r.DataSegments != tt.count || r.LocSource != tt.locSource {
+			t.Errorf("universe row %d = station %d user %d count %d segments %d source %q, want station 2 user %d count %d source %q",
+				i, r.StationID, r.UserID, r.Count, r.DataSegments, r.LocSource, tt.userID, tt.count, tt.locSource)
+		}
+	}
+
+	var stations []baseStationV9
+	db.Where("station_id = ?", 2).Find(&stations)
+	if len(stations) != 1 || stations[0].StationID != 2 || stations[0].ConnCount != 5 || stations[0].DataSegments != 5 || stations[0].TotalFlow != 1010 {
+		t.Errorf("base station rows = %+v", stations)
+	}
+	var batched int64
+	db.Model(&baseStationV2{}).Where("station_id = ?", 3).Count(&batched)
+	if batched != rows {
+		t.Errorf("imported %d rows from base_station3, want %d", batched, rows)
+	}
+}
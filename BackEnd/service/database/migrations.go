@@ -0,0 +1,317 @@
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 按版本登记的迁移，新增表结构变更时在末尾追加新版本，不要修改已发布的版本；
+// 迁移只使用 schema.go 中的表结构快照，不引用 etc 中随代码变化的结构
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create_account_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&userInfoV1{}, &adminInfoV1{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&adminInfoV1{}, &userInfoV1{})
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create_station_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&stationV2{}, &universeV2{}, &baseStationV2{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&baseStationV2{}, &universeV2{}, &stationV2{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create_score_and_content_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&scoreV3{}, &contentTypeV3{}, &interestsV3{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&interestsV3{}, &contentTypeV3{}, &scoreV3{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "add_universe_loc_source",
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&universeV4{}, "LocSource"); err != nil {
+				return err
+			}
+			return m.CreateIndex(&universeV4{}, "idx_universe_loc_source")
+		},
+		Down: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropIndex(&universeV4{}, "idx_universe_loc_source"); err != nil {
+				return err
+			}
+			if err := m.DropColumn(&universeV4{}, "LocSource"); err != nil {
+				return err
+			}
+			// SQLite删除列时重建表，其余索引需重新创建
+			for _, index := range []string{"idx_universe_slot", "idx_universe_user"} {
+				if !m.HasIndex(&universeV2{}, index) {
+					if err := m.CreateIndex(&universeV2{}, index); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 5,
+		Name:    "add_universe_remote_ip",
+		Up: func(tx *gorm.DB) error {
+			return tx.Migrator().AddColumn(&universeV5{}, "RemoteIp")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumnKeepIndexes(tx, &universeV5{}, "RemoteIp", &universeV4{}, "idx_universe_slot", "idx_universe_user", "idx_universe_loc_source")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "create_token_tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&refreshTokenV6{}, &revokedTokenV6{}, &tokenRevocationV6{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&tokenRevocationV6{}, &revokedTokenV6{}, &refreshTokenV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "import_legacy_station_tables",
+		Up:      importLegacyTables,
+		// 导入的数据与新产生的数据已合并，无法区分，回滚时保留；旧表未被修改
+		Down: func(tx *gorm.DB) error { return nil },
+	},
+	{
+		Version: 8,
+		Name:    "add_latency_samples",
+		// 已有记录无法得知样本数，时延非0的记录按数据包数计
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&universeV8{}, "LatencySamples"); err != nil {
+				return err
+			}
+			if err := m.AddColumn(&baseStationV8{}, "LatencySamples"); err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE universe SET latency_samples = count WHERE latency > 0 AND latency_samples = 0").Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE base_station SET latency_samples = conn_count WHERE ave_latency > 0 AND latency_samples = 0").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumnKeepIndexes(tx, &universeV8{}, "LatencySamples", &universeV5{}, "idx_universe_slot", "idx_universe_user", "idx_universe_loc_source"); err != nil {
+				return err
+			}
+			return dropColumnKeepIndexes(tx, &baseStationV8{}, "LatencySamples", &baseStationV2{}, "idx_station_slot")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "add_data_segments",
+		// 已有记录无法区分数据段与其他数据包，按数据包数计，丢包率与迁移前一致
+		Up: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.AddColumn(&universeV9{}, "DataSegments"); err != nil {
+				return err
+			}
+			if err := m.AddColumn(&baseStationV9{}, "DataSegments"); err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE universe SET data_segments = count").Error; err != nil {
+				return err
+			}
+			return tx.Exec("UPDATE base_station SET data_segments = conn_count").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumnKeepIndexes(tx, &universeV9{}, "DataSegments", &universeV8{}, "idx_universe_slot", "idx_universe_user", "idx_universe_loc_source"); err != nil {
+				return err
+			}
+			return dropColumnKeepIndexes(tx, &baseStationV9{}, "DataSegments", &baseStationV8{}, "idx_station_slot")
+		},
+	},
+}
+
+// 删除列后按删除前的结构快照 prev 重建索引：SQLite删除列时重建表，其余索引会丢失
+func dropColumnKeepIndexes(tx *gorm.DB, model any, field string, prev any, indexes ...string) error {
+	m := tx.Migrator()
+	if err := m.DropColumn(model, field); err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if !m.HasIndex(prev, index) {
+			if err := m.CreateIndex(prev, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 旧版本按基站分表保存数据：universe1~4、base_station1~4 对应基站1~4；评分表 network_score 的结构未变，无需导入。
+// 旧表存在时将数据导入合并后的表，旧基站N记为ID为N的基站（不存在时以旧版默认坐标创建），
+// 唯一键冲突的记录保留新表中的数据；旧表保留不删除，确认数据无误后可手动删除
+
+type legacyUniverse struct {
+	UserID    uint
+	Ip        string
+	District  string
+	City      string
+	Latitude  float32
+	Longitude float32
+	PeriodID  uint
+	Date      string
+	Count     uint
+	Flow      uint
+	Latency   uint
+	ErrCount  uint
+}
+
+type legacyBaseStation struct {
+	ConnCount  uint
+	ErrCount   uint
+	Date       string
+	PeriodID   uint
+	TotalFlow  uint
+	AveLatency uint
+	LossRate   float32
+}
+
+const (
+	legacyStations  = 4
+	legacyBatchSize = 500
+)
+
+// 旧版本各基站的默认坐标
+var legacyStationLocation = [2]float32{39.9042, 116.4074}
+
+func importLegacyTables(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for i := uint(1); i <= legacyStations; i++ {
+		universeTable, stationTable := fmt.Sprintf("universe%d", i), fmt.Sprintf("base_station%d", i)
+		if !m.HasTable(universeTable) && !m.HasTable(stationTable) {
+			continue
+		}
+		if err := ensureLegacyStation(tx, i); err != nil {
+			return err
+		}
+		if m.HasTable(universeTable) {
+			n, err := importLegacyUniverse(tx, universeTable, i)
+			if err != nil {
+				return fmt.Errorf("import %s: %v", universeTable, err)
+			}
+			fmt.Printf("imported %d rows from %s\n", n, universeTable)
+		}
+		if m.HasTable(stationTable) {
+			n, err := importLegacyBaseStation(tx, stationTable, i)
+			if err != nil {
+				return fmt.Errorf("import %s: %v", stationTable, err)
+			}
+			fmt.Printf("imported %d rows from %s\n", n, stationTable)
+		}
+	}
+	return nil
+}
+
+func ensureLegacyStation(tx *gorm.DB, id uint) error {
+	var count int64
+	if err := tx.Model(&stationV2{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Create(&stationV2{
+		ID:        id,
+		Name:      fmt.Sprintf("基站%d", id),
+		Latitude:  legacyStationLocation[0],
+		Longitude: legacyStationLocation[1],
+	}).Error
+}
+
+// 旧表没有主键，按各行唯一的列排序后分页读取
+func importInBatches(tx *gorm.DB, table, order string, rows any, insert func() *gorm.DB) (int, error) {
+	imported := 0
+	for offset := 0; ; offset += legacyBatchSize {
+		result := tx.Table(table).Order(order).Limit(legacyBatchSize).Offset(offset).Find(rows)
+		if result.Error != nil {
+			return imported, result.Error
+		}
+		if result.RowsAffected == 0 {
+			return imported, nil
+		}
+		inserted := insert()
+		if inserted.Error != nil {
+			return imported, inserted.Error
+		}
+		imported += int(inserted.RowsAffected)
+		if result.RowsAffected < legacyBatchSize {
+			return imported, nil
+		}
+	}
+}
+
+func importLegacyUniverse(tx *gorm.DB, table string, stationID uint) (int, error) {
+	var rows []legacyUniverse
+	return importInBatches(tx, table, "date, period_id, user_id, ip", &rows, func() *gorm.DB {
+		records := make([]universeV5, 0, len(rows))
+		for _, row := range rows {
+			record := universeV5{
+				StationID: stationID,
+				UserID:    row.UserID,
+				Ip:        row.Ip,
+				District:  row.District,
+				City:      row.City,
+				Latitude:  row.Latitude,
+				Longitude: row.Longitude,
+				PeriodID:  row.PeriodID,
+				Date:      row.Date,
+				Count:     row.Count,
+				Flow:      row.Flow,
+				Latency:   row.Latency,
+				ErrCount:  row.ErrCount,
+			}
+			// 旧版本写入时同步调用腾讯地图定位，未定位的记录交由后台补充
+			record.LocSource = "pending"
+			if row.Latitude != 0 || row.Longitude != 0 {
+				record.LocSource = "tencent"
+			}
+			records = append(records, record)
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records)
+	})
+}
+
+func importLegacyBaseStation(tx *gorm.DB, table string, stationID uint) (int, error) {
+	var rows []legacyBaseStation
+	return importInBatches(tx, table, "date, period_id", &rows, func() *gorm.DB {
+		records := make([]baseStationV2, 0, len(rows))
+		for _, row := range rows {
+			records = append(records, baseStationV2{
+				StationID:  stationID,
+				ConnCount:  row.ConnCount,
+				ErrCount:   row.ErrCount,
+				Date:       row.Date,
+				PeriodID:   row.PeriodID,
+				TotalFlow:  row.TotalFlow,
+				AveLatency: row.AveLatency,
+				LossRate:   row.LossRate,
+			})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&records)
+	})
+}
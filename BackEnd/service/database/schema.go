@@ -0,0 +1,239 @@
+package database
+
+import "time"
+
+// 各版本迁移所用的表结构快照，与发布该版本时 etc 中的结构一致。
+// 迁移只引用这里的快照，etc 中的结构之后再变化也不影响已发布版本建出的表；快照发布后不要修改，
+// 结构变更时新增快照与迁移版本
+
+// v1
+
+type userInfoV1 struct {
+	ID       uint   `gorm:"primary_key;auto_increment"`
+	Username string `gorm:"type:varchar(16);index"`
+	Password string `gorm:"type:varchar(255)"`
+	MacInfo  string `gorm:"type:varchar(32);index"`
+}
+
+type adminInfoV1 struct {
+	ID        uint   `gorm:"primary_key;auto_increment"`
+	Adminname string `gorm:"type:varchar(16);uniqueIndex"`
+	Password  string `gorm:"type:varchar(255)"`
+}
+
+func (*userInfoV1) TableName() string  { return "user_info" }
+func (*adminInfoV1) TableName() string { return "admin_info" }
+
+// v2
+
+type stationV2 struct {
+	ID          uint     `gorm:"primary_key;auto_increment"`
+	Name        string   `gorm:"type:varchar(64);uniqueIndex"`
+	Latitude    float32  `gorm:"type:float"`
+	Longitude   float32  `gorm:"type:float"`
+	Radius      float32  `gorm:"type:float;default:0"`
+	Interfaces  []string `gorm:"type:text;serializer:json"`
+	Subnets     []string `gorm:"type:text;serializer:json"`
+	VLANs       []uint16 `gorm:"column:vlans;type:text;serializer:json"`
+	GatewayMACs []string `gorm:"column:gateway_macs;type:text;serializer:json"`
+}
+
+type universeV2 struct {
+	StationID uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1"`
+	UserID    uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1"`
+	Ip        string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3"`
+	District  string  `gorm:"type:varchar(64)"`
+	City      string  `gorm:"type:varchar(64)"`
+	Latitude  float32 `gorm:"type:float"`
+	Longitude float32 `gorm:"type:float"`
+	PeriodID  uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5"`
+	Date      string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2"`
+	Count     uint    `gorm:"default:1"`
+	Flow      uint    `gorm:"default:0"`
+	Latency   uint    `gorm:"default:0"`
+	ErrCount  uint    `gorm:"default:0"`
+}
+
+type baseStationV2 struct {
+	StationID  uint   `gorm:"uniqueIndex:idx_station_slot,priority:1"`
+	ConnCount  uint   `gorm:"default:1"`
+	ErrCount   uint   `gorm:"default:0"`
+	Date       string `gorm:"type:char(10);uniqueIndex:idx_station_slot,priority:2"`
+	PeriodID   uint   `gorm:"uniqueIndex:idx_station_slot,priority:3"`
+	TotalFlow  uint
+	AveLatency uint
+	LossRate   float32
+}
+
+func (*stationV2) TableName() string     { return "stations" }
+func (*universeV2) TableName() string    { return "universe" }
+func (*baseStationV2) TableName() string { return "base_station" }
+
+// v3
+
+type scoreV3 struct {
+	UserID uint    `gorm:"primary_key;autoIncrement:false"`
+	Score  float32 `gorm:"type:float;default:0"`
+	Date   string  `gorm:"type:char(10);primary_key;index"`
+}
+
+type contentTypeV3 struct {
+	ID      uint   `gorm:"primary_key;auto_increment"`
+	Content string `gorm:"type:varchar(255)"`
+	Count   uint   `gorm:"type:int;default:1"`
+}
+
+type interestsV3 struct {
+	UserID    uint `gorm:"primary_key;autoIncrement:false"`
+	ContentID uint `gorm:"primary_key;autoIncrement:false"`
+	Count     uint `gorm:"type:int;default:1"`
+}
+
+func (*scoreV3) TableName() string       { return "network_score" }
+func (*contentTypeV3) TableName() string { return "content_info" }
+func (*interestsV3) TableName() string   { return "content2user" }
+
+// v4
+
+type universeV4 struct {
+	StationID uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1"`
+	UserID    uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1"`
+	Ip        string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3"`
+	District  string  `gorm:"type:varchar(64)"`
+	City      string  `gorm:"type:varchar(64)"`
+	Latitude  float32 `gorm:"type:float"`
+	Longitude float32 `gorm:"type:float"`
+	PeriodID  uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5"`
+	Date      string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2"`
+	Count     uint    `gorm:"default:1"`
+	Flow      uint    `gorm:"default:0"`
+	Latency   uint    `gorm:"default:0"`
+	ErrCount  uint    `gorm:"default:0"`
+	LocSource string  `gorm:"type:varchar(16);default:'';index:idx_universe_loc_source"`
+}
+
+func (*universeV4) TableName() string { return "universe" }
+
+// v5
+
+type universeV5 struct {
+	StationID uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1"`
+	UserID    uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1"`
+	Ip        string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3"`
+	District  string  `gorm:"type:varchar(64)"`
+	City      string  `gorm:"type:varchar(64)"`
+	Latitude  float32 `gorm:"type:float"`
+	Longitude float32 `gorm:"type:float"`
+	PeriodID  uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5"`
+	Date      string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2"`
+	Count     uint    `gorm:"default:1"`
+	Flow      uint    `gorm:"default:0"`
+	Latency   uint    `gorm:"default:0"`
+	ErrCount  uint    `gorm:"default:0"`
+	LocSource string  `gorm:"type:varchar(16);default:'';index:idx_universe_loc_source"`
+	RemoteIp  string  `gorm:"type:varchar(45);default:''"`
+}
+
+func (*universeV5) TableName() string { return "universe" }
+
+// v6
+
+type refreshTokenV6 struct {
+	ID        uint      `gorm:"primary_key;auto_increment"`
+	TokenHash string    `gorm:"type:char(64);uniqueIndex"`
+	Family    string    `gorm:"type:char(32);index"`
+	Role      string    `gorm:"type:varchar(8);index:idx_refresh_subject,priority:1"`
+	SubjectID uint      `gorm:"index:idx_refresh_subject,priority:2"`
+	Revoked   bool      `gorm:"default:false"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+type revokedTokenV6 struct {
+	JTI       string    `gorm:"column:jti;type:char(32);primaryKey"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+type tokenRevocationV6 struct {
+	Role          string `gorm:"type:varchar(8);primaryKey"`
+	SubjectID     uint   `gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time
+}
+
+func (*refreshTokenV6) TableName() string    { return "refresh_token" }
+func (*revokedTokenV6) TableName() string    { return "revoked_token" }
+func (*tokenRevocationV6) TableName() string { return "token_revocation" }
+
+// v8
+
+type universeV8 struct {
+	StationID      uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1"`
+	UserID         uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1"`
+	Ip             string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3"`
+	District       string  `gorm:"type:varchar(64)"`
+	City           string  `gorm:"type:varchar(64)"`
+	Latitude       float32 `gorm:"type:float"`
+	Longitude      float32 `gorm:"type:float"`
+	PeriodID       uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5"`
+	Date           string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2"`
+	Count          uint    `gorm:"default:1"`
+	Flow           uint    `gorm:"default:0"`
+	Latency        uint    `gorm:"default:0"`
+	ErrCount       uint    `gorm:"default:0"`
+	LocSource      string  `gorm:"type:varchar(16);default:'';index:idx_universe_loc_source"`
+	RemoteIp       string  `gorm:"type:varchar(45);default:''"`
+	LatencySamples uint    `gorm:"default:0"`
+}
+
+type baseStationV8 struct {
+	StationID      uint   `gorm:"uniqueIndex:idx_station_slot,priority:1"`
+	ConnCount      uint   `gorm:"default:1"`
+	ErrCount       uint   `gorm:"default:0"`
+	Date           string `gorm:"type:char(10);uniqueIndex:idx_station_slot,priority:2"`
+	PeriodID       uint   `gorm:"uniqueIndex:idx_station_slot,priority:3"`
+	TotalFlow      uint
+	AveLatency     uint
+	LossRate       float32
+	LatencySamples uint `gorm:"default:0"`
+}
+
+func (*universeV8) TableName() string    { return "universe" }
+func (*baseStationV8) TableName() string { return "base_station" }
+
+// v9
+
+type universeV9 struct {
+	StationID      uint    `gorm:"uniqueIndex:idx_universe_slot,priority:1"`
+	UserID         uint    `gorm:"uniqueIndex:idx_universe_slot,priority:2;index:idx_universe_user,priority:1"`
+	Ip             string  `gorm:"type:varchar(45);uniqueIndex:idx_universe_slot,priority:3"`
+	District       string  `gorm:"type:varchar(64)"`
+	City           string  `gorm:"type:varchar(64)"`
+	Latitude       float32 `gorm:"type:float"`
+	Longitude      float32 `gorm:"type:float"`
+	PeriodID       uint    `gorm:"uniqueIndex:idx_universe_slot,priority:5"`
+	Date           string  `gorm:"type:char(10);uniqueIndex:idx_universe_slot,priority:4;index:idx_universe_user,priority:2"`
+	Count          uint    `gorm:"default:1"`
+	Flow           uint    `gorm:"default:0"`
+	Latency        uint    `gorm:"default:0"`
+	ErrCount       uint    `gorm:"default:0"`
+	LocSource      string  `gorm:"type:varchar(16);default:'';index:idx_universe_loc_source"`
+	RemoteIp       string  `gorm:"type:varchar(45);default:''"`
+	LatencySamples uint    `gorm:"default:0"`
+	DataSegments   uint    `gorm:"default:0"`
+}
+
+type baseStationV9 struct {
+	StationID      uint   `gorm:"uniqueIndex:idx_station_slot,priority:1"`
+	ConnCount      uint   `gorm:"default:1"`
+	ErrCount       uint   `gorm:"default:0"`
+	Date           string `gorm:"type:char(10);uniqueIndex:idx_station_slot,priority:2"`
+	PeriodID       uint   `gorm:"uniqueIndex:idx_station_slot,priority:3"`
+	TotalFlow      uint
+	AveLatency     uint
+	LossRate       float32
+	LatencySamples uint `gorm:"default:0"`
+	DataSegments   uint `gorm:"default:0"`
+}
+
+func (*universeV9) TableName() string    { return "universe" }
+func (*baseStationV9) TableName() string { return "base_station" }
@@ -0,0 +1,141 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CacheOptions TTL 为定位结果的缓存时长，NegativeTTL 为无法定位（ErrNotFound）结果的缓存时长，
+// 为0时不缓存；Size 为最多缓存的IP数
+type CacheOptions struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	Size        int
+}
+
+// CacheStats 缓存命中情况，HitRate 包含无法定位结果的命中
+type CacheStats struct {
+	Size         int     `json:"size"`
+	Hits         uint64  `json:"hits"`
+	NegativeHits uint64  `json:"negative_hits"`
+	Misses       uint64  `json:"misses"`
+	HitRate      float64 `json:"hit_rate"`
+}
+
+type cacheEntry struct {
+	loc     Location
+	found   bool
+	expires time.Time
+}
+
+// Cache 按IP缓存定位结果，其他错误不缓存
+type Cache struct {
+	mu      sync.Mutex
+	next    GeoLocator
+	opts    CacheOptions
+	entries map[netip.Addr]cacheEntry
+	// generation 在每次 Reset 时递增，用于丢弃旧来源的查询结果
+	generation uint64
+
+	hits         atomic.Uint64
+	negativeHits atomic.Uint64
+	misses       atomic.Uint64
+
+	now func() time.Time
+}
+
+func NewCache(next GeoLocator, opts CacheOptions) *Cache {
+	return &Cache{next: next, opts: opts, entries: make(map[netip.Addr]cacheEntry), now: time.Now}
+}
+
+func (c *Cache) Name() string {
+	return "cache"
+}
+
+func (c *Cache) Locate(ctx context.Context, ip netip.Addr) (Location, error) {
+	ip = ip.Unmap()
+	c.mu.Lock()
+	entry, ok := c.entries[ip]
+	next, generation := c.next, c.generation
+	c.mu.Unlock()
+	if ok && c.now().Before(entry.expires) {
+		if entry.found {
+			c.hits.Add(1)
+			return entry.loc, nil
+		}
+		c.negativeHits.Add(1)
+		return Location{}, ErrNotFound
+	}
+	c.misses.Add(1)
+
+	loc, err := next.Locate(ctx, ip)
+	switch {
+	case err == nil:
+		c.store(generation, ip, cacheEntry{loc: loc, found: true}, c.opts.TTL)
+	case errors.Is(err, ErrNotFound):
+		c.store(generation, ip, cacheEntry{}, c.opts.NegativeTTL)
+	}
+	return loc, err
+}
+
+// 来源已被 Reset 替换时丢弃旧来源的结果
+func (c *Cache) store(generation uint64, ip netip.Addr, entry cacheEntry, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	now := c.now()
+	entry.expires = now.Add(ttl)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return
+	}
+	if _, ok := c.entries[ip]; !ok && len(c.entries) >= c.opts.Size {
+		c.evict(now)
+	}
+	c.entries[ip] = entry
+}
+
+// 先清除过期项，仍已满时随机清除十分之一
+func (c *Cache) evict(now time.Time) {
+	for ip, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, ip)
+		}
+	}
+	for ip := range c.entries {
+		if len(c.entries) < c.opts.Size-c.opts.Size/10 {
+			break
+		}
+		delete(c.entries, ip)
+	}
+}
+
+// Reset 替换定位来源与缓存参数并清空缓存，命中统计保留
+func (c *Cache) Reset(next GeoLocator, opts CacheOptions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next, c.opts = next, opts
+	c.generation++
+	c.entries = make(map[netip.Addr]cacheEntry)
+}
+
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+	stats := CacheStats{
+		Size:         size,
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+	}
+	if total := stats.Hits + stats.NegativeHits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits+stats.NegativeHits) / float64(total)
+	}
+	return stats
+}
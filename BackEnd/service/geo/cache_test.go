@@ -0,0 +1,131 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// 返回使用可调时钟的缓存
+func newTestCache(next GeoLocator, opts CacheOptions) (*Cache, *time.Time) {
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	cache := NewCache(next, opts)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+func TestCacheTTL(t *testing.T) {
+	next := &fakeLocator{name: "mmdb", results: map[string]Location{"8.8.8.8": {City: "mmdb"}}}
+	cache, now := newTestCache(next, CacheOptions{TTL: time.Hour, NegativeTTL: time.Minute, Size: 10})
+	ctx := context.Background()
+	found, missing := netip.MustParseAddr("8.8.8.8"), netip.MustParseAddr("9.9.9.9")
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		ip        netip.Addr
+		wantCalls int64
+	}{
+		{"first lookup", 0, found, 1},
+		{"cached", 59 * time.Minute, found, 1},
+		{"expired", time.Minute, found, 2},
+		{"not found", 0, missing, 3},
+		{"negative cached", 59 * time.Second, missing, 3},
+		{"negative expired", time.Second, missing, 4},
+	}
+	for _, step := range steps {
+		*now = now.Add(step.advance)
+		loc, err := cache.Locate(ctx, step.ip)
+		if step.ip == found && (err != nil || loc.City != "mmdb") {
+			t.Fatalf("%s: Locate = %+v, %v", step.name, loc, err)
+		}
+		if step.ip == missing && !errors.Is(err, ErrNotFound) {
+			t.Fatalf("%s: err %v, want ErrNotFound", step.name, err)
+		}
+		if got := next.calls.Load(); got != step.wantCalls {
+			t.Fatalf("%s: %d lookups, want %d", step.name, got, step.wantCalls)
+		}
+	}
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.NegativeHits != 1 || stats.Misses != 4 {
+		t.Fatalf("stats %+v, want 1 hit, 1 negative hit, 4 misses", stats)
+	}
+}
+
+func TestCacheSkipsErrorsAndZeroNegativeTTL(t *testing.T) {
+	ctx := context.Background()
+	ip := netip.MustParseAddr("9.9.9.9")
+
+	broken := &fakeLocator{name: "tencent", err: errors.New("timeout")}
+	cache, _ := newTestCache(broken, CacheOptions{TTL: time.Hour, NegativeTTL: time.Hour, Size: 10})
+	cache.Locate(ctx, ip)
+	cache.Locate(ctx, ip)
+	if got := broken.calls.Load(); got != 2 {
+		t.Fatalf("provider errors cached: %d lookups, want 2", got)
+	}
+
+	empty := &fakeLocator{name: "mmdb"}
+	cache, _ = newTestCache(empty, CacheOptions{TTL: time.Hour, Size: 10})
+	cache.Locate(ctx, ip)
+	cache.Locate(ctx, ip)
+	if got := empty.calls.Load(); got != 2 {
+		t.Fatalf("not found cached with zero negative_ttl: %d lookups, want 2", got)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	next := &fakeLocator{name: "mmdb"}
+	cache, _ := newTestCache(next, CacheOptions{TTL: time.Hour, NegativeTTL: time.Hour, Size: 10})
+	for i := 0; i < 25; i++ {
+		cache.Locate(context.Background(), netip.AddrFrom4([4]byte{8, 8, 8, byte(i)}))
+		if size := cache.Stats().Size; size > 10 {
+			t.Fatalf("cache holds %d entries, limit 10", size)
+		}
+	}
+}
+
+// blockingLocator 在 release 关闭前阻塞查询，用于模拟查询过程中来源被替换
+type blockingLocator struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingLocator) Name() string {
+	return "slow"
+}
+
+func (b *blockingLocator) Locate(_ context.Context, _ netip.Addr) (Location, error) {
+	close(b.started)
+	<-b.release
+	return Location{City: "old"}, nil
+}
+
+func TestCacheResetDropsStaleResults(t *testing.T) {
+	old := &blockingLocator{started: make(chan struct{}), release: make(chan struct{})}
+	cache, _ := newTestCache(old, CacheOptions{TTL: time.Hour, Size: 10})
+	ip := netip.MustParseAddr("8.8.8.8")
+
+	done := make(chan Location)
+	go func() {
+		loc, _ := cache.Locate(context.Background(), ip)
+		done <- loc
+	}()
+	<-old.started
+	next := &fakeLocator{name: "mmdb", results: map[string]Location{"8.8.8.8": {City: "new"}}}
+	cache.Reset(next, CacheOptions{TTL: time.Hour, Size: 10})
+	close(old.release)
+	if loc := <-done; loc.City != "old" {
+		t.Fatalf("in-flight lookup returned %q, want the old result", loc.City)
+	}
+
+	// 旧来源的结果不写入缓存，下一次查询使用新来源
+	loc, err := cache.Locate(context.Background(), ip)
+	if err != nil || loc.City != "new" {
+		t.Fatalf("Locate after Reset = %+v, %v, want the new provider's result", loc, err)
+	}
+	if got := next.calls.Load(); got != 1 {
+		t.Fatalf("new provider queried %d times, want 1", got)
+	}
+}
@@ -0,0 +1,57 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+)
+
+// ErrNotFound 该来源没有此IP的位置信息，Chain 遇到时继续尝试下一个来源
+var ErrNotFound = errors.New("geo: location not found")
+
+// Location IP对应的位置，Source 为给出该结果的来源名称，来源未填写时由 Chain 填入来源的 Name
+type Location struct {
+	City      string  `json:"city"`
+	District  string  `json:"district"`
+	Latitude  float32 `json:"latitude"`
+	Longitude float32 `json:"longitude"`
+	Source    string  `json:"source"`
+}
+
+// GeoLocator IP定位来源
+type GeoLocator interface {
+	Name() string
+	Locate(ctx context.Context, ip netip.Addr) (Location, error)
+}
+
+// Chain 按顺序依次尝试各来源，返回第一个成功的结果
+type Chain []GeoLocator
+
+func (c Chain) Name() string {
+	return "chain"
+}
+
+// Locate 全部来源均为 ErrNotFound 时返回 ErrNotFound，否则返回各来源的错误
+func (c Chain) Locate(ctx context.Context, ip netip.Addr) (Location, error) {
+	var errs []error
+	for _, locator := range c {
+		loc, err := locator.Locate(ctx, ip)
+		if err == nil {
+			if loc.Source == "" {
+				loc.Source = locator.Name()
+			}
+			return loc, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %v", locator.Name(), err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return Location{}, errors.Join(errs...)
+	}
+	return Location{}, ErrNotFound
+}
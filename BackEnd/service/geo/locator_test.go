@@ -0,0 +1,94 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeLocator 按IP返回预设结果，未预设的IP返回 err（默认 ErrNotFound），并记录查询次数
+type fakeLocator struct {
+	name    string
+	results map[string]Location
+	err     error
+	calls   atomic.Int64
+}
+
+func (f *fakeLocator) Name() string {
+	return f.name
+}
+
+func (f *fakeLocator) Locate(_ context.Context, ip netip.Addr) (Location, error) {
+	f.calls.Add(1)
+	if loc, ok := f.results[ip.String()]; ok {
+		return loc, nil
+	}
+	if f.err != nil {
+		return Location{}, f.err
+	}
+	return Location{}, ErrNotFound
+}
+
+func TestChainOrder(t *testing.T) {
+	static := NewStaticLocator([]StaticEntry{
+		{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Location: Location{City: "内网"}},
+		{Prefix: netip.MustParsePrefix("10.1.0.0/16"), Location: Location{City: "基站A", Source: "station"}},
+	})
+	mmdb := &fakeLocator{name: "mmdb", results: map[string]Location{"1.1.1.1": {City: "mmdb"}, "8.8.8.8": {City: "mmdb"}}}
+	tencent := &fakeLocator{name: "tencent", results: map[string]Location{"8.8.8.8": {City: "tencent"}, "9.9.9.9": {City: "tencent"}}}
+	chain := Chain{static, PublicOnly(mmdb), PublicOnly(tencent)}
+
+	tests := []struct {
+		name       string
+		ip         string
+		wantCity   string
+		wantSource string
+	}{
+		{"static first", "10.2.3.4", "内网", "static"},
+		{"static keeps entry source", "10.1.2.3", "基站A", "station"},
+		{"mmdb before tencent", "8.8.8.8", "mmdb", "mmdb"},
+		{"fall back to tencent", "9.9.9.9", "tencent", "tencent"},
+		{"ipv4-mapped address", "::ffff:10.2.3.4", "内网", "static"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := chain.Locate(context.Background(), netip.MustParseAddr(tt.ip))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loc.City != tt.wantCity || loc.Source != tt.wantSource {
+				t.Fatalf("Locate(%s) = %s/%s, want %s/%s", tt.ip, loc.City, loc.Source, tt.wantCity, tt.wantSource)
+			}
+		})
+	}
+
+	// 特殊地址未命中静态表时不查询公网来源
+	before := mmdb.calls.Load() + tencent.calls.Load()
+	if _, err := chain.Locate(context.Background(), netip.MustParseAddr("192.168.1.1")); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("private address: err %v, want ErrNotFound", err)
+	}
+	if after := mmdb.calls.Load() + tencent.calls.Load(); after != before {
+		t.Fatalf("public providers queried for a private address")
+	}
+}
+
+func TestChainErrors(t *testing.T) {
+	broken := &fakeLocator{name: "tencent", err: errors.New("timeout")}
+	ip := netip.MustParseAddr("8.8.8.8")
+
+	// 其他来源成功时忽略前面来源的错误
+	ok := &fakeLocator{name: "mmdb", results: map[string]Location{"8.8.8.8": {City: "mmdb"}}}
+	if loc, err := (Chain{broken, ok}).Locate(context.Background(), ip); err != nil || loc.Source != "mmdb" {
+		t.Fatalf("Locate = %+v, %v, want the mmdb result", loc, err)
+	}
+	// 有来源出错时不返回 ErrNotFound，以免被当作无法定位缓存
+	_, err := (Chain{&fakeLocator{name: "mmdb"}, broken}).Locate(context.Background(), ip)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("err %v, want the provider error", err)
+	}
+	if _, err := (Chain{}).Locate(context.Background(), ip); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("empty chain: err %v, want ErrNotFound", err)
+	}
+}
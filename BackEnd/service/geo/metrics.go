@@ -0,0 +1,79 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync/atomic"
+	"time"
+)
+
+// ProviderStats 单个定位来源的请求数、结果与耗时
+type ProviderStats struct {
+	Requests     uint64  `json:"requests"`
+	Found        uint64  `json:"found"`
+	NotFound     uint64  `json:"not_found"`
+	Errors       uint64  `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	MaxLatencyMs float64 `json:"max_latency_ms"`
+}
+
+// Metrics 定位来源的统计，来源重建后可继续沿用同一 Metrics
+type Metrics struct {
+	requests     atomic.Uint64
+	found        atomic.Uint64
+	notFound     atomic.Uint64
+	errors       atomic.Uint64
+	totalLatency atomic.Int64
+	maxLatency   atomic.Int64
+}
+
+func (m *Metrics) observe(latency time.Duration, err error) {
+	m.requests.Add(1)
+	switch {
+	case err == nil:
+		m.found.Add(1)
+	case errors.Is(err, ErrNotFound):
+		m.notFound.Add(1)
+	default:
+		m.errors.Add(1)
+	}
+	m.totalLatency.Add(int64(latency))
+	for {
+		max := m.maxLatency.Load()
+		if int64(latency) <= max || m.maxLatency.CompareAndSwap(max, int64(latency)) {
+			return
+		}
+	}
+}
+
+func (m *Metrics) Stats() ProviderStats {
+	stats := ProviderStats{
+		Requests:     m.requests.Load(),
+		Found:        m.found.Load(),
+		NotFound:     m.notFound.Load(),
+		Errors:       m.errors.Load(),
+		MaxLatencyMs: float64(m.maxLatency.Load()) / float64(time.Millisecond),
+	}
+	if stats.Requests > 0 {
+		stats.AvgLatencyMs = float64(m.totalLatency.Load()) / float64(stats.Requests) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+type instrumented struct {
+	GeoLocator
+	metrics *Metrics
+}
+
+// Instrument 返回将每次查询记入 metrics 的 locator
+func Instrument(locator GeoLocator, metrics *Metrics) GeoLocator {
+	return instrumented{GeoLocator: locator, metrics: metrics}
+}
+
+func (i instrumented) Locate(ctx context.Context, ip netip.Addr) (Location, error) {
+	start := time.Now()
+	loc, err := i.GeoLocator.Locate(ctx, ip)
+	i.metrics.observe(time.Since(start), err)
+	return loc, err
+}
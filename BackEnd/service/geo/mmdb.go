@@ -0,0 +1,61 @@
+package geo
+
+import (
+	"UserPortrait/functions"
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// MMDBLocator 离线MaxMind格式库（如GeoLite2-City），不依赖网络
+type MMDBLocator struct {
+	reader   *geoip2.Reader
+	language string
+}
+
+// OpenMMDB 打开库文件，language 为地名语言（如 zh-CN），无该语言的名称时使用英文名
+func OpenMMDB(path string, language string) (*MMDBLocator, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open mmdb %s failed: %v", path, err)
+	}
+	return &MMDBLocator{reader: reader, language: language}, nil
+}
+
+func (m *MMDBLocator) Name() string {
+	return "mmdb"
+}
+
+func (m *MMDBLocator) Locate(_ context.Context, ip netip.Addr) (Location, error) {
+	record, err := m.reader.City(ip.Unmap().AsSlice())
+	if err != nil {
+		return Location{}, err
+	}
+	if record.City.GeoNameID == 0 && record.Location.Latitude == 0 && record.Location.Longitude == 0 {
+		return Location{}, ErrNotFound
+	}
+	loc := Location{
+		City:      m.name(record.City.Names),
+		Latitude:  functions.RoundToFloat32(record.Location.Latitude, 4),
+		Longitude: functions.RoundToFloat32(record.Location.Longitude, 4),
+	}
+	// 库中没有区县，使用最细一级行政区划
+	if n := len(record.Subdivisions); n > 1 {
+		loc.District = m.name(record.Subdivisions[n-1].Names)
+	}
+	return loc, nil
+}
+
+func (m *MMDBLocator) name(names map[string]string) string {
+	if name, ok := names[m.language]; ok {
+		return name
+	}
+	return names["en"]
+}
+
+// Close 关闭库文件，关闭后不可再调用 Locate
+func (m *MMDBLocator) Close() error {
+	return m.reader.Close()
+}
@@ -0,0 +1,53 @@
+package geo
+
+import (
+	"context"
+	"net/netip"
+)
+
+// 运营商级NAT地址段（RFC 6598），netip 未将其归为私有地址
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// Special 返回私有、CGNAT、环回、链路本地、组播、未指定及IPv6 ULA等公网定位库无法定位的地址类别，
+// 公网地址返回 ok 为false
+func Special(ip netip.Addr) (kind string, ok bool) {
+	ip = ip.Unmap()
+	switch {
+	case ip.IsPrivate():
+		// 包含IPv6 ULA fc00::/7
+		return "private", true
+	case cgnatPrefix.Contains(ip):
+		return "cgnat", true
+	case ip.IsLoopback():
+		return "loopback", true
+	case ip.IsLinkLocalUnicast():
+		return "link-local", true
+	case ip.IsMulticast():
+		return "multicast", true
+	case ip.IsUnspecified():
+		return "unspecified", true
+	}
+	return "", false
+}
+
+// IsSpecial 是否为公网定位库无法定位的地址，见 Special
+func IsSpecial(ip netip.Addr) bool {
+	_, ok := Special(ip)
+	return ok
+}
+
+type publicOnly struct {
+	GeoLocator
+}
+
+// PublicOnly 对特殊地址直接返回 ErrNotFound，避免公网定位来源的无效查询
+func PublicOnly(locator GeoLocator) GeoLocator {
+	return publicOnly{GeoLocator: locator}
+}
+
+func (p publicOnly) Locate(ctx context.Context, ip netip.Addr) (Location, error) {
+	if IsSpecial(ip) {
+		return Location{}, ErrNotFound
+	}
+	return p.GeoLocator.Locate(ctx, ip)
+}
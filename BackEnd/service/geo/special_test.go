@@ -0,0 +1,40 @@
+package geo
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestSpecial(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.1.2.3", "private"},
+		{"172.16.0.1", "private"},
+		{"192.168.1.1", "private"},
+		{"fd00::1", "private"},
+		{"100.64.0.1", "cgnat"},
+		{"100.127.255.254", "cgnat"},
+		{"127.0.0.1", "loopback"},
+		{"::1", "loopback"},
+		{"169.254.1.1", "link-local"},
+		{"fe80::1", "link-local"},
+		{"224.0.0.251", "multicast"},
+		{"ff02::1", "multicast"},
+		{"0.0.0.0", "unspecified"},
+		{"::", "unspecified"},
+		{"::ffff:192.168.1.1", "private"},
+		{"100.128.0.1", ""},
+		{"8.8.8.8", ""},
+		{"2001:4860:4860::8888", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			kind, ok := Special(netip.MustParseAddr(tt.ip))
+			if kind != tt.want || ok != (tt.want != "") {
+				t.Fatalf("Special(%s) = %q, %t, want %q", tt.ip, kind, ok, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package geo
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+)
+
+// StaticEntry 静态表中的一项：Prefix 内的地址均定位到 Location，Location.Source 为空时来源记为 static
+type StaticEntry struct {
+	Prefix   netip.Prefix
+	Location Location
+}
+
+// StaticLocator 静态CIDR表，用于私有网段、基站子网等公网库无法定位的地址，多个网段重叠时取前缀最长者
+type StaticLocator struct {
+	entries []StaticEntry
+}
+
+func NewStaticLocator(entries []StaticEntry) *StaticLocator {
+	sorted := make([]StaticEntry, 0, len(entries))
+	for _, entry := range entries {
+		entry.Prefix = entry.Prefix.Masked()
+		sorted = append(sorted, entry)
+	}
+	// 前缀长的在前，查找时第一个命中的即为最长前缀
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Prefix.Bits() > sorted[j].Prefix.Bits()
+	})
+	return &StaticLocator{entries: sorted}
+}
+
+func (s *StaticLocator) Name() string {
+	return "static"
+}
+
+func (s *StaticLocator) Locate(_ context.Context, ip netip.Addr) (Location, error) {
+	ip = ip.Unmap()
+	for _, entry := range s.entries {
+		if entry.Prefix.Contains(ip) {
+			return entry.Location, nil
+		}
+	}
+	return Location{}, ErrNotFound
+}
+
+// Len 静态表的网段数
+func (s *StaticLocator) Len() int {
+	return len(s.entries)
+}
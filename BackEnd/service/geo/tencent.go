@@ -0,0 +1,87 @@
+package geo
+
+import (
+	"UserPortrait/configs"
+	"UserPortrait/functions"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// tencentResponse 腾讯地图IP定位接口的返回
+type tencentResponse struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+	Result  struct {
+		Ip       string `json:"ip"`
+		Location struct {
+			Lat float64 `json:"lat"`
+			Lng float64 `json:"lng"`
+		} `json:"location"`
+		AdInfo struct {
+			Nation     string `json:"nation"`
+			NationCode int    `json:"nation_code"`
+			Province   string `json:"province"`
+			City       string `json:"city"`
+			District   string `json:"district"`
+			Adcode     int    `json:"adcode"`
+		} `json:"ad_info"`
+	} `json:"result"`
+}
+
+// 腾讯地图对局域网等无法定位的IP返回的状态码
+const tencentStatusUnknownIP = 375
+
+// TencentLocator 调用腾讯地图API定位，每次请求时读取当前配置中的key与sk
+type TencentLocator struct {
+	client *http.Client
+}
+
+func NewTencentLocator(timeout time.Duration) *TencentLocator {
+	return &TencentLocator{client: &http.Client{Timeout: timeout}}
+}
+
+func (t *TencentLocator) Name() string {
+	return "tencent"
+}
+
+func (t *TencentLocator) Locate(ctx context.Context, ip netip.Addr) (Location, error) {
+	tencentMap := configs.Get().TencentMap
+	url := fmt.Sprintf("/ws/location/v1/ip?ip=%s&key=%s", ip.Unmap(), tencentMap.Key)
+	sig := functions.GetMD5Hash(url + tencentMap.SK)
+	requestURL := fmt.Sprintf("https://apis.map.qq.com%s&sig=%s", url, sig)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return Location{}, fmt.Errorf("new request failed: %v", err)
+	}
+	res, err := t.client.Do(req)
+	if err != nil {
+		return Location{}, fmt.Errorf("request failed: %v", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return Location{}, fmt.Errorf("read response failed: %v", err)
+	}
+	var resp tencentResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Location{}, fmt.Errorf("parse response failed: %v", err)
+	}
+	if resp.Status == tencentStatusUnknownIP {
+		return Location{}, ErrNotFound
+	}
+	if resp.Status != 0 {
+		return Location{}, fmt.Errorf("status %d: %s", resp.Status, resp.Message)
+	}
+	return Location{
+		City:      resp.Result.AdInfo.City,
+		District:  resp.Result.AdInfo.District,
+		Latitude:  functions.RoundToFloat32(resp.Result.Location.Lat, 4),
+		Longitude: functions.RoundToFloat32(resp.Result.Location.Lng, 4),
+	}, nil
+}
@@ -1,19 +1,26 @@
 package service
 
 import (
+	"UserPortrait/configs"
 	"UserPortrait/service/prediction"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-var predictionClient *prediction.Client
+var predictionClient atomic.Pointer[prediction.Client]
 
-// InitPredictionClient 初始化预测客户端
+// InitPredictionClient 初始化预测客户端，预测服务地址热加载后重新调用以替换客户端
 func InitPredictionClient(config prediction.ServiceConfig) {
-	predictionClient = prediction.NewClient(config)
+	predictionClient.Store(prediction.NewClient(config))
+}
+
+// PredictionClient 当前的预测客户端
+func PredictionClient() *prediction.Client {
+	return predictionClient.Load()
 }
 
 // GetPrediction 获取预测结果
@@ -37,7 +44,7 @@ func GetPrediction(c *gin.Context) {
 	}
 
 	// 使用预测客户端进行预测
-	resp, err := predictionClient.Predict(req)
+	resp, err := PredictionClient().Predict(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "预测失败",
@@ -96,26 +103,27 @@ func generatePredictionSummary(predictions []prediction.TimePoint) gin.H {
 	}
 }
 
-// TriggerTraining 手动触发模型训练
-func TriggerTraining(c *gin.Context) {
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-
+// NewTrainingRequest 以当前配置的训练参数构建训练请求，起止日期任一为空时使用过去一个月的数据
+func NewTrainingRequest(startDate string, endDate string) prediction.TrainingRequest {
 	if startDate == "" || endDate == "" {
-		// 默认使用过去一个月的数据
 		now := time.Now()
 		endDate = now.Format("2006-01-02")
 		startDate = now.AddDate(0, -1, 0).Format("2006-01-02")
 	}
-
-	req := prediction.TrainingRequest{
+	training := configs.Get().Training
+	return prediction.TrainingRequest{
 		StartDate: startDate,
 		EndDate:   endDate,
-		Epochs:    50,
-		BatchSize: 32,
+		Epochs:    training.Epochs,
+		BatchSize: training.BatchSize,
 	}
+}
+
+// TriggerTraining 手动触发模型训练
+func TriggerTraining(c *gin.Context) {
+	req := NewTrainingRequest(c.Query("start_date"), c.Query("end_date"))
 
-	if err := predictionClient.Train(req); err != nil {
+	if err := PredictionClient().Train(req); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"message": "训练失败",
 			"error":   err.Error(),
@@ -124,7 +132,7 @@ func TriggerTraining(c *gin.Context) {
 	}
 
 	// 获取模型状态
-	status, err := predictionClient.GetModelStatus()
+	status, err := PredictionClient().GetModelStatus()
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"message": "训练成功，但获取模型状态失败",
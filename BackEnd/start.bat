@@ -15,7 +15,7 @@ timeout /t 10
 
 :: 2. 启动Go后端服务
 echo Starting Go Backend Service...
-start cmd /k "go run routers/app.go"
+start cmd /k "go run ./cmd/userportrait serve -capture"
 
 echo All services started successfully!
 echo ML Service running on http://localhost:8000
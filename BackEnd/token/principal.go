@@ -0,0 +1,39 @@
+package token
+
+import (
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// 认证中间件写入gin上下文的键
+const principalKey = "principal"
+
+// Principal 通过认证的调用方；管理员代入用户身份时 Role 为 RoleUser，ImpersonatorID 为管理员ID。
+// TokenID、ExpiresAt 为本次请求所用token的jti与过期时间，用于退出登录时吊销该token
+type Principal struct {
+	ID             uint      `json:"id"`
+	Role           string    `json:"role"`
+	ImpersonatorID uint      `json:"impersonator_id,omitempty"`
+	TokenID        string    `json:"-"`
+	ExpiresAt      time.Time `json:"-"`
+}
+
+// SetPrincipal 由认证中间件调用，记录本次请求的调用方
+func SetPrincipal(c *gin.Context, p Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal 获取认证中间件记录的调用方，未经认证的请求 ok 为false
+func GetPrincipal(c *gin.Context) (p Principal, ok bool) {
+	value, exists := c.Get(principalKey)
+	if !exists {
+		return Principal{}, false
+	}
+	p, ok = value.(Principal)
+	return p, ok
+}
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationChecker 查询吊销列表，返回claims对应的access token是否已吊销
+type RevocationChecker func(claims *Claims) (bool, error)
+
+var revocationChecker atomic.Pointer[RevocationChecker]
+
+// SetRevocationChecker 设置 Authenticate 使用的吊销列表，未设置时不检查吊销
+func SetRevocationChecker(fn RevocationChecker) {
+	revocationChecker.Store(&fn)
+}
+
+// 查询吊销列表失败时按已吊销处理
+func checkRevoked(claims *Claims) error {
+	fn := revocationChecker.Load()
+	if fn == nil {
+		return nil
+	}
+	revoked, err := (*fn)(claims)
+	if err != nil {
+		return fmt.Errorf("check token revocation failed: %v", err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// NewRefreshToken 生成随机的刷新token，服务端只保存其哈希
+func NewRefreshToken() (refreshToken string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("generate refresh token failed: %v", err)
+	}
+	refreshToken = base64.RawURLEncoding.EncodeToString(b)
+	return refreshToken, HashRefreshToken(refreshToken), nil
+}
+
+// HashRefreshToken 刷新token的SHA-256哈希
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewFamily 生成新的刷新token族标识
+func NewFamily() (string, error) {
+	return newJTI()
+}
@@ -2,134 +2,172 @@ package token
 
 import (
 	"UserPortrait/configs"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Claims token携带的声明：sub 为用户或管理员ID，role 区分两者；
+// 用户token与管理员token分别以 auth.salt、auth.admin_salt 派生的密钥签名，无法互相伪造
+type Claims struct {
+	Role           string `json:"role"`
+	ImpersonatorID uint   `json:"impersonator_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+var (
+	ErrTokenMissing = errors.New("token is missing")
+	ErrInvalidRole  = errors.New("invalid role claim")
+)
+
+func init() {
+	// iat精确到毫秒，使退出全部登录之后立即签发的token不会被误判为已吊销
+	jwt.TimePrecision = time.Millisecond
+}
+
 func GenerateUserToken(userId uint) (string, error) {
-	tokenLifespan := configs.TOKEN_LIFESPAN
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["user_id"] = userId
-	claims["salt"] = configs.Salt
-	claims["exp"] = time.Now().Add(time.Hour * time.Duration(tokenLifespan)).Unix()
-	userToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return userToken.SignedString([]byte(configs.TOKEN_SECRET))
+	return generate(Principal{ID: userId, Role: RoleUser}, configs.Get().Auth.TokenLifespan)
 }
 
-//TODO:管理员token需要接口
+// GenerateImpersonationToken 管理员代入用户身份的token，权限与该用户相同，有效期为 auth.impersonation_lifespan
+func GenerateImpersonationToken(userId uint, adminId uint) (string, error) {
+	return generate(Principal{ID: userId, Role: RoleUser, ImpersonatorID: adminId}, configs.Get().Auth.ImpersonationLifespan)
+}
 
 func GenerateAdminToken(adminId uint) (string, error) {
-	tokenLifespan := configs.TOKEN_LIFESPAN
-	claims := jwt.MapClaims{}
-	claims["authorized"] = true
-	claims["admin_id"] = adminId
-	claims["admin_salt"] = configs.AdminSalt
-	claims["exp"] = time.Now().Add(time.Hour * time.Duration(tokenLifespan)).Unix()
-	adminToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return adminToken.SignedString([]byte(configs.TOKEN_SECRET))
+	return generate(Principal{ID: adminId, Role: RoleAdmin}, configs.Get().Auth.TokenLifespan)
 }
 
-func UserTokenValid(c *gin.Context) error {
-	tokenString := ExtractToken(c)
-	if tokenString == "" {
-		return fmt.Errorf("token is missing")
-	}
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(configs.TOKEN_SECRET), nil
-	})
+func generate(p Principal, lifespan time.Duration) (string, error) {
+	auth := configs.Get().Auth
+	jti, err := newJTI()
 	if err != nil {
-		return err
+		return "", err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if claims["salt"] == configs.Salt && claims["authorized"] == true {
-			fmt.Printf("UID %v\n:Token Valid\n", claims["user_id"])
-			return nil
-		}
-	} else {
-		return errors.New("invalid token")
+	now := time.Now()
+	claims := Claims{
+		Role:           p.Role,
+		ImpersonatorID: p.ImpersonatorID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatUint(uint64(p.ID), 10),
+			Issuer:    auth.Issuer,
+			Audience:  jwt.ClaimStrings{auth.Audience},
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifespan)),
+		},
 	}
-	exp, ok := token.Claims.(jwt.MapClaims)["exp"].(float64)
-	if !ok {
-		return errors.New("invalid exp claim")
+	key, err := signingKey(p.Role)
+	if err != nil {
+		return "", err
 	}
-	if time.Now().Unix() > int64(exp) {
-		return errors.New("token has expired")
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// 按角色派生签名密钥
+func signingKey(role string) ([]byte, error) {
+	auth := configs.Get().Auth
+	var salt string
+	switch role {
+	case RoleUser:
+		salt = auth.Salt
+	case RoleAdmin:
+		salt = auth.AdminSalt
+	default:
+		return nil, ErrInvalidRole
 	}
-	return nil
+	mac := hmac.New(sha256.New, []byte(auth.TokenSecret))
+	mac.Write([]byte(role + ":" + salt))
+	return mac.Sum(nil), nil
 }
 
-func AdminTokenValid(c *gin.Context) error {
-	tokenString := ExtractToken(c)
-	if tokenString == "" {
-		return fmt.Errorf("token is missing")
+func newJTI() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate jti failed: %v", err)
 	}
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(configs.TOKEN_SECRET), nil
-	})
+	return hex.EncodeToString(b), nil
+}
+
+// Parse 校验token并返回其声明：仅接受HS256，要求签名、iss、aud、exp、iat、jti与sub均有效
+func Parse(tokenString string) (*Claims, error) {
+	auth := configs.Get().Auth
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (any, error) {
+		return signingKey(t.Claims.(*Claims).Role)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(auth.Issuer),
+		jwt.WithAudience(auth.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if claims["admin_salt"] == configs.AdminSalt && claims["authorized"] == true {
-			fmt.Printf("AdminID %v\n:Token Valid\n", claims["admin_id"])
-			return nil
-		}
-	} else {
-		return errors.New("invalid token")
+	if claims.ID == "" {
+		return nil, errors.New("token has no jti claim")
 	}
-	exp, ok := token.Claims.(jwt.MapClaims)["exp"].(float64)
-	if !ok {
-		return errors.New("invalid exp claim")
+	if claims.IssuedAt == nil {
+		return nil, errors.New("token has no iat claim")
 	}
-	if time.Now().Unix() > int64(exp) {
-		return errors.New("token has expired")
+	if _, err := claims.Principal(); err != nil {
+		return nil, err
 	}
-	return nil
+	return claims, nil
 }
 
-// 从请求头中获取token
-func ExtractToken(c *gin.Context) string {
-	bearerToken := c.GetHeader("Authorization")
-	if len(strings.Split(bearerToken, " ")) == 2 {
-		token := strings.Split(bearerToken, " ")[1]
-		return token
+// Principal token对应的调用方
+func (c *Claims) Principal() (Principal, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 32)
+	if err != nil || id == 0 {
+		return Principal{}, errors.New("invalid sub claim")
+	}
+	switch c.Role {
+	case RoleUser:
+	case RoleAdmin:
+		if c.ImpersonatorID != 0 {
+			return Principal{}, errors.New("admin token cannot carry impersonator_id")
+		}
+	default:
+		return Principal{}, ErrInvalidRole
+	}
+	principal := Principal{ID: uint(id), Role: c.Role, ImpersonatorID: c.ImpersonatorID, TokenID: c.ID}
+	if c.ExpiresAt != nil {
+		principal.ExpiresAt = c.ExpiresAt.Time
 	}
-	return ""
+	return principal, nil
 }
 
-// 从jwt中解析出user_id
-func ExtractTokenID(c *gin.Context) (uint, error) {
+// Authenticate 校验请求头中的token并检查吊销列表，返回对应的调用方
+func Authenticate(c *gin.Context) (Principal, error) {
 	tokenString := ExtractToken(c)
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(configs.TOKEN_SECRET), nil
-	})
+	if tokenString == "" {
+		return Principal{}, ErrTokenMissing
+	}
+	claims, err := Parse(tokenString)
 	if err != nil {
-		return 0, err
-	}
-	claims, ok := token.Claims.(jwt.MapClaims)
-	// 如果jwt有效，将user_id转换为浮点数字符串，然后再转换为 uint32
-	if ok && token.Valid {
-		uid, err := strconv.ParseUint(fmt.Sprintf("%.0f", claims["user_id"]), 10, 32)
-		if err != nil {
-			return 0, err
-		}
-		return uint(uid), nil
+		return Principal{}, err
 	}
+	if err := checkRevoked(claims); err != nil {
+		return Principal{}, err
+	}
+	return claims.Principal()
+}
 
-	return 0, nil
+// 从请求头中获取token，格式为 Authorization: Bearer <token>
+func ExtractToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
 }
@@ -0,0 +1,124 @@
+package token
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"UserPortrait/configs"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func setTestConfig(t *testing.T) {
+	t.Helper()
+	cfg := configs.Default()
+	cfg.Auth.TokenSecret = "test-secret"
+	cfg.Auth.Salt = "user-salt"
+	cfg.Auth.AdminSalt = "admin-salt"
+	configs.Set(cfg)
+}
+
+// 按给定的声明与签名角色直接签发token，用于构造非法token
+func signClaims(t *testing.T, claims Claims, keyRole string, method jwt.SigningMethod) string {
+	t.Helper()
+	var key any = jwt.UnsafeAllowNoneSignatureType
+	if method != jwt.SigningMethodNone {
+		k, err := signingKey(keyRole)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = k
+	}
+	s, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	setTestConfig(t)
+	auth := configs.Get().Auth
+	now := time.Now()
+	valid := func(role string, sub uint) Claims {
+		return Claims{
+			Role: role,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   strconv.FormatUint(uint64(sub), 10),
+				Issuer:    auth.Issuer,
+				Audience:  jwt.ClaimStrings{auth.Audience},
+				ID:        "0123456789abcdef0123456789abcdef",
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			},
+		}
+	}
+	with := func(c Claims, fn func(*Claims)) Claims {
+		fn(&c)
+		return c
+	}
+	userToken, _ := GenerateUserToken(7)
+	adminToken, _ := GenerateAdminToken(1)
+	impersonationToken, _ := GenerateImpersonationToken(7, 1)
+
+	tests := []struct {
+		name  string
+		token string
+		want  Principal // 零值表示应解析失败
+	}{
+		{"user", userToken, Principal{ID: 7, Role: RoleUser}},
+		{"admin", adminToken, Principal{ID: 1, Role: RoleAdmin}},
+		{"impersonation", impersonationToken, Principal{ID: 7, Role: RoleUser, ImpersonatorID: 1}},
+		{"user claims signed with user key", signClaims(t, valid(RoleUser, 7), RoleUser, jwt.SigningMethodHS256), Principal{ID: 7, Role: RoleUser}},
+		{"role raised to admin", signClaims(t, valid(RoleAdmin, 7), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"alg none", signClaims(t, valid(RoleUser, 7), RoleUser, jwt.SigningMethodNone), Principal{}},
+		{"HS512", signClaims(t, valid(RoleUser, 7), RoleUser, jwt.SigningMethodHS512), Principal{}},
+		{"unknown role", signClaims(t, valid("root", 7), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"admin with impersonator", signClaims(t, with(valid(RoleAdmin, 1), func(c *Claims) { c.ImpersonatorID = 2 }), RoleAdmin, jwt.SigningMethodHS256), Principal{}},
+		{"expired", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Second)) }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"no exp", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.ExpiresAt = nil }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"no iat", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.IssuedAt = nil }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"no jti", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.ID = "" }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"wrong issuer", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.Issuer = "other" }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"wrong audience", signClaims(t, with(valid(RoleUser, 7), func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"zero sub", signClaims(t, valid(RoleUser, 0), RoleUser, jwt.SigningMethodHS256), Principal{}},
+		{"garbage", "not.a.token", Principal{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := Parse(tt.token)
+			if tt.want == (Principal{}) {
+				if err == nil {
+					t.Fatalf("accepted: %+v", claims)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := claims.Principal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got.TokenID, got.ExpiresAt = "", time.Time{}
+			if got != tt.want {
+				t.Fatalf("principal %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsOtherSecret(t *testing.T) {
+	setTestConfig(t)
+	userToken, err := GenerateUserToken(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := *configs.Get()
+	cfg.Auth.TokenSecret = "rotated-secret"
+	configs.Set(&cfg)
+	if _, err := Parse(userToken); err == nil {
+		t.Fatal("token signed with the previous secret accepted")
+	}
+}